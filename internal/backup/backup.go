@@ -0,0 +1,380 @@
+// Package backup packs the database together with the archives and thumbnails
+// of the data dir into a single tar.gz, and restores the data dir from it.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	fp "path/filepath"
+	"strings"
+	"time"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DatabaseFile is the name of SQLite database, both in the data dir and in the backup.
+	DatabaseFile = "shiori.db"
+
+	manifestFile    = "manifest.json"
+	manifestVersion = 1
+)
+
+// dataDirs is the directories of the data dir that are included in the backup.
+var dataDirs = []string{"archive", "thumb"}
+
+// Manifest describes the content of a backup. It's stored as the last file of the backup.
+type Manifest struct {
+	Version int    `json:"version"`
+	Created string `json:"created"`
+	Files   []File `json:"files"`
+}
+
+// File is a file in the backup with its checksum.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Create writes the backup of the data dir to w. The database is taken from
+// dbPath, which should be a consistent snapshot of the database in use.
+// The archives and thumbnails are taken from the data dir.
+func Create(w io.Writer, dataDir, dbPath string) (Manifest, error) {
+	manifest := Manifest{
+		Version: manifestVersion,
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	// Save database snapshot, then every file of the data directories
+	if err := addFile(tw, &manifest, dbPath, DatabaseFile); err != nil {
+		return manifest, err
+	}
+
+	for _, dir := range dataDirs {
+		root := fp.Join(dataDir, dir)
+		err := fp.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+			// The directory doesn't exist until something is saved in it
+			if filePath == root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			name, err := fp.Rel(dataDir, filePath)
+			if err != nil {
+				return err
+			}
+
+			return addFile(tw, &manifest, filePath, fp.ToSlash(name))
+		})
+		if err != nil {
+			return manifest, errors.WithStack(err)
+		}
+	}
+
+	// Save manifest, now that all checksums are known
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return manifest, errors.WithStack(err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:     manifestFile,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return manifest, errors.WithStack(err)
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return manifest, errors.WithStack(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, errors.WithStack(err)
+	}
+
+	return manifest, errors.WithStack(gz.Close())
+}
+
+// addFile writes the file in filePath to the backup as name,
+// and adds its checksum to manifest.
+func addFile(tw *tar.Writer, manifest *Manifest, filePath, name string) error {
+	f, err := os.Open(filePath)
+	// Bookmark could be deleted while the backup is created
+	if errors.Is(err, fs.ErrNotExist) && name != DatabaseFile {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, hash), io.LimitReader(f, info.Size()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n != info.Size() {
+		return errors.Errorf("%s changed while it was backed up", name)
+	}
+
+	manifest.Files = append(manifest.Files, File{
+		Path:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+
+	return nil
+}
+
+// Verify checks every file of the backup in r against the manifest,
+// without extracting anything.
+func Verify(r io.Reader) (Manifest, error) {
+	return extract(r, "")
+}
+
+// Restore replaces the database, archives and thumbnails of the data dir with
+// the backup in r. The backup is extracted next to the data and verified first,
+// so nothing is changed when it's damaged. The replaced data is removed when
+// the backup is restored, or put back when restoring fails halfway.
+//
+// Nothing else may use the data dir meanwhile, e.g. the server must be stopped.
+func Restore(r io.Reader, dataDir string) (Manifest, error) {
+	tmpDir, err := os.MkdirTemp(dataDir, ".restore-")
+	if err != nil {
+		return Manifest{}, errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	newDir := fp.Join(tmpDir, "new")
+	manifest, err := extract(r, newDir)
+	if err != nil {
+		return manifest, err
+	}
+
+	return manifest, swap(dataDir, newDir, fp.Join(tmpDir, "old"))
+}
+
+// extract reads the backup in r and checks its files against the manifest.
+// The files are written to dir unless it's empty.
+func extract(r io.Reader, dir string) (Manifest, error) {
+	var manifest *Manifest
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, errors.Wrap(err, "not a backup")
+	}
+
+	files := map[string]File{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, errors.Wrap(err, "damaged backup")
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !validName(hdr.Name) {
+			return Manifest{}, errors.Errorf("unexpected %q in backup", hdr.Name)
+		}
+
+		if hdr.Name == manifestFile {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return Manifest{}, errors.Wrap(err, "damaged manifest")
+			}
+			continue
+		}
+
+		if _, exist := files[hdr.Name]; exist {
+			return Manifest{}, errors.Errorf("%s is in backup twice", hdr.Name)
+		}
+
+		file, err := extractFile(tr, dir, hdr.Name)
+		if err != nil {
+			return Manifest{}, err
+		}
+		files[hdr.Name] = file
+	}
+
+	// Every file must match the manifest, and nothing else may be there
+	if manifest == nil {
+		return Manifest{}, errors.New("backup has no manifest")
+	}
+
+	if manifest.Version != manifestVersion {
+		return *manifest, errors.Errorf("backup version %d is not supported", manifest.Version)
+	}
+
+	for _, file := range manifest.Files {
+		if files[file.Path] != file {
+			return *manifest, errors.Errorf("%s doesn't match its checksum", file.Path)
+		}
+		delete(files, file.Path)
+	}
+
+	for name := range files {
+		return *manifest, errors.Errorf("%s is not in manifest", name)
+	}
+
+	if len(manifest.Files) == 0 || manifest.Files[0].Path != DatabaseFile {
+		return *manifest, errors.New("backup has no database")
+	}
+
+	return *manifest, nil
+}
+
+// extractFile computes the checksum of the current file of tr,
+// and writes it to dir unless it's empty.
+func extractFile(tr *tar.Reader, dir, name string) (File, error) {
+	hash := sha256.New()
+	w := io.Writer(hash)
+
+	if dir != "" {
+		filePath := fp.Join(dir, fp.FromSlash(name))
+		if err := os.MkdirAll(fp.Dir(filePath), model.DataDirPerm); err != nil {
+			return File{}, errors.WithStack(err)
+		}
+
+		f, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return File{}, errors.WithStack(err)
+		}
+		defer f.Close()
+
+		w = io.MultiWriter(f, hash)
+	}
+
+	n, err := io.Copy(w, tr)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "failed to extract %s", name)
+	}
+
+	return File{
+		Path:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// validName checks whether name can be in backup: the manifest, the database,
+// or a file inside one of the data directories.
+func validName(name string) bool {
+	if name == manifestFile || name == DatabaseFile {
+		return true
+	}
+
+	if path.Clean(name) != name || path.IsAbs(name) {
+		return false
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) < 2 {
+		return false
+	}
+
+	for _, part := range parts {
+		if part == ".." {
+			return false
+		}
+	}
+
+	for _, dir := range dataDirs {
+		if parts[0] == dir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// swap moves the current data of dataDir into oldDir, and the restored data
+// from newDir into its place. If anything fails, the current data is put back.
+func swap(dataDir, newDir, oldDir string) error {
+	// The journal of SQLite must go as well, otherwise it's applied to the restored database
+	names := append([]string{
+		DatabaseFile,
+		DatabaseFile + "-journal",
+		DatabaseFile + "-wal",
+		DatabaseFile + "-shm",
+	}, dataDirs...)
+
+	if err := os.MkdirAll(oldDir, model.DataDirPerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	moved := []string{}
+	restored := []string{}
+	rollback := func(err error) error {
+		for _, name := range restored {
+			_ = os.RemoveAll(fp.Join(dataDir, name))
+		}
+		for _, name := range moved {
+			_ = os.Rename(fp.Join(oldDir, name), fp.Join(dataDir, name))
+		}
+		return errors.WithStack(err)
+	}
+
+	for _, name := range names {
+		err := os.Rename(fp.Join(dataDir, name), fp.Join(oldDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return rollback(err)
+		}
+		moved = append(moved, name)
+	}
+
+	for _, name := range names {
+		err := os.Rename(fp.Join(newDir, name), fp.Join(dataDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return rollback(err)
+		}
+		restored = append(restored, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files with their content in dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		filePath := fp.Join(dir, fp.FromSlash(name))
+		if err := os.MkdirAll(fp.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFile returns content of the file, or "missing" when it doesn't exist.
+func readFile(t *testing.T, filePath string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func createTestBackup(t *testing.T) []byte {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	writeFiles(t, dataDir, map[string]string{
+		"archive/1":      "archive 1",
+		"archive/2":      "archive 2",
+		"thumb/1":        "thumb 1",
+		"snapshot.db":    "database snapshot",
+		"shiori.db":      "database in use",
+		"other/file.txt": "not backed up",
+	})
+
+	buf := bytes.Buffer{}
+	manifest, err := Create(&buf, dataDir, fp.Join(dataDir, "snapshot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, file := range manifest.Files {
+		names = append(names, file.Path)
+	}
+	if strings.Join(names, ",") != "shiori.db,archive/1,archive/2,thumb/1" {
+		t.Fatalf("unexpected files in backup %v", names)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRestore(t *testing.T) {
+	data := createTestBackup(t)
+
+	if _, err := Verify(bytes.NewReader(data)); err != nil {
+		t.Fatalf("backup is not valid: %v", err)
+	}
+
+	dataDir := t.TempDir()
+	writeFiles(t, dataDir, map[string]string{
+		"shiori.db":         "old database",
+		"shiori.db-journal": "old journal",
+		"archive/3":         "old archive",
+		"other/file.txt":    "kept",
+	})
+
+	if _, err := Restore(bytes.NewReader(data), dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"shiori.db":         "database snapshot",
+		"shiori.db-journal": "missing",
+		"archive/1":         "archive 1",
+		"archive/3":         "missing",
+		"thumb/1":           "thumb 1",
+		"other/file.txt":    "kept",
+	}
+	for name, content := range expected {
+		if got := readFile(t, fp.Join(dataDir, name)); got != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+
+	// Nothing is left behind
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("unexpected files in data dir %v", entries)
+	}
+}
+
+func TestRestoreDamaged(t *testing.T) {
+	data := createTestBackup(t)
+
+	// Flip a byte of archive 1 in the uncompressed backup
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := bytes.Buffer{}
+	if _, err := raw.ReadFrom(gz); err != nil {
+		t.Fatal(err)
+	}
+
+	damaged := bytes.Replace(raw.Bytes(), []byte("archive 1"), []byte("archive X"), 1)
+	tests := map[string][]byte{
+		"checksum": damaged,
+		"manifest": withoutManifest(t, raw.Bytes()),
+		"gzip":     data[:len(data)/2],
+	}
+
+	for name, content := range tests {
+		if name != "gzip" {
+			buf := bytes.Buffer{}
+			gw := gzip.NewWriter(&buf)
+			_, _ = gw.Write(content)
+			_ = gw.Close()
+			content = buf.Bytes()
+		}
+
+		dataDir := t.TempDir()
+		writeFiles(t, dataDir, map[string]string{"shiori.db": "old database"})
+
+		if _, err := Restore(bytes.NewReader(content), dataDir); err == nil {
+			t.Errorf("%s: expected error for damaged backup", name)
+		}
+
+		if got := readFile(t, fp.Join(dataDir, "shiori.db")); got != "old database" {
+			t.Errorf("%s: database is replaced by damaged backup: %q", name, got)
+		}
+	}
+}
+
+// withoutManifest returns the uncompressed backup without its manifest.
+func withoutManifest(t *testing.T, raw []byte) []byte {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	tw := tar.NewWriter(&buf)
+	tr := tar.NewReader(bytes.NewReader(raw))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Name == manifestFile {
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = tw.Close()
+
+	return buf.Bytes()
+}
+
+func TestValidName(t *testing.T) {
+	tests := map[string]bool{
+		"shiori.db":         true,
+		"manifest.json":     true,
+		"archive/1":         true,
+		"thumb/12":          true,
+		"archive":           false,
+		"archive/../../etc": false,
+		"/archive/1":        false,
+		"other/1":           false,
+		"archive/./1":       false,
+		"../shiori.db":      false,
+	}
+
+	for name, expected := range tests {
+		if got := validName(name); got != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/backup"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"os"
+	fp "path/filepath"
+	"time"
+)
+
+func backupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup [file]",
+		Short: "Back up the database, archives and thumbnails",
+		Long: "Back up the SQLite database together with the archives and thumbnails " +
+			"of the data dir into a single tar.gz, with a manifest of checksums. " +
+			"The database is copied consistently, so it's safe while the server is running. " +
+			"If file is not given, the backup is saved as shiori-backup-<time>.tar.gz " +
+			"in the current directory.",
+		Args: cobra.MaximumNArgs(1),
+		Run:  backupHandler,
+	}
+}
+
+func restoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore file",
+		Short: "Restore the data dir from a backup",
+		Long: "Replace the database, archives and thumbnails of the data dir with the backup. " +
+			"Every file of the backup is verified against its checksum before anything " +
+			"is replaced. Stop the server before restoring. Use --verify to only check the backup.",
+		Args: cobra.ExactArgs(1),
+		// The database is replaced, so it must not be opened
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			openDataDir(cmd)
+		},
+		Run: restoreHandler,
+	}
+
+	cmd.Flags().Bool("verify", false, "only verify the backup without restoring it")
+
+	return cmd
+}
+
+func backupHandler(cmd *cobra.Command, args []string) {
+	sqliteDB, ok := db.(*database.SQLiteDatabase)
+	if !ok {
+		_, _ = cError.Println("Backup only supports SQLite, use the backup tools of your database server instead")
+		os.Exit(1)
+	}
+
+	backupPath := "shiori-backup-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	if len(args) > 0 {
+		backupPath = args[0]
+	}
+
+	// Take a consistent snapshot of database, it's removed once it's in the backup
+	tmpDir, err := os.MkdirTemp(dataDir, ".backup-")
+	if err != nil {
+		_, _ = cError.Printf("Failed to create backup: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshotPath := fp.Join(tmpDir, backup.DatabaseFile)
+	err = sqliteDB.Snapshot(cmd.Context(), snapshotPath)
+	if err != nil {
+		_, _ = cError.Printf("Failed to create database snapshot: %v\n", err)
+		os.RemoveAll(tmpDir)
+		os.Exit(1)
+	}
+
+	// Never overwrite an existing backup
+	f, err := os.OpenFile(backupPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		_, _ = cError.Printf("Failed to create backup: %v\n", err)
+		os.RemoveAll(tmpDir)
+		os.Exit(1)
+	}
+
+	manifest, err := backup.Create(f, dataDir, snapshotPath)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_, _ = cError.Printf("Failed to create backup: %v\n", err)
+		os.Remove(backupPath)
+		os.RemoveAll(tmpDir)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Backup with %d files saved to %s\n", len(manifest.Files), backupPath)
+}
+
+func restoreHandler(cmd *cobra.Command, args []string) {
+	f, err := os.Open(args[0])
+	if err != nil {
+		_, _ = cError.Printf("Failed to open backup: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	verifyOnly, _ := cmd.Flags().GetBool("verify")
+	if verifyOnly {
+		manifest, err := backup.Verify(f)
+		if err != nil {
+			_, _ = cError.Printf("Backup is not valid: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Backup from %s with %d files is valid\n", manifest.Created, len(manifest.Files))
+		return
+	}
+
+	manifest, err := backup.Restore(f, dataDir)
+	if err != nil {
+		_, _ = cError.Printf("Failed to restore backup: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Restored %d files from backup of %s\n", len(manifest.Files), manifest.Created)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func dbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the data of databases",
+		// The databases are given by the flags of subcommands
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(dbCopyCmd())
+
+	return cmd
+}
+
+func dbCopyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copy all data to another database",
+		Long: "Copy accounts, saved searches, bookmarks, tags, readable content, notes and highlights to another database, " +
+			"e.g. to move from SQLite to MySQL or PostgreSQL. Databases are given as " +
+			"driver:source, where driver is sqlite, mysql or postgresql, and source is " +
+			"the path of SQLite file or the DSN of the server. The target database is " +
+			"migrated first and it must be empty. Bookmark IDs are kept, so the archives " +
+			"and thumbnails in the data dir still work. Revisions are not copied. " +
+			"Run shiori dedupe first if the source has duplicate bookmarks of the same page.",
+		Example: "  shiori db copy --from sqlite:shiori.db --to postgresql:\"host=127.0.0.1 user=shiori dbname=shiori\"",
+		Args:    cobra.NoArgs,
+		Run:     dbCopyHandler,
+	}
+
+	cmd.Flags().String("from", "", "source database as driver:source")
+	cmd.Flags().String("to", "", "target database as driver:source")
+	cmd.Flags().Int("batch-size", database.DefaultCopyBatchSize, "number of bookmarks copied at once")
+	_ = cmd.MarkFlagRequired("from")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+func dbCopyHandler(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	if batchSize < 1 {
+		_, _ = cError.Printf("%d is not a valid batch size\n", batchSize)
+		os.Exit(1)
+	}
+
+	src, err := openDatabaseSource(ctx, from, true)
+	if err != nil {
+		_, _ = cError.Printf("Failed to open source database: %v\n", err)
+		os.Exit(1)
+	}
+
+	dst, err := openDatabaseSource(ctx, to, false)
+	if err != nil {
+		_, _ = cError.Printf("Failed to open target database: %v\n", err)
+		os.Exit(1)
+	}
+
+	count, err := database.Copy(ctx, src, dst, batchSize)
+	if err != nil {
+		_, _ = cError.Printf("Failed to copy database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Copied %d accounts with %d saved searches, %d bookmarks with %d readable contents, "+
+		"%d notes and %d highlights, %d tags and %d bookmark tags\n",
+		count.Accounts, count.SavedSearches, count.Bookmarks, count.Contents,
+		count.Notes, count.Highlights, count.Tags, count.TagLinks)
+}
+
+// openDatabaseSource opens and migrates the database given as driver:source,
+// e.g. sqlite:/path/to/shiori.db. The SQLite file must exist when mustExist is true.
+func openDatabaseSource(ctx context.Context, arg string, mustExist bool) (database.DB, error) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("%q is not a valid database, use driver:source", arg)
+	}
+	driver, source := parts[0], parts[1]
+
+	var db database.DB
+	var err error
+	switch driver {
+	case "sqlite":
+		if _, statErr := os.Stat(source); mustExist && statErr != nil {
+			return nil, statErr
+		}
+		db, err = database.OpenSQLiteDatabase(ctx, source)
+	case "mysql":
+		db, err = database.OpenMySQLDatabase(ctx, source)
+	case "postgresql":
+		db, err = database.OpenPGDatabase(ctx, source)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
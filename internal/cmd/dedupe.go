@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func dedupeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dedupe",
+		Short: "Find and merge duplicate bookmarks",
+		Long: "Find the bookmarks of the same page, e.g. with and without www., " +
+			"tracking parameters or trailing slash, and merge each group into its oldest bookmark. " +
+			"The tags, notes and highlights of the duplicates are added to it, its empty excerpt, author and content " +
+			"are filled from them, and their archive and thumbnail are kept when it has none. " +
+			"The duplicates are deleted permanently.",
+		Args: cobra.NoArgs,
+		Run:  dedupeHandler,
+	}
+
+	cmd.Flags().BoolP("dry-run", "n", false, "only list the duplicates without merging them")
+
+	return cmd
+}
+
+func dedupeHandler(cmd *cobra.Command, args []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	groups, err := database.FindDuplicates(cmd.Context(), db)
+	if err != nil {
+		_, _ = cError.Printf("Failed to find duplicates: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No duplicate bookmarks found")
+		return
+	}
+
+	nMerged := 0
+	for _, group := range groups {
+		_, _ = cIndex.Printf("%d. ", group.Keep.ID)
+		_, _ = cTitle.Println(group.Keep.Title)
+		_, _ = cURL.Printf("   %s\n", group.Keep.URL)
+		for _, other := range group.Others {
+			_, _ = cRemoved.Printf("   - %d. %s\n", other.ID, other.URL)
+		}
+
+		if dryRun {
+			continue
+		}
+
+		if _, err := database.MergeDuplicates(cmd.Context(), db, group); err != nil {
+			_, _ = cError.Printf("Failed to merge duplicates of %s: %v\n", group.Keep.URL, err)
+			os.Exit(1)
+		}
+
+		nMerged += len(group.Others)
+	}
+
+	if dryRun {
+		fmt.Printf("%d bookmarks have duplicates\n", len(groups))
+		return
+	}
+
+	fmt.Printf("%d duplicates have been merged into %d bookmarks\n", nMerged, len(groups))
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+func exportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export [file]",
+		Short: "Export bookmarks as JSON",
+		Long: "Export the bookmarks outside of trash as a JSON array, with their tags, " +
+			"Markdown notes and highlights. Without file, or when it's -, " +
+			"the JSON is written to stdout. An existing file is never overwritten.",
+		Args: cobra.MaximumNArgs(1),
+		Run:  exportHandler,
+	}
+}
+
+func exportHandler(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+
+	bookmarks, err := db.GetBookMarks(ctx, database.GetBookmarksOptions{})
+	if err != nil {
+		_, _ = cError.Printf("Failed to get bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+
+	for i, book := range bookmarks {
+		bookmarks[i].Highlights, err = db.GetHighlights(ctx, book.ID)
+		if err != nil {
+			_, _ = cError.Printf("Failed to get highlights of bookmark %d: %v\n", book.ID, err)
+			os.Exit(1)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.OpenFile(args[0], os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			_, _ = cError.Printf("Failed to create export file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(&bookmarks); err != nil {
+		_, _ = cError.Printf("Failed to export bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+
+	if w != os.Stdout {
+		fmt.Printf("%d bookmarks have been exported\n", len(bookmarks))
+	}
+}
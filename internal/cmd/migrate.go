@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+func migrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema migrations",
+		Long: "Manage the database schema migrations. Every command runs the " +
+			"pending migrations automatically, unless --no-auto-migrate is set. " +
+			"This command never migrates automatically.",
+		// Open database without running the migrations
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			openDataDirAndDatabase(cmd)
+		},
+	}
+
+	cmd.AddCommand(
+		migrateStatusCmd(),
+		migrateUpCmd(),
+		migrateDownCmd(),
+		migrateGotoCmd(),
+	)
+
+	return cmd
+}
+
+func migrateStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the applied and pending migrations",
+		Args:  cobra.NoArgs,
+		Run:   migrateStatusHandler,
+	}
+}
+
+func migrateUpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "up [n]",
+		Short: "Apply pending migrations",
+		Long:  "Apply the next n pending migrations. If n is not given, all pending migrations will be applied.",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   migrateUpHandler,
+	}
+}
+
+func migrateDownCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "down [n]",
+		Short: "Revert applied migrations",
+		Long:  "Revert the last n applied migrations. If n is not given, only the last migration will be reverted.",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   migrateDownHandler,
+	}
+}
+
+func migrateGotoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "goto version",
+		Short: "Migrate up or down to the version",
+		Long:  "Apply or revert migrations until the schema is at the version. Version 0 reverts every migration.",
+		Args:  cobra.ExactArgs(1),
+		Run:   migrateGotoHandler,
+	}
+}
+
+func migrateStatusHandler(cmd *cobra.Command, args []string) {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		_, _ = cError.Printf("Failed to get migration status: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Current version: %d\n", status.Version)
+	if status.Dirty {
+		_, _ = cError.Printf("Migration %d failed halfway, the database has to be fixed manually\n", status.Version)
+	}
+
+	for _, migration := range status.Migrations {
+		_, _ = cIndex.Printf("%d. ", migration.Version)
+		if migration.Applied {
+			_, _ = cTitle.Printf("%s ", migration.Name)
+			_, _ = cSymbol.Println("applied")
+		} else if migration.Failed {
+			fmt.Printf("%s ", migration.Name)
+			_, _ = cError.Println("failed")
+		} else {
+			fmt.Printf("%s ", migration.Name)
+			_, _ = cURL.Println("pending")
+		}
+	}
+}
+
+func migrateUpHandler(cmd *cobra.Command, args []string) {
+	var err error
+	if len(args) == 0 {
+		err = db.Migrate()
+	} else {
+		n := parseMigrationSteps(args[0])
+		err = db.MigrateSteps(n)
+	}
+
+	if err != nil {
+		_, _ = cError.Printf("Failed to apply migrations: %v\n", err)
+		os.Exit(1)
+	}
+
+	printMigrationVersion()
+}
+
+func migrateDownHandler(cmd *cobra.Command, args []string) {
+	n := 1
+	if len(args) > 0 {
+		n = parseMigrationSteps(args[0])
+	}
+
+	err := db.MigrateSteps(-n)
+	if err != nil {
+		_, _ = cError.Printf("Failed to revert migrations: %v\n", err)
+		os.Exit(1)
+	}
+
+	printMigrationVersion()
+}
+
+func migrateGotoHandler(cmd *cobra.Command, args []string) {
+	version, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		_, _ = cError.Printf("%s is not a valid migration version\n", args[0])
+		os.Exit(1)
+	}
+
+	err = db.MigrateTo(uint(version))
+	if err != nil {
+		_, _ = cError.Printf("Failed to migrate: %v\n", err)
+		os.Exit(1)
+	}
+
+	printMigrationVersion()
+}
+
+// parseMigrationSteps converts the command argument into number of migrations.
+func parseMigrationSteps(arg string) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		_, _ = cError.Printf("%s is not a valid number of migrations\n", arg)
+		os.Exit(1)
+	}
+
+	return n
+}
+
+func printMigrationVersion() {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		_, _ = cError.Printf("Failed to get migration status: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Database is at version %d\n", status.Version)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func revisionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revision",
+		Short: "Manage the revision history of bookmarks",
+		Long: "Every update of a bookmark records its previous title, excerpt, " +
+			"tags and content as a revision. Set SHIORI_REVISION_LIMIT to change " +
+			"how many revisions are kept for each bookmark, 0 disables the history.",
+	}
+
+	cmd.AddCommand(
+		revisionListCmd(),
+		revisionDiffCmd(),
+		revisionRollbackCmd(),
+	)
+
+	return cmd
+}
+
+func revisionListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list bookmark-id",
+		Short: "List the revisions of a bookmark",
+		Args:  cobra.ExactArgs(1),
+		Run:   revisionListHandler,
+	}
+}
+
+func revisionDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff from-revision [to-revision]",
+		Short: "Show the changes between two revisions",
+		Long: "Show the changes between two revisions of the same bookmark. " +
+			"If the second revision is not given, the revision is compared " +
+			"with the current bookmark.",
+		Args: cobra.RangeArgs(1, 2),
+		Run:  revisionDiffHandler,
+	}
+}
+
+func revisionRollbackCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rollback revision-id",
+		Short: "Restore a bookmark to an older revision",
+		Long: "Restore title, excerpt, tags and content of a bookmark from the revision. " +
+			"The replaced state is recorded as a new revision, so the rollback can be undone.",
+		Args: cobra.ExactArgs(1),
+		Run:  revisionRollbackHandler,
+	}
+}
+
+func revisionListHandler(cmd *cobra.Command, args []string) {
+	ids, err := parseIDs(args)
+	if err != nil {
+		_, _ = cError.Println(err)
+		os.Exit(1)
+	}
+
+	revisions, err := db.GetBookmarkRevisions(cmd.Context(), ids[0])
+	if err != nil {
+		_, _ = cError.Printf("Failed to get revisions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(revisions) == 0 {
+		fmt.Println("Bookmark has no revisions")
+		return
+	}
+
+	for _, revision := range revisions {
+		_, _ = cIndex.Printf("%d. ", revision.ID)
+		_, _ = cTitle.Println(revision.Title)
+		_, _ = cSymbol.Printf("   saved at %s\n", revision.Created)
+		if len(revision.Tags) > 0 {
+			_, _ = cURL.Printf("   %s\n", strings.Join(revision.Tags, ", "))
+		}
+	}
+}
+
+func revisionDiffHandler(cmd *cobra.Command, args []string) {
+	ids, err := parseRevisionIDs(args)
+	if err != nil {
+		_, _ = cError.Println(err)
+		os.Exit(1)
+	}
+
+	toID := 0
+	if len(ids) > 1 {
+		toID = ids[1]
+	}
+
+	diffs, err := database.DiffBookmarkRevisions(cmd.Context(), db, ids[0], toID)
+	if err != nil {
+		_, _ = cError.Printf("Failed to compare revisions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+
+	for _, diff := range diffs {
+		_, _ = cTitle.Println(diff.Field)
+		for _, line := range diff.Lines {
+			switch line.Op {
+			case "+":
+				_, _ = cAdded.Printf("+ %s\n", line.Text)
+			case "-":
+				_, _ = cRemoved.Printf("- %s\n", line.Text)
+			default:
+				fmt.Printf("  %s\n", line.Text)
+			}
+		}
+	}
+}
+
+func revisionRollbackHandler(cmd *cobra.Command, args []string) {
+	ids, err := parseRevisionIDs(args)
+	if err != nil {
+		_, _ = cError.Println(err)
+		os.Exit(1)
+	}
+
+	book, err := db.RollbackBookmark(cmd.Context(), ids[0])
+	if err != nil {
+		_, _ = cError.Printf("Failed to roll back bookmark: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Bookmark %d has been rolled back to revision %d\n", book.ID, ids[0])
+}
+
+// parseRevisionIDs converts the command arguments into revision IDs.
+func parseRevisionIDs(args []string) ([]int, error) {
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%s is not a valid revision ID", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/new-aspect/shiori-practice/internal/database"
 	"github.com/new-aspect/shiori-practice/internal/model"
 	"github.com/spf13/cobra"
 	"os"
 	fp "path/filepath"
+	"strconv"
 )
 
 var (
@@ -25,8 +27,18 @@ func ShioriCmd() *cobra.Command {
 	// PersistentPreRun: children of this command will inherit and execute.
 	rootCmd.PersistentPreRun = preRunRootHandler
 	rootCmd.PersistentFlags().Bool("portable", false, "run shiori in portable mode")
+	rootCmd.PersistentFlags().Bool("no-auto-migrate", false, "don't run database migrations automatically, use \"shiori migrate\" instead")
 	rootCmd.AddCommand(
 		serveCmd(),
+		searchCmd(),
+		exportCmd(),
+		trashCmd(),
+		dedupeCmd(),
+		revisionCmd(),
+		migrateCmd(),
+		dbCmd(),
+		backupCmd(),
+		restoreCmd(),
 	)
 
 	return rootCmd
@@ -34,34 +46,74 @@ func ShioriCmd() *cobra.Command {
 
 // 初始化数据库
 func preRunRootHandler(cmd *cobra.Command, args []string) {
-	// Read flag
-	var err error
-	portableModel, _ := cmd.Flags().GetBool("portable")
+	openDataDirAndDatabase(cmd)
 
-	// Get and create data dir
-	dataDir, err = getDateDir(portableModel)
-	if err != nil {
-		_, _ = cError.Printf("Failed to get data dir :%v\n", err)
-		os.Exit(1)
+	// Pending migrations are only reported when auto migration is disabled
+	noAutoMigrate, _ := cmd.Flags().GetBool("no-auto-migrate")
+	if noAutoMigrate {
+		status, err := db.MigrationStatus()
+		if err != nil {
+			_, _ = cError.Printf("Failed to get migration status :%v\n", err)
+			os.Exit(1)
+		}
+		if status.Dirty {
+			_, _ = cError.Printf("Database migration %d failed halfway, check \"shiori migrate status\"\n", status.Version)
+		} else if pending := status.Pending(); pending > 0 {
+			_, _ = cError.Printf("Database has %d pending migrations, run \"shiori migrate up\" to apply them\n", pending)
+		}
+		return
 	}
 
-	err = os.MkdirAll(dataDir, model.DataDirPerm)
+	// Migrate 这个表示初始化数据库
+	err := db.Migrate()
 	if err != nil {
-		_, _ = cError.Printf("Failed to get data dir :%v\n", err)
+		_, _ = cError.Printf("Error running migration :%s\n", err)
 		os.Exit(1)
 	}
+}
+
+// openDataDirAndDatabase creates the data dir and opens the database.
+func openDataDirAndDatabase(cmd *cobra.Command) {
+	openDataDir(cmd)
 
 	// Open database
+	var err error
 	db, err = openDatabase(cmd.Context())
 	if err != nil {
 		_, _ = cError.Printf("Failed to open database :%v\n", err)
 		os.Exit(1)
 	}
 
-	// Migrate 这个表示初始化数据库
-	err = db.Migrate()
+	// Set how many revisions are kept for each bookmark
+	if strLimit, found := os.LookupEnv("SHIORI_REVISION_LIMIT"); found {
+		limit, err := strconv.Atoi(strLimit)
+		if err != nil || limit < 0 {
+			_, _ = cError.Printf("Invalid SHIORI_REVISION_LIMIT :%s\n", strLimit)
+			os.Exit(1)
+		}
+		db.SetRevisionLimit(limit)
+	}
+
+	// Archives and thumbnails are removed together with their bookmarks
+	db.SetDataDir(dataDir)
+}
+
+// openDataDir finds and creates the data dir.
+func openDataDir(cmd *cobra.Command) {
+	// Read flag
+	var err error
+	portableModel, _ := cmd.Flags().GetBool("portable")
+
+	// Get and create data dir
+	dataDir, err = getDateDir(portableModel)
 	if err != nil {
-		_, _ = cError.Printf("Error running migration :%s\n", err)
+		_, _ = cError.Printf("Failed to get data dir :%v\n", err)
+		os.Exit(1)
+	}
+
+	err = os.MkdirAll(dataDir, model.DataDirPerm)
+	if err != nil {
+		_, _ = cError.Printf("Failed to get data dir :%v\n", err)
 		os.Exit(1)
 	}
 }
@@ -105,6 +157,8 @@ func openDatabase(ctx context.Context) (database.DB, error) {
 		return openMysqlDatabase(ctx)
 	case "postgresql":
 		return openPostgreSQLDatabase(ctx)
+	case "memory":
+		return database.NewMemoryDatabase(), nil
 	default:
 		return openSQLiteDatabase(ctx)
 	}
@@ -116,9 +170,24 @@ func openSQLiteDatabase(ctx context.Context) (database.DB, error) {
 }
 
 func openMysqlDatabase(ctx context.Context) (database.DB, error) {
-	return nil, nil
+	user, _ := os.LookupEnv("SHIORI_MYSQL_USER")
+	password, _ := os.LookupEnv("SHIORI_MYSQL_PASS")
+	dbName, _ := os.LookupEnv("SHIORI_MYSQL_NAME")
+	dbAddress, _ := os.LookupEnv("SHIORI_MYSQL_ADDRESS")
+
+	connString := fmt.Sprintf("%s:%s@%s/%s?charset=utf8mb4", user, password, dbAddress, dbName)
+	return database.OpenMySQLDatabase(ctx, connString)
 }
 
 func openPostgreSQLDatabase(ctx context.Context) (database.DB, error) {
-	return nil, nil
+	host, _ := os.LookupEnv("SHIORI_PG_HOST")
+	port, _ := os.LookupEnv("SHIORI_PG_PORT")
+	user, _ := os.LookupEnv("SHIORI_PG_USER")
+	password, _ := os.LookupEnv("SHIORI_PG_PASS")
+	dbName, _ := os.LookupEnv("SHIORI_PG_NAME")
+	sslMode, _ := os.LookupEnv("SHIORI_PG_SSLMODE")
+
+	connString := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		host, port, user, password, dbName, sslMode)
+	return database.OpenPGDatabase(ctx, connString)
 }
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func searchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "search query",
+		Short: "Search bookmarks",
+		Long: "Search bookmarks with the same query as the search box of the web interface. " +
+			"Words and \"quoted phrases\" are searched in the URL, title, excerpt, content, notes and highlights. " +
+			"Use tag:name, site:example.com, is:public, is:private, has:archive, has:content, " +
+			"before:YYYY-MM-DD and after:YYYY-MM-DD to filter bookmarks, - to exclude the term, " +
+			"and OR to match any of the terms around it. The best matches are shown first. " +
+			"Put -- before a query that starts with -.",
+		Example: "  shiori search go tag:dev -tag:old\n" +
+			"  shiori search 'site:go.dev OR site:golang.org after:2020-01-01'\n" +
+			"  shiori search -- -is:public has:archive",
+		Args: cobra.MinimumNArgs(1),
+		Run:  searchHandler,
+	}
+
+	cmd.Flags().IntP("limit", "l", 0, "show at most this many bookmarks, 0 shows all of them")
+
+	return cmd
+}
+
+func searchHandler(cmd *cobra.Command, args []string) {
+	query := strings.Join(args, " ")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	search, err := database.ParseSearch(query)
+	if err != nil {
+		_, _ = cError.Printf("Invalid search: %v\n", err)
+
+		// Point at the problem
+		var syntaxErr *database.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			fmt.Printf("  %s\n  %s^\n", query, strings.Repeat(" ", syntaxErr.Pos))
+		}
+		os.Exit(1)
+	}
+
+	var archiveIDs []int
+	if search.NeedsArchives() {
+		archiveIDs, err = database.ArchiveIDs(dataDir)
+		if err != nil {
+			_, _ = cError.Printf("Failed to find archives: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	bookmarks, err := db.GetBookMarks(cmd.Context(), database.GetBookmarksOptions{
+		Search:      search,
+		ArchiveIDs:  archiveIDs,
+		OrderMethod: database.ByRelevance,
+		Limit:       limit,
+	})
+	if err != nil {
+		_, _ = cError.Printf("Failed to search bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(bookmarks) == 0 {
+		fmt.Println("No bookmarks found")
+		return
+	}
+
+	for _, book := range bookmarks {
+		_, _ = cIndex.Printf("%d. ", book.ID)
+		_, _ = cTitle.Println(book.Title)
+		_, _ = cURL.Printf("   %s\n", book.URL)
+
+		if len(book.Tags) > 0 {
+			tags := make([]string, len(book.Tags))
+			for i, tag := range book.Tags {
+				tags[i] = "#" + tag.Name
+			}
+			_, _ = cSymbol.Printf("   %s\n", strings.Join(tags, " "))
+		}
+	}
+}
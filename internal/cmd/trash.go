@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+func trashCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "Manage the deleted bookmarks in trash",
+	}
+
+	cmd.AddCommand(
+		trashListCmd(),
+		trashRestoreCmd(),
+		trashPurgeCmd(),
+	)
+
+	return cmd
+}
+
+func trashListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the bookmarks in trash",
+		Args:  cobra.NoArgs,
+		Run:   trashListHandler,
+	}
+}
+
+func trashRestoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore [ids]",
+		Short: "Restore bookmarks from trash",
+		Long: "Restore the bookmarks with matching IDs from trash. " +
+			"If no IDs given, all bookmarks in trash will be restored.",
+		Run: trashRestoreHandler,
+	}
+}
+
+func trashPurgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Permanently delete old bookmarks in trash",
+		Long: "Permanently delete the bookmarks that have been in trash " +
+			"longer than --days, including their archive and thumbnail. " +
+			"Use --days 0 to empty the trash.",
+		Args: cobra.NoArgs,
+		Run:  trashPurgeHandler,
+	}
+
+	cmd.Flags().IntP("days", "d", 30, "Purge bookmarks deleted more than this many days ago")
+
+	return cmd
+}
+
+func trashListHandler(cmd *cobra.Command, args []string) {
+	bookmarks, err := db.GetBookMarks(cmd.Context(), database.GetBookmarksOptions{
+		Trashed:     true,
+		OrderMethod: database.ByLastAdded,
+	})
+	if err != nil {
+		_, _ = cError.Printf("Failed to get bookmarks in trash: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(bookmarks) == 0 {
+		fmt.Println("Trash is empty")
+		return
+	}
+
+	for _, book := range bookmarks {
+		_, _ = cIndex.Printf("%d. ", book.ID)
+		_, _ = cTitle.Println(book.Title)
+		_, _ = cURL.Printf("   %s\n", book.URL)
+		_, _ = cSymbol.Printf("   deleted at %s\n", book.DeletedAt)
+	}
+}
+
+func trashRestoreHandler(cmd *cobra.Command, args []string) {
+	ids, err := parseIDs(args)
+	if err != nil {
+		_, _ = cError.Println(err)
+		os.Exit(1)
+	}
+
+	err = db.RestoreBookmarks(cmd.Context(), ids...)
+	if err != nil {
+		_, _ = cError.Printf("Failed to restore bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Bookmarks have been restored")
+}
+
+func trashPurgeHandler(cmd *cobra.Command, args []string) {
+	days, _ := cmd.Flags().GetInt("days")
+	if days < 0 {
+		_, _ = cError.Println("Days must not be negative")
+		os.Exit(1)
+	}
+
+	olderThan := time.Now().AddDate(0, 0, -days)
+	ids, err := db.PurgeBookmarks(cmd.Context(), olderThan)
+	if err != nil {
+		_, _ = cError.Printf("Failed to purge bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d bookmarks have been purged\n", len(ids))
+}
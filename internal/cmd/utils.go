@@ -1,7 +1,31 @@
 package cmd
 
-import "github.com/fatih/color"
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"strconv"
+)
 
 var (
-	cError = color.New(color.FgHiRed)
+	cIndex   = color.New(color.FgHiCyan)
+	cSymbol  = color.New(color.FgHiMagenta)
+	cTitle   = color.New(color.FgHiGreen).Add(color.Bold)
+	cURL     = color.New(color.FgHiYellow)
+	cError   = color.New(color.FgHiRed)
+	cAdded   = color.New(color.FgGreen)
+	cRemoved = color.New(color.FgRed)
 )
+
+// parseIDs converts the command arguments into bookmark IDs.
+func parseIDs(args []string) ([]int, error) {
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%s is not a valid bookmark ID", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
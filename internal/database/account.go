@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+// bookmarkAccountID returns the ID of the account that the bookmark belongs to.
+func bookmarkAccountID(ctx context.Context, db sqlx.ExtContext, id int) (int, error) {
+	var accountID int
+	err := sqlx.GetContext(ctx, db, &accountID, db.Rebind(`SELECT account_id FROM bookmark WHERE id = ?`), id)
+	if err == sql.ErrNoRows {
+		return 0, errors.Wrapf(ErrNotFound, "bookmark %d", id)
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return accountID, nil
+}
+
+// claimOrphans gives the bookmarks and tags without account to the first owner,
+// e.g. the ones saved before bookmarks belong to accounts. Nothing changes while
+// there is no owner. The tags are merged into the owner's tags with the same name
+// using mergeQuery, see renameTag. The bookmarks whose page is already saved by
+// the owner, i.e. with the same canonical URL, are kept without account, they are
+// still shown to the owners. It's only run when migrating to version 9, see migrationFixes.
+func claimOrphans(ctx context.Context, tx *sqlx.Tx, mergeQuery string) error {
+	var ownerID sql.NullInt64
+	err := tx.GetContext(ctx, &ownerID, tx.Rebind(`SELECT MIN(id) FROM account WHERE owner = ?`), true)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ownerID.Valid {
+		return nil
+	}
+
+	bookmarks := []model.Bookmark{}
+	err = tx.SelectContext(ctx, &bookmarks, `SELECT id, url FROM bookmark WHERE account_id = 0`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, book := range bookmarks {
+		book.AccountID = int(ownerID.Int64)
+		err := checkCanonicalURL(ctx, tx, book, CanonicalURL(book.URL))
+		if errors.Is(err, ErrAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE bookmark SET account_id = ? WHERE id = ?`), ownerID.Int64, book.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	tags := []model.Tag{}
+	err = tx.SelectContext(ctx, &tags, `SELECT id, name FROM tag WHERE account_id = 0`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Parents are claimed before their children, so children of a merged tag
+	// are moved to the owner's tag first
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.Count(tags[i].Name, tagSeparator) < strings.Count(tags[j].Name, tagSeparator)
+	})
+
+	for _, tag := range tags {
+		var targetID int
+		err := tx.GetContext(ctx, &targetID, tx.Rebind(`SELECT id FROM tag
+			WHERE account_id = ? AND name = ?`), ownerID.Int64, tag.Name)
+		if err != nil && err != sql.ErrNoRows {
+			return errors.WithStack(err)
+		}
+
+		if targetID != 0 {
+			if err := mergeTag(ctx, tx, tag.ID, targetID, mergeQuery); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE tag SET account_id = ? WHERE id = ?`), ownerID.Int64, tag.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// unshareAccountData prepares reverting version 9, after which the URL of bookmark and
+// the name of tag are unique across accounts again. The tags of different accounts with
+// the same name are merged into the oldest one using mergeQuery, see renameTag. It's refused
+// when accounts saved the same URL, as their bookmarks can't be merged without losing data.
+func unshareAccountData(ctx context.Context, tx *sqlx.Tx, mergeQuery string) error {
+	urls := []string{}
+	err := tx.SelectContext(ctx, &urls, `SELECT url FROM bookmark GROUP BY url HAVING COUNT(id) > 1`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(urls) > 0 {
+		return errors.Errorf("%d URLs are saved by more than one account, e.g. %q, "+
+			"delete the other bookmarks before reverting migration 9", len(urls), urls[0])
+	}
+
+	names := []string{}
+	err = tx.SelectContext(ctx, &names, `SELECT name FROM tag GROUP BY name HAVING COUNT(id) > 1`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Parents are merged before their children, like claimOrphans
+	sort.Slice(names, func(i, j int) bool {
+		return strings.Count(names[i], tagSeparator) < strings.Count(names[j], tagSeparator)
+	})
+
+	for _, name := range names {
+		ids := []int{}
+		err := tx.SelectContext(ctx, &ids, tx.Rebind(`SELECT id FROM tag WHERE name = ? ORDER BY id`), name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, id := range ids[1:] {
+			if err := mergeTag(ctx, tx, id, ids[0], mergeQuery); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	nurl "net/url"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+// trackingParams is the query parameters that only track where the visitor came from.
+// Parameters that start with utm_ are removed as well.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"gclsrc":  true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+}
+
+// CanonicalURL returns the form of URL that is the same for every URL of the same page,
+// so duplicate bookmarks can be found. The host is lowercased without www. and default port,
+// http is treated as https, tracking parameters and fragment are removed, the query is sorted
+// and the trailing slash is removed. Fragments that look like a route, e.g. #!/page or #/page,
+// are kept. URLs that can't be parsed are only trimmed.
+func CanonicalURL(url string) string {
+	url = strings.TrimSpace(url)
+	u, err := nurl.Parse(url)
+	if err != nil || u.Host == "" {
+		return url
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+
+	if scheme == "http" || scheme == "https" {
+		if port == "80" || port == "443" {
+			port = ""
+		}
+		scheme = "https"
+		host = strings.TrimPrefix(host, "www.")
+	}
+
+	if port != "" {
+		host += ":" + port
+	} else if strings.Contains(host, ":") {
+		// IPv6 address
+		host = "[" + host + "]"
+	}
+
+	// Remove tracking parameters, url.Values.Encode sorts the rest by key
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			delete(query, key)
+		}
+	}
+
+	result := scheme + "://"
+	if u.User != nil {
+		result += u.User.String() + "@"
+	}
+	result += host + strings.TrimRight(u.EscapedPath(), "/")
+
+	if len(query) > 0 {
+		result += "?" + query.Encode()
+	}
+
+	if strings.HasPrefix(u.Fragment, "!") || strings.HasPrefix(u.Fragment, "/") {
+		result += "#" + u.EscapedFragment()
+	}
+
+	return result
+}
+
+// checkCanonicalURL returns ErrAlreadyExists when a bookmark of the same account,
+// other than the bookmark itself, has the same canonical URL.
+func checkCanonicalURL(ctx context.Context, tx sqlx.ExtContext, book model.Bookmark, canonicalURL string) error {
+	var existingID int
+	err := sqlx.GetContext(ctx, tx, &existingID, tx.Rebind(`SELECT id FROM bookmark
+		WHERE account_id = ? AND canonical_url = ? AND id <> ?`), book.AccountID, canonicalURL, book.ID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.Wrapf(ErrAlreadyExists, "bookmark with url %q, same page as bookmark %d", book.URL, existingID)
+}
+
+// fillCanonicalURLs saves the canonical URL of bookmarks that don't have it yet,
+// e.g. the ones saved before canonical URLs are stored.
+func fillCanonicalURLs(ctx context.Context, tx *sqlx.Tx) error {
+	bookmarks := []model.Bookmark{}
+	err := tx.SelectContext(ctx, &bookmarks, `SELECT id, url FROM bookmark WHERE canonical_url = ''`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, book := range bookmarks {
+		_, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE bookmark SET canonical_url = ? WHERE id = ?`),
+			CanonicalURL(book.URL), book.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Duplicates is the bookmarks that have the same canonical URL.
+// Keep is the bookmark that the others are merged into.
+type Duplicates struct {
+	CanonicalURL string
+	Keep         model.Bookmark
+	Others       []model.Bookmark
+}
+
+// duplicateRow is a bookmark that has the same canonical URL as other bookmarks.
+type duplicateRow struct {
+	ID           int    `db:"id"`
+	AccountID    int    `db:"account_id"`
+	CanonicalURL string `db:"canonical_url"`
+}
+
+// groupDuplicateIDs groups the IDs of rows by their account and canonical URL,
+// the groups of a single bookmark are left out. The IDs of each group are
+// ascending, and groups are ordered by their first ID.
+func groupDuplicateIDs(rows []duplicateRow) [][]int {
+	type groupKey struct {
+		accountID    int
+		canonicalURL string
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	groups := [][]int{}
+	indexes := map[groupKey]int{}
+	for _, row := range rows {
+		key := groupKey{row.AccountID, row.CanonicalURL}
+		i, found := indexes[key]
+		if !found {
+			i = len(groups)
+			indexes[key] = i
+			groups = append(groups, []int{})
+		}
+		groups[i] = append(groups[i], row.ID)
+	}
+
+	duplicates := [][]int{}
+	for _, ids := range groups {
+		if len(ids) > 1 {
+			duplicates = append(duplicates, ids)
+		}
+	}
+
+	return duplicates
+}
+
+// getDuplicateIDs is GetDuplicateIDs of SQL database, grouped by the stored canonical URL.
+func getDuplicateIDs(ctx context.Context, db sqlx.ExtContext) ([][]int, error) {
+	rows := []duplicateRow{}
+	err := sqlx.SelectContext(ctx, db, &rows, `SELECT b.id, b.account_id, b.canonical_url
+		FROM bookmark b
+		JOIN (SELECT account_id, canonical_url FROM bookmark
+			GROUP BY account_id, canonical_url
+			HAVING COUNT(*) > 1) d ON d.account_id = b.account_id AND d.canonical_url = b.canonical_url`)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	return groupDuplicateIDs(rows), nil
+}
+
+// FindDuplicates finds the bookmarks of the same account with the same canonical URL,
+// including the ones in trash. The oldest bookmark that isn't in trash is kept, or the
+// oldest one when all of them are. Groups are ordered by the ID of the kept bookmark.
+// Only the bookmarks that have duplicates are fetched with their content.
+func FindDuplicates(ctx context.Context, db DB) ([]Duplicates, error) {
+	groups, err := db.GetDuplicateIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Duplicates{}
+	for _, ids := range groups {
+		// The bookmarks outside of trash come first, each by their ID
+		bookmarks := []model.Bookmark{}
+		for _, trashed := range []bool{false, true} {
+			books, err := db.GetBookMarks(ctx, GetBookmarksOptions{
+				IDs:         ids,
+				Trashed:     trashed,
+				WithContent: true,
+				OrderMethod: DefaultOrder,
+			})
+			if err != nil {
+				return nil, err
+			}
+			bookmarks = append(bookmarks, books...)
+		}
+
+		// Removed in the meantime
+		if len(bookmarks) < 2 {
+			continue
+		}
+
+		result = append(result, Duplicates{
+			CanonicalURL: CanonicalURL(bookmarks[0].URL),
+			Keep:         bookmarks[0],
+			Others:       bookmarks[1:],
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Keep.ID < result[j].Keep.ID
+	})
+
+	return result, nil
+}
+
+// MergeDuplicates adds the tags, notes and highlights of the other bookmarks to the kept
+// one, fills its empty excerpt, author and content from them, then deletes the other
+// bookmarks. It's done in one transaction. The kept bookmark gets the first archive and
+// thumbnail of the others when it has none. Returns the merged bookmark.
+func MergeDuplicates(ctx context.Context, db DB, dup Duplicates) (model.Bookmark, error) {
+	book := dup.Keep
+	tagNames := map[string]bool{}
+	for _, tag := range book.Tags {
+		tagNames[tag.Name] = true
+	}
+
+	ids := []int{}
+	for _, other := range dup.Others {
+		ids = append(ids, other.ID)
+
+		for _, tag := range other.Tags {
+			if !tagNames[tag.Name] {
+				tagNames[tag.Name] = true
+				book.Tags = append(book.Tags, model.Tag{Name: tag.Name})
+			}
+		}
+
+		if book.Excerpt == "" {
+			book.Excerpt = other.Excerpt
+		}
+		if book.Author == "" {
+			book.Author = other.Author
+		}
+		if book.Content == "" && book.HTML == "" {
+			book.Content, book.HTML = other.Content, other.HTML
+		}
+
+		// Notes are kept after each other, separated by an empty line
+		if other.Notes != "" && other.Notes != book.Notes {
+			if book.Notes != "" {
+				book.Notes += "\n\n"
+			}
+			book.Notes += other.Notes
+		}
+	}
+
+	// The files of other bookmarks are removed when they are deleted
+	if err := copyMissingBookmarkFiles(db.DataDir(), book.ID, ids...); err != nil {
+		return model.Bookmark{}, err
+	}
+
+	err := db.WithTx(ctx, func(tx DB) error {
+		// Move the highlights before their bookmarks are deleted,
+		// they keep their quote and context to be found in the kept content
+		for _, id := range ids {
+			highlights, err := tx.GetHighlights(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			for _, highlight := range highlights {
+				highlight.ID = 0
+				highlight.BookmarkID = book.ID
+				if _, err := tx.SaveHighlight(ctx, highlight); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Delete first, otherwise the kept bookmark can't be saved with the same canonical URL
+		if err := tx.DeleteBookmarks(ctx, ids...); err != nil {
+			return err
+		}
+
+		saved, err := tx.SaveBookmarks(ctx, false, book)
+		if err != nil {
+			return err
+		}
+
+		book = saved[0]
+		return nil
+	})
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+
+	return book, nil
+}
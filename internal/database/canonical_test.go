@@ -0,0 +1,33 @@
+package database
+
+import "testing"
+
+func TestCanonicalURL(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/a":                              "https://example.com/a",
+		"  http://WWW.Example.COM/a/  ":                      "https://example.com/a",
+		"https://example.com/":                               "https://example.com",
+		"https://example.com:443/a":                          "https://example.com/a",
+		"http://example.com:80/a":                            "https://example.com/a",
+		"https://example.com:8080/a":                         "https://example.com:8080/a",
+		"https://example.com/A/b//":                          "https://example.com/A/b",
+		"https://example.com/a?utm_source=x&UTM_Medium=y":    "https://example.com/a",
+		"https://example.com/a?b=2&a=1&fbclid=abc":           "https://example.com/a?a=1&b=2",
+		"https://example.com/a?q=go+lang&gclid=1":            "https://example.com/a?q=go+lang",
+		"https://example.com/a#section":                      "https://example.com/a",
+		"https://example.com/#!/page":                        "https://example.com#!/page",
+		"https://example.com/app#/users/1":                   "https://example.com/app#/users/1",
+		"https://user@example.com/a":                         "https://user@example.com/a",
+		"http://[::1]:80/a":                                  "https://[::1]/a",
+		"ftp://Files.Example.com:21/pub/":                    "ftp://files.example.com:21/pub",
+		"https://www.example.com/a%20b?utm_campaign=c&x=%2F": "https://example.com/a%20b?x=%2F",
+		"not a url":                  "not a url",
+		"mailto:someone@example.com": "mailto:someone@example.com",
+	}
+
+	for url, expected := range tests {
+		if canonical := CanonicalURL(url); canonical != expected {
+			t.Errorf("%q: expected %q, got %q", url, expected, canonical)
+		}
+	}
+}
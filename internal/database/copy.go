@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+// DefaultCopyBatchSize is the number of bookmarks that Copy reads and saves at once.
+const DefaultCopyBatchSize = 100
+
+// RecordCount is the number of records of each kind in a database.
+type RecordCount struct {
+	Accounts  int
+	Bookmarks int
+	Tags      int
+	// TagLinks is the number of tags of all bookmarks together.
+	TagLinks int
+	// Contents is the number of bookmarks with readable content.
+	Contents int
+	// SavedSearches is the number of saved searches of all accounts together.
+	SavedSearches int
+	// Notes is the number of bookmarks with notes.
+	Notes int
+	// Highlights is the number of highlights of all bookmarks together.
+	Highlights int
+}
+
+// CountRecords counts the records of the database, including the bookmarks in trash.
+func CountRecords(ctx context.Context, db DB) (RecordCount, error) {
+	count := RecordCount{}
+
+	accounts, err := db.GetAccounts(ctx, GetAccountsOptions{})
+	if err != nil {
+		return count, err
+	}
+	count.Accounts = len(accounts)
+
+	for _, account := range accounts {
+		searches, err := db.GetSavedSearches(ctx, account.ID)
+		if err != nil {
+			return count, err
+		}
+		count.SavedSearches += len(searches)
+	}
+
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil {
+		return count, err
+	}
+	count.Tags = len(tags)
+
+	err = eachBookmarkBatch(ctx, db, DefaultCopyBatchSize, false, func(batch []model.Bookmark) error {
+		for _, book := range batch {
+			count.Bookmarks++
+			count.TagLinks += len(book.Tags)
+			if book.HasContent {
+				count.Contents++
+			}
+			if book.Notes != "" {
+				count.Notes++
+			}
+
+			highlights, err := db.GetHighlights(ctx, book.ID)
+			if err != nil {
+				return err
+			}
+			count.Highlights += len(highlights)
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Copy copies accounts with their saved searches, bookmarks, their tags, readable
+// content, notes and highlights from src to dst, which must be empty. Bookmarks are
+// copied batchSize at a time, together with the tags they use. The IDs, modified time and trash time are kept, so the
+// bookmarks still belong to the same accounts, and the archives and thumbnails in the data dir to the same bookmarks.
+// Bookmark revisions are not copied.
+//
+// When everything is copied, the records of both databases are counted
+// and an error is returned if they are different.
+func Copy(ctx context.Context, src, dst DB, batchSize int) (RecordCount, error) {
+	if batchSize < 1 {
+		batchSize = DefaultCopyBatchSize
+	}
+
+	// Kept IDs would collide with existing records
+	dstCount, err := CountRecords(ctx, dst)
+	if err != nil {
+		return dstCount, err
+	}
+	if dstCount != (RecordCount{}) {
+		return dstCount, errors.New("target database is not empty")
+	}
+
+	// Copy accounts with their password hash
+	accounts, err := src.GetAccounts(ctx, GetAccountsOptions{})
+	if err != nil {
+		return dstCount, err
+	}
+
+	for _, account := range accounts {
+		account, exist, err := src.GetAccountWithPassword(ctx, account.Username)
+		if err != nil {
+			return dstCount, err
+		}
+		if !exist {
+			continue
+		}
+
+		saved, err := dst.SaveAccountWithHash(ctx, account)
+		if err != nil {
+			return dstCount, err
+		}
+
+		// Saved searches belong to the account in dst
+		searches, err := src.GetSavedSearches(ctx, account.ID)
+		if err != nil {
+			return dstCount, err
+		}
+
+		for _, search := range searches {
+			search.ID = 0
+			search.AccountID = saved.ID
+			if _, err := dst.SaveSavedSearch(ctx, search); err != nil {
+				return dstCount, err
+			}
+		}
+	}
+
+	// Copy bookmarks with their tags and content. Tags are saved by name,
+	// because their IDs in src mean nothing in dst.
+	err = eachBookmarkBatch(ctx, src, batchSize, true, func(batch []model.Bookmark) error {
+		for i := range batch {
+			for j := range batch[i].Tags {
+				batch[i].Tags[j].ID = 0
+			}
+		}
+
+		if _, err := dst.SaveBookmarks(ctx, true, batch...); err != nil {
+			return err
+		}
+
+		// Highlights belong to the same bookmark IDs in dst
+		for _, book := range batch {
+			highlights, err := src.GetHighlights(ctx, book.ID)
+			if err != nil {
+				return err
+			}
+
+			for _, highlight := range highlights {
+				highlight.ID = 0
+				if _, err := dst.SaveHighlight(ctx, highlight); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return dstCount, err
+	}
+
+	// Make sure nothing is missing
+	srcCount, err := CountRecords(ctx, src)
+	if err != nil {
+		return srcCount, err
+	}
+
+	dstCount, err = CountRecords(ctx, dst)
+	if err != nil {
+		return dstCount, err
+	}
+
+	if dstCount != srcCount {
+		return dstCount, errors.Errorf("copied records don't match: source has %+v, target has %+v", srcCount, dstCount)
+	}
+
+	return dstCount, nil
+}
+
+// eachBookmarkBatch calls fn with every bookmark of the database, including
+// the ones in trash, batchSize bookmarks at a time ordered by their ID.
+func eachBookmarkBatch(ctx context.Context, db DB, batchSize int, withContent bool, fn func(batch []model.Bookmark) error) error {
+	for _, trashed := range []bool{false, true} {
+		opts := GetBookmarksOptions{
+			OrderMethod: DefaultOrder,
+			Limit:       batchSize,
+			WithContent: withContent,
+			Trashed:     trashed,
+		}
+
+		for {
+			bookmarks, err := db.GetBookMarks(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			if len(bookmarks) > 0 {
+				if err := fn(bookmarks); err != nil {
+					return err
+				}
+			}
+
+			next, _, err := BookmarkCursors(opts, bookmarks)
+			if err != nil {
+				return err
+			}
+			if next == "" {
+				break
+			}
+			opts.Cursor = next
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.TODO()
+	src := sqliteTestDatabaseFactory(t)
+
+	account, err := src.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret", Owner: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = src.SaveSavedSearch(ctx, model.SavedSearch{AccountID: account.ID, Name: "go", Query: "tag:lang/go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := saveTestBookmarks(t, src,
+		model.Bookmark{
+			AccountID: account.ID,
+			URL:       "https://go.dev",
+			Title:     "go",
+			Content:   "build simple secure scalable systems",
+			HTML:      "<p>build simple secure scalable systems</p>",
+			Modified:  "2020-01-02 03:04:05",
+			Notes:     "*fast* builds",
+			Tags:      []model.Tag{{Name: "lang/go"}},
+
+			ReadingStatus:   model.StatusInProgress,
+			ReadingProgress: 30,
+		},
+		model.Bookmark{URL: "https://example.com", Title: "example"},
+		model.Bookmark{AccountID: account.ID, URL: "https://www.rust-lang.org", Title: "rust", Tags: []model.Tag{{Name: "lang/rust"}}},
+	)
+
+	_, err = src.SaveHighlight(ctx, model.Highlight{
+		BookmarkID:  saved[0].ID,
+		Created:     "2021-01-02 03:04:05",
+		Quote:       "simple",
+		Prefix:      "build ",
+		Suffix:      " secure",
+		StartOffset: 6,
+		EndOffset:   12,
+		Comment:     "really?",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave a gap in the IDs and put a bookmark in trash
+	if err := src.DeleteBookmarks(ctx, saved[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.TrashBookmarks(ctx, saved[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, dst := range map[string]DB{
+		"memory": memoryTestDatabaseFactory(t),
+		"sqlite": sqliteTestDatabaseFactory(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			count, err := Copy(ctx, src, dst, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := RecordCount{Accounts: 1, Bookmarks: 2, Tags: 3, TagLinks: 2, Contents: 1,
+				SavedSearches: 1, Notes: 1, Highlights: 1}
+			if count != expected {
+				t.Errorf("expected %+v, got %+v", expected, count)
+			}
+
+			books, err := dst.GetBookMarks(ctx, GetBookmarksOptions{WithContent: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(books) != 1 || books[0].ID != saved[0].ID || books[0].AccountID != account.ID || books[0].Modified != "2020-01-02 03:04:05" ||
+				books[0].HTML != saved[0].HTML || books[0].Notes != "*fast* builds" ||
+				books[0].ReadingStatus != model.StatusInProgress || books[0].ReadingProgress != 30 ||
+				len(books[0].Tags) != 1 || books[0].Tags[0].Name != "lang/go" {
+				t.Errorf("unexpected copied bookmarks %+v", books)
+			}
+
+			books, err = dst.GetBookMarks(ctx, GetBookmarksOptions{Trashed: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(books) != 1 || books[0].ID != saved[2].ID || books[0].DeletedAt == "" {
+				t.Errorf("unexpected copied trash %+v", books)
+			}
+
+			highlights, err := dst.GetHighlights(ctx, saved[0].ID)
+			if err != nil || len(highlights) != 1 || highlights[0].Quote != "simple" ||
+				highlights[0].Created != "2021-01-02 03:04:05" || highlights[0].Comment != "really?" {
+				t.Errorf("unexpected copied highlights %+v %v", highlights, err)
+			}
+
+			account, _, err := dst.GetAccountWithPassword(ctx, "shiori")
+			if err != nil || !account.Owner || bcrypt.CompareHashAndPassword([]byte(account.Password), []byte("secret")) != nil {
+				t.Errorf("unexpected copied account %+v %v", account, err)
+			}
+
+			searches, err := dst.GetSavedSearches(ctx, account.ID)
+			if err != nil || len(searches) != 1 || searches[0].Query != "tag:lang/go" {
+				t.Errorf("unexpected copied saved searches %+v %v", searches, err)
+			}
+
+			// Copying again would duplicate everything
+			if _, err := Copy(ctx, src, dst, 1); err == nil {
+				t.Error("expected error for target that isn't empty")
+			}
+		})
+	}
+}
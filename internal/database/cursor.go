@@ -0,0 +1,242 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when the cursor can't be decoded
+// or doesn't match the order method it's used with.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at a bookmark in the list sorted by an OrderMethod.
+// It's used for keyset pagination: the page fetched with a cursor starts
+// right after (or ends right before, when Backward) the pointed bookmark.
+// Relevance has no stable key, so its cursor holds the Offset of the page instead.
+type Cursor struct {
+	OrderMethod OrderMethod `json:"o"`
+	Key         string      `json:"k,omitempty"`
+	ID          int         `json:"i"`
+	Backward    bool        `json:"b,omitempty"`
+	Offset      int         `json:"n,omitempty"`
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses the cursor that was created by Cursor.Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	var cursor Cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+
+	return cursor, nil
+}
+
+// newCursor creates cursor that points at the bookmark.
+func newCursor(order OrderMethod, book model.Bookmark, backward bool) Cursor {
+	cursor := Cursor{
+		OrderMethod: order,
+		ID:          book.ID,
+		Backward:    backward,
+	}
+
+	switch order {
+	case ByLastModified:
+		cursor.Key = book.Modified
+	case ByTitle:
+		cursor.Key = book.Title
+	case ByURL:
+		cursor.Key = urlWithoutScheme(book.URL)
+	case ByUnread:
+		cursor.Key = statusRank(book.ReadingStatus)
+	}
+
+	return cursor
+}
+
+// BookmarkCursors returns the cursors to the next and previous page of bookmarks
+// that were fetched using opts. The cursor is empty when there is no page in
+// that direction.
+func BookmarkCursors(opts GetBookmarksOptions, bookmarks []model.Bookmark) (next, prev string, err error) {
+	if len(bookmarks) == 0 {
+		return "", "", nil
+	}
+
+	var cursor *Cursor
+	if opts.Cursor != "" {
+		c, err := DecodeCursor(opts.Cursor)
+		if err != nil {
+			return "", "", err
+		}
+		cursor = &c
+	}
+
+	if opts.OrderMethod == ByRelevance && len(opts.keywords()) > 0 {
+		next, prev = relevanceCursors(opts, cursor, len(bookmarks))
+		return next, prev, nil
+	}
+
+	first := bookmarks[0]
+	last := bookmarks[len(bookmarks)-1]
+	fullPage := opts.Limit > 0 && len(bookmarks) >= opts.Limit
+
+	switch {
+	case cursor == nil:
+		if fullPage {
+			next = newCursor(opts.OrderMethod, last, false).Encode()
+		}
+	case cursor.Backward:
+		next = newCursor(opts.OrderMethod, last, false).Encode()
+		if fullPage {
+			prev = newCursor(opts.OrderMethod, first, true).Encode()
+		}
+	default:
+		prev = newCursor(opts.OrderMethod, first, true).Encode()
+		if fullPage {
+			next = newCursor(opts.OrderMethod, last, false).Encode()
+		}
+	}
+
+	return next, prev, nil
+}
+
+// relevanceCursors returns the cursors around the page of count bookmarks ordered
+// by relevance, which point at the offset of the next and previous page.
+func relevanceCursors(opts GetBookmarksOptions, cursor *Cursor, count int) (next, prev string) {
+	offset := 0
+	if cursor != nil {
+		offset = cursor.Offset
+	}
+
+	if opts.Limit > 0 && count >= opts.Limit {
+		next = Cursor{OrderMethod: ByRelevance, Offset: offset + count}.Encode()
+	}
+
+	if offset > 0 {
+		prevOffset := offset - opts.Limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		prev = Cursor{OrderMethod: ByRelevance, Offset: prevOffset}.Encode()
+	}
+
+	return next, prev
+}
+
+// orderSpec describes how bookmarks are sorted by an OrderMethod:
+// by the key expression first, then by the bookmark ID.
+type orderSpec struct {
+	// key is the SQL expression of the sort key, empty when sorted by ID only.
+	key string
+	// keyParam is the SQL expression that compares the cursor's key with key.
+	// Default is "?".
+	keyParam string
+	desc     bool
+}
+
+// orderBy returns the order clause. When backward, the order is reversed
+// so the rows right before the cursor are fetched first.
+func (o orderSpec) orderBy(backward bool) string {
+	direction := "ASC"
+	if o.desc != backward {
+		direction = "DESC"
+	}
+
+	if o.key == "" {
+		return ` ORDER BY b.id ` + direction
+	}
+
+	return ` ORDER BY ` + o.key + ` ` + direction + `, b.id ` + direction
+}
+
+// where returns the where clause that selects the rows after the cursor,
+// or before it when the cursor is backward.
+func (o orderSpec) where(cursor Cursor) (string, []interface{}) {
+	op := ">"
+	if o.desc != cursor.Backward {
+		op = "<"
+	}
+
+	if o.key == "" {
+		return ` AND b.id ` + op + ` ?`, []interface{}{cursor.ID}
+	}
+
+	keyParam := o.keyParam
+	if keyParam == "" {
+		keyParam = "?"
+	}
+
+	clause := fmt.Sprintf(` AND (%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND b.id %[2]s ?))`,
+		o.key, op, keyParam)
+	return clause, []interface{}{cursor.Key, cursor.Key, cursor.ID}
+}
+
+// orderAndCursor returns the order spec for opts and the decoded cursor, if any.
+// Ordering by relevance has no stable key, so its cursor is turned into
+// the Offset of opts and no cursor is returned.
+func orderAndCursor(specs map[OrderMethod]orderSpec, opts *GetBookmarksOptions) (orderSpec, *Cursor, error) {
+	order := opts.OrderMethod
+	if order == ByRelevance && len(opts.keywords()) == 0 {
+		order = ByLastAdded
+	}
+
+	spec, ok := specs[order]
+	if !ok && order != ByRelevance {
+		return spec, nil, errors.Errorf("unknown order method %d", opts.OrderMethod)
+	}
+
+	if opts.Cursor == "" {
+		return spec, nil, nil
+	}
+
+	cursor, err := DecodeCursor(opts.Cursor)
+	if err != nil {
+		return spec, nil, err
+	}
+
+	if cursor.OrderMethod != opts.OrderMethod {
+		return spec, nil, errors.Wrap(ErrInvalidCursor, "cursor is for another order method")
+	}
+
+	if order == ByRelevance {
+		if cursor.Offset < 0 {
+			return spec, nil, errors.Wrap(ErrInvalidCursor, "negative offset")
+		}
+		opts.Offset = cursor.Offset
+		return spec, nil, nil
+	}
+
+	return spec, &cursor, nil
+}
+
+// reverseBookmarks reverses the bookmarks in place. It's used to restore
+// the order of bookmarks fetched with a backward cursor.
+func reverseBookmarks(bookmarks []model.Bookmark) {
+	for i, j := 0, len(bookmarks)-1; i < j; i, j = i+1, j-1 {
+		bookmarks[i], bookmarks[j] = bookmarks[j], bookmarks[i]
+	}
+}
+
+// urlWithoutScheme returns the URL after its scheme, the same as the URL key
+// of ByURL order in SQL. URL without scheme is returned as it is.
+func urlWithoutScheme(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		return url[i+3:]
+	}
+	return url
+}
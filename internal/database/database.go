@@ -2,14 +2,50 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"embed"
 	"github.com/jmoiron/sqlx"
 	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the record that should be changed doesn't exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists is returned when a record violates an unique constraint,
+	// e.g. saving a bookmark whose URL is already stored.
+	ErrAlreadyExists = errors.New("already exists")
 )
 
 // OrderMethod is the order method for getting bookmarks
 type OrderMethod int
 
+// Order methods
+const (
+	// DefaultOrder orders bookmarks by their ID.
+	DefaultOrder OrderMethod = iota
+	// ByLastAdded orders the newest bookmarks first.
+	ByLastAdded
+	// ByLastModified orders the recently modified bookmarks first.
+	ByLastModified
+	// ByTitle orders bookmarks alphabetically by their title.
+	ByTitle
+	// ByURL orders bookmarks by their URL without scheme,
+	// which groups them by domain.
+	ByURL
+	// ByRelevance orders bookmarks by how well they match the keyword.
+	// Without keyword it's the same as ByLastAdded.
+	ByRelevance
+	// ByUnread orders the oldest unread bookmarks first, followed by
+	// the ones in progress and the read ones, like a read-later queue.
+	ByUnread
+)
+
+// GetBookmarksOptions is options for fetching bookmarks from database.
 type GetBookmarksOptions struct {
 	IDs          []int
 	Tags         []string
@@ -19,6 +55,44 @@ type GetBookmarksOptions struct {
 	OrderMethod  OrderMethod
 	Limit        int
 	Offset       int
+
+	// Trashed fetches the bookmarks in trash instead of the normal ones.
+	Trashed bool
+
+	// AccountID fetches only the bookmarks of the account.
+	// Zero fetches the bookmarks of every account, e.g. for owners.
+	AccountID int
+
+	// ReadingStatus fetches the bookmarks with any of the reading status,
+	// e.g. model.StatusUnread. Empty means all of them.
+	ReadingStatus []string
+
+	// Cursor is the opaque cursor returned by BookmarkCursors.
+	// When it's set, Offset is ignored.
+	Cursor string
+
+	// Search is the parsed search query, see ParseSearch.
+	// Bookmarks must match both the search and the other options.
+	Search SearchQuery
+
+	// ArchiveIDs is the IDs of bookmarks that have an archive,
+	// it's only used by has:archive of Search. See ArchiveIDs.
+	ArchiveIDs []int
+
+	// WithoutAnnotations matches and ranks the keywords of Keyword and Search
+	// without the notes and highlights, which only the account of bookmark
+	// should see, e.g. for public bookmarks.
+	WithoutAnnotations bool
+}
+
+// keywords returns the keywords that bookmarks are ranked by when ordered by relevance.
+func (opts GetBookmarksOptions) keywords() []string {
+	keywords := opts.Search.Keywords()
+	if opts.Keyword != "" {
+		keywords = append([]string{opts.Keyword}, keywords...)
+	}
+
+	return keywords
 }
 
 // GetAccountsOptions is potions for fetching accounts form database.
@@ -32,18 +106,492 @@ type DB interface {
 	// Migrate runs migrations for this database
 	Migrate() error
 
-	// SaveBookmarks saves bookmarks data to database
+	// MigrateSteps applies the next n migrations, or reverts
+	// the last -n migrations when n is negative.
+	MigrateSteps(n int) error
+
+	// MigrateTo migrates the schema up or down to the version.
+	// Version 0 reverts every migration.
+	MigrateTo(version uint) error
+
+	// MigrationStatus reports the schema version and the available migrations.
+	MigrationStatus() (MigrationStatus, error)
+
+	// SaveBookmarks saves bookmarks data to database.
+	// New bookmarks keep their ID and DeletedAt when they are set,
+	// e.g. when they are copied from another database.
 	SaveBookmarks(ctx context.Context, create bool, bookmarks ...model.Bookmark) ([]model.Bookmark, error)
 
 	GetBookMarks(ctx context.Context, opts GetBookmarksOptions) ([]model.Bookmark, error)
 
+	// GetBookmarksCount returns the number of bookmarks that match opts.
+	// Limit, offset, cursor and order are ignored.
+	GetBookmarksCount(ctx context.Context, opts GetBookmarksOptions) (int, error)
+
+	// GetDuplicateIDs returns the IDs of bookmarks that have the same canonical URL
+	// as other bookmarks of their account, including the ones in trash. Each group
+	// of the same page is ordered by ID, and groups are ordered by their first ID.
+	GetDuplicateIDs(ctx context.Context) ([][]int, error)
+
+	// DeleteBookmarks removes all record with matching ids from database,
+	// together with their archive and thumbnail in the data dir, see SetDataDir.
+	// Without ids all bookmarks are removed.
+	DeleteBookmarks(ctx context.Context, ids ...int) error
+
+	// TrashBookmarks moves bookmarks with matching ids to trash.
+	// Without ids all bookmarks are moved.
+	TrashBookmarks(ctx context.Context, ids ...int) error
+
+	// RestoreBookmarks restores bookmarks with matching ids from trash.
+	// Without ids all bookmarks in trash are restored.
+	RestoreBookmarks(ctx context.Context, ids ...int) error
+
+	// PurgeBookmarks permanently removes the bookmarks that were moved to trash
+	// before olderThan. Returns the ids of removed bookmarks.
+	PurgeBookmarks(ctx context.Context, olderThan time.Time) ([]int, error)
+
+	// GetBookmarkRevisions fetch the revisions of a bookmark, newest first.
+	// The content and html of the revisions aren't loaded.
+	GetBookmarkRevisions(ctx context.Context, bookmarkID int) ([]model.BookmarkRevision, error)
+
+	// GetBookmarkRevision fetch a revision including its content.
+	GetBookmarkRevision(ctx context.Context, id int) (model.BookmarkRevision, error)
+
+	// RollbackBookmark restores the bookmark to the state of the revision.
+	// The replaced state is recorded as a new revision.
+	RollbackBookmark(ctx context.Context, revisionID int) (model.Bookmark, error)
+
+	// SaveBookmarkNotes replaces the Markdown notes of bookmark. Unlike SaveBookmarks,
+	// no revision is recorded and the modified time is kept.
+	SaveBookmarkNotes(ctx context.Context, bookmarkID int, notes string) error
+
+	// GetHighlights fetch the highlights of bookmark, ordered by their position in the content.
+	GetHighlights(ctx context.Context, bookmarkID int) ([]model.Highlight, error)
+
+	// GetHighlight fetch a single highlight with matching ID.
+	GetHighlight(ctx context.Context, id int) (model.Highlight, error)
+
+	// SaveHighlight creates new highlight of the bookmark, or updates the one with
+	// matching ID. The bookmark of existing highlight isn't changed.
+	SaveHighlight(ctx context.Context, highlight model.Highlight) (model.Highlight, error)
+
+	// DeleteHighlights removes the highlights with matching IDs.
+	DeleteHighlights(ctx context.Context, ids ...int) error
+
+	// SaveReadingState updates the reading status and progress of bookmark. Like
+	// SaveBookmarkNotes, no revision is recorded and the modified time is kept.
+	SaveReadingState(ctx context.Context, bookmarkID int, status string, progress int) error
+
+	// WithTx runs fn with a database whose changes are made in one transaction.
+	// The changes are committed when fn returns nil, and rolled back when it
+	// returns an error. Calling WithTx inside of fn joins the same transaction.
+	// The database must not be used outside of fn meanwhile.
+	WithTx(ctx context.Context, fn func(tx DB) error) error
+
+	// SetRevisionLimit sets how many revisions are kept for each bookmark.
+	// Zero disables the revision history, DefaultRevisionLimit is used by default.
+	SetRevisionLimit(limit int)
+
+	// SetDataDir sets the data dir that has the archives and thumbnails of bookmarks,
+	// they are removed when their bookmarks are removed. Inside WithTx they are
+	// removed once the transaction is committed. Without data dir, files are kept.
+	SetDataDir(dir string)
+
+	// DataDir returns the data dir set by SetDataDir.
+	DataDir() string
+
+	// GetTags fetch list of tags of the account and the number of their bookmarks.
+	// Account 0 fetches the tags of every account.
+	// Nested tags are linked to their parent by ParentID, see TagTree.
+	GetTags(ctx context.Context, accountID int) ([]model.Tag, error)
+
+	// RenameTag changes the name of a tag, its descendants are moved along.
+	// When its account already has a tag with the new name, both tags are merged.
+	// Returns the renamed or merged tag.
+	RenameTag(ctx context.Context, id int, newName string) (model.Tag, error)
+
+	// GetAccount fetch account with matching username, without its password.
 	GetAccount(ctx context.Context, username string) (model.Account, bool, error)
 
+	// GetAccountWithPassword fetch account with matching username,
+	// including its password hash.
+	GetAccountWithPassword(ctx context.Context, username string) (model.Account, bool, error)
+
+	// GetAccounts fetch list of account (without its password) based on submitted options.
 	GetAccounts(ctx context.Context, opts GetAccountsOptions) ([]model.Account, error)
+
+	// SaveAccount creates new account. The password is hashed with bcrypt.
+	SaveAccount(ctx context.Context, account model.Account) (model.Account, error)
+
+	// SaveAccountWithHash creates new account whose password is already hashed,
+	// e.g. when it's copied from another database. The ID is kept when it's set.
+	SaveAccountWithHash(ctx context.Context, account model.Account) (model.Account, error)
+
+	// UpdateAccount updates the account with matching ID.
+	// The password is only changed when it's not empty.
+	UpdateAccount(ctx context.Context, account model.Account) error
+
+	// DeleteAccounts removes the accounts with matching usernames, together
+	// with their bookmarks, tags and saved searches.
+	DeleteAccounts(ctx context.Context, usernames ...string) error
+
+	// GetSavedSearches fetch the saved searches of the account, ordered by name.
+	GetSavedSearches(ctx context.Context, accountID int) ([]model.SavedSearch, error)
+
+	// GetSavedSearch fetch the saved search with matching ID that belongs to the account.
+	GetSavedSearch(ctx context.Context, accountID, id int) (model.SavedSearch, bool, error)
+
+	// SaveSavedSearch creates new saved search, or updates the one with matching ID
+	// that belongs to the same account. The query must be valid for ParseSearch.
+	// Names are unique for each account.
+	SaveSavedSearch(ctx context.Context, search model.SavedSearch) (model.SavedSearch, error)
+
+	// DeleteSavedSearches removes the saved searches of the account with matching IDs.
+	DeleteSavedSearches(ctx context.Context, accountID int, ids ...int) error
+}
+
+// bookmarksFilterClause returns where clause for the bookmarks that match opts,
+// except for the cursor which depends on the order.
+func bookmarksFilterClause(opts GetBookmarksOptions, dialect searchDialect) (string, []interface{}) {
+	query := ""
+	args := []interface{}{}
+
+	// Add where clause for trash
+	if opts.Trashed {
+		query += ` AND b.deleted_at IS NOT NULL`
+	} else {
+		query += ` AND b.deleted_at IS NULL`
+	}
+
+	// Add where clause for account
+	if opts.AccountID != 0 {
+		query += ` AND b.account_id = ?`
+		args = append(args, opts.AccountID)
+	}
+
+	// Add where clause for IDs
+	if len(opts.IDs) > 0 {
+		query += ` AND b.id IN (?)`
+		args = append(args, opts.IDs)
+	}
+
+	// Add where clause for reading status
+	if len(opts.ReadingStatus) > 0 {
+		query += ` AND b.reading_status IN (?)`
+		args = append(args, opts.ReadingStatus)
+	}
+
+	// Add where clause for search keyword
+	if opts.Keyword != "" {
+		keywordQuery, keywordArgs := dialect.keyword(opts.Keyword, !opts.WithoutAnnotations)
+		query += ` AND (` + keywordQuery + `)`
+		args = append(args, keywordArgs...)
+	}
+
+	// Add where clause for search query
+	searchQuery, searchArgs := searchClause(opts.Search, opts.ArchiveIDs, !opts.WithoutAnnotations, dialect)
+	query += searchQuery
+	args = append(args, searchArgs...)
+
+	// Add where clause for tags.
+	// First we check for * in excluded and included tags,
+	// which means all tags will be excluded and included, respectively.
+	tags, includeAllTags := normalizeTagFilter(opts.Tags)
+	excludedTags, excludeAllTags := normalizeTagFilter(opts.ExcludedTags)
+
+	// If all tags excluded, we will only show bookmark without tags.
+	// In other hand, if all tags included, we will only show bookmark with tags.
+	if excludeAllTags {
+		query += ` AND b.id NOT IN (SELECT DISTINCT bookmark_id FROM bookmark_tag)`
+	} else if includeAllTags {
+		query += ` AND b.id IN (SELECT DISTINCT bookmark_id FROM bookmark_tag)`
+	}
+
+	// Now we only need to find the normal tags, including their descendants
+	tagQuery, tagArgs := tagFilterClause(tags, excludedTags)
+	query += tagQuery
+	args = append(args, tagArgs...)
+
+	return query, args
+}
+
+// normalizeTagFilter lower cases the tag names used for filtering bookmarks,
+// the same way tags are saved. It also reports whether the names contain "*",
+// which means all tags are matched.
+func normalizeTagFilter(names []string) ([]string, bool) {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = normalizeTagName(name)
+		switch name {
+		case "":
+			continue
+		case "*":
+			return nil, true
+		}
+		result = append(result, name)
+	}
+
+	return result, false
+}
+
+// deleteBookmarks removes bookmarks with matching ids, or all of them when
+// there are no ids, along with their tag links and revisions. The tags that
+// are no longer used by any bookmark are removed as well. contentQueries
+// remove the content stored outside of the bookmark table, "?" in them is
+// expanded into the ids. Returns the IDs of removed bookmarks.
+func deleteBookmarks(ctx context.Context, tx *sqlx.Tx, ids []int, contentQueries ...string) ([]int, error) {
+	// The IDs are returned, so the files of all bookmarks can be removed as well
+	deletedIDs := ids
+	if len(ids) == 0 {
+		if err := tx.SelectContext(ctx, &deletedIDs, `SELECT id FROM bookmark`); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	queries := append(contentQueries,
+		`DELETE FROM bookmark_tag WHERE bookmark_id IN (?)`,
+		`DELETE FROM bookmark_revision WHERE bookmark_id IN (?)`,
+		`DELETE FROM highlight WHERE bookmark_id IN (?)`,
+		`DELETE FROM bookmark WHERE id IN (?)`)
+
+	for _, query := range queries {
+		var args []interface{}
+		if len(ids) == 0 {
+			// Remove the where clause
+			query = query[:strings.Index(query, " WHERE ")]
+		} else {
+			var err error
+			query, args, err = sqlx.In(query, ids)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return deletedIDs, removeUnusedTags(ctx, tx)
+}
+
+// setBookmarksDeletedAt moves bookmarks to trash by setting their deleted_at,
+// or restores them from trash when deletedAt is nil.
+// Without ids it's applied to all bookmarks.
+func setBookmarksDeletedAt(ctx context.Context, db sqlx.ExtContext, ids []int, deletedAt interface{}) error {
+	query := `UPDATE bookmark SET deleted_at = ? WHERE deleted_at IS NULL`
+	if deletedAt == nil {
+		query = `UPDATE bookmark SET deleted_at = NULL WHERE deleted_at IS NOT NULL`
+	}
+
+	args := []interface{}{}
+	if deletedAt != nil {
+		args = append(args, deletedAt)
+	}
+
+	if len(ids) > 0 {
+		query += ` AND id IN (?)`
+		args = append(args, ids)
+	}
+
+	query, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = db.ExecContext(ctx, db.Rebind(query), args...)
+	return errors.WithStack(err)
+}
+
+// purgeBookmarks permanently removes bookmarks that were moved to trash
+// before olderThan. contentQueries are passed to deleteBookmarks.
+func purgeBookmarks(ctx context.Context, tx *sqlx.Tx, olderThan time.Time, contentQueries ...string) ([]int, error) {
+	ids := []int{}
+	err := tx.SelectContext(ctx, &ids, tx.Rebind(`SELECT id FROM bookmark
+		WHERE deleted_at IS NOT NULL AND deleted_at < ?`),
+		olderThan.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	// Without ids deleteBookmarks removes everything
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	return deleteBookmarks(ctx, tx, ids, contentQueries...)
+}
+
+// deleteAccountBookmarks removes the bookmarks of the accounts with matching
+// usernames, along with everything deleteBookmarks removes, so nothing is left
+// behind for the next account. contentQueries are passed to deleteBookmarks.
+// Returns the IDs of removed bookmarks.
+func deleteAccountBookmarks(ctx context.Context, tx *sqlx.Tx, usernames []string, contentQueries ...string) ([]int, error) {
+	query, args, err := sqlx.In(`SELECT id FROM bookmark
+		WHERE account_id IN (SELECT id FROM account WHERE username IN (?))`, usernames)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ids := []int{}
+	if err := tx.SelectContext(ctx, &ids, tx.Rebind(query), args...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Without ids deleteBookmarks removes everything, the unused tags of the
+	// accounts are still removed
+	if len(ids) == 0 {
+		return ids, removeUnusedTags(ctx, tx)
+	}
+
+	return deleteBookmarks(ctx, tx, ids, contentQueries...)
+}
+
+// hashPassword hashes the account password with bcrypt.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return string(hash), nil
 }
 
 type dbbase struct {
 	sqlx.DB
+	revisionLimit int
+	dataDir       string
+
+	// tx is the transaction of WithTx. When it's set, every query runs
+	// inside of it, see the query methods below.
+	tx *sqlx.Tx
+
+	// deletedIDs is the bookmarks deleted inside WithTx,
+	// their files are removed once the transaction is committed.
+	deletedIDs *[]int
+}
+
+// inTx returns the copy of database whose queries run inside tx.
+func (db *dbbase) inTx(tx *sqlx.Tx) dbbase {
+	return dbbase{DB: db.DB, revisionLimit: db.revisionLimit, dataDir: db.dataDir, tx: tx, deletedIDs: db.deletedIDs}
+}
+
+// SetRevisionLimit sets how many revisions are kept for each bookmark.
+func (db *dbbase) SetRevisionLimit(limit int) {
+	db.revisionLimit = limit
+}
+
+// SetDataDir sets the data dir that has the archives and thumbnails of bookmarks.
+func (db *dbbase) SetDataDir(dir string) {
+	db.dataDir = dir
+}
+
+// DataDir returns the data dir set by SetDataDir.
+func (db *dbbase) DataDir() string {
+	return db.dataDir
+}
+
+// runTx runs fn with the copy of database inside a transaction for WithTx of
+// the engines. The files of bookmarks deleted in fn are removed after commit.
+func (db *dbbase) runTx(ctx context.Context, fn func(tx dbbase) error) error {
+	if db.tx != nil {
+		return fn(db.inTx(db.tx))
+	}
+
+	deletedIDs := []int{}
+	err := db.withTx(ctx, func(tx *sqlx.Tx) error {
+		txDB := db.inTx(tx)
+		txDB.deletedIDs = &deletedIDs
+		return fn(txDB)
+	})
+	if err != nil {
+		return err
+	}
+
+	return removeBookmarkFiles(db.dataDir, deletedIDs...)
+}
+
+// deleteBookmarkFiles removes the files of deleted bookmarks,
+// or leaves them to runTx inside WithTx.
+func (db *dbbase) deleteBookmarkFiles(ids []int) error {
+	if db.deletedIDs != nil {
+		*db.deletedIDs = append(*db.deletedIDs, ids...)
+		return nil
+	}
+
+	return removeBookmarkFiles(db.dataDir, ids...)
+}
+
+// withTx runs fn inside a transaction. The transaction is rolled back
+// when fn returns an error, otherwise it's committed. Inside WithTx,
+// fn joins the transaction of WithTx instead.
+func (db *dbbase) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if db.tx != nil {
+		return fn(db.tx)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return errors.WithStack(tx.Commit())
+}
+
+// The query methods of sqlx.DB are replaced by the ones below, so both
+// the queries of the database engines and the sqlx functions that receive
+// the database run inside the transaction of WithTx when there is one.
+
+func (db *dbbase) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.ExecContext(ctx, query, args...)
+	}
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *dbbase) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryContext(ctx, query, args...)
+	}
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *dbbase) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryxContext(ctx, query, args...)
+	}
+	return db.DB.QueryxContext(ctx, query, args...)
+}
+
+func (db *dbbase) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowContext(ctx, query, args...)
+	}
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *dbbase) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowxContext(ctx, query, args...)
+	}
+	return db.DB.QueryRowxContext(ctx, query, args...)
+}
+
+func (db *dbbase) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return sqlx.GetContext(ctx, db, dest, query, args...)
+}
+
+func (db *dbbase) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return sqlx.SelectContext(ctx, db, dest, query, args...)
 }
 
 //go:embed migrations/*
@@ -0,0 +1,2315 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testDatabaseFactory returns a fresh and migrated database for a single test.
+type testDatabaseFactory func(t *testing.T) DB
+
+// testDatabase runs the behavioral tests that every database engine must pass.
+// Each engine runs it from its own Test function with a factory of that engine,
+// the engines that need a server skip it when the server isn't configured.
+func testDatabase(t *testing.T, dbFactory testDatabaseFactory) {
+	tests := map[string]func(t *testing.T, db DB){
+		"testMigrations":          testMigrations,
+		"testSaveBookmark":        testSaveBookmark,
+		"testSaveBookmarkTags":    testSaveBookmarkTags,
+		"testSaveDuplicateURL":    testSaveDuplicateURL,
+		"testSaveSamePage":        testSaveSamePage,
+		"testDedupe":              testDedupe,
+		"testDedupeAnnotations":   testDedupeAnnotations,
+		"testUpdateMissing":       testUpdateMissing,
+		"testSaveWithID":          testSaveWithID,
+		"testTagUpsert":           testTagUpsert,
+		"testGetBookmarksFilters": testGetBookmarksFilters,
+		"testGetBookmarksKeyword": testGetBookmarksKeyword,
+		"testGetBookmarksOrder":   testGetBookmarksOrder,
+		"testGetBookmarksPages":   testGetBookmarksPages,
+		"testGetBookmarksCursor":  testGetBookmarksCursor,
+		"testDeleteBookmarks":     testDeleteBookmarks,
+		"testDeleteBookmarkFiles": testDeleteBookmarkFiles,
+		"testTrash":               testTrash,
+		"testTags":                testTags,
+		"testNestedTags":          testNestedTags,
+		"testRevisions":           testRevisions,
+		"testAccounts":            testAccounts,
+		"testWithTx":              testWithTx,
+		"testSearch":              testSearch,
+		"testBookmarksCount":      testBookmarksCount,
+		"testSavedSearches":       testSavedSearches,
+		"testNotes":               testNotes,
+		"testHighlights":          testHighlights,
+		"testReadingState":        testReadingState,
+		"testAccountLibraries":    testAccountLibraries,
+		"testDeleteAccountData":   testDeleteAccountData,
+		"testRevertAccounts":      testRevertAccounts,
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test(t, dbFactory(t))
+		})
+	}
+}
+
+func saveTestBookmarks(t *testing.T, db DB, bookmarks ...model.Bookmark) []model.Bookmark {
+	t.Helper()
+
+	result, err := db.SaveBookmarks(context.TODO(), true, bookmarks...)
+	if err != nil {
+		t.Fatalf("failed to save bookmarks: %v", err)
+	}
+
+	return result
+}
+
+func bookmarkIDs(bookmarks []model.Bookmark) []int {
+	ids := []int{}
+	for _, book := range bookmarks {
+		ids = append(ids, book.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func tagNames(tags []model.Tag) []string {
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func testMigrations(t *testing.T, db DB) {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In-memory database has no schema to migrate
+	if len(status.Migrations) == 0 {
+		t.Skip("database has no migrations")
+	}
+
+	last := status.Migrations[len(status.Migrations)-1].Version
+	if status.Version != last || status.Dirty || status.Pending() != 0 {
+		t.Fatalf("unexpected status after migrate %+v", status)
+	}
+
+	// Revert the last migration, then apply it again
+	if err := db.MigrateSteps(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = db.MigrationStatus()
+	if err != nil || status.Version != last-1 || status.Pending() != 1 {
+		t.Fatalf("unexpected status after down %+v %v", status, err)
+	}
+
+	if err := db.MigrateSteps(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Revert everything and migrate up to the version before last
+	if err := db.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = db.MigrationStatus()
+	if err != nil || status.Version != 0 || status.Pending() != len(status.Migrations) {
+		t.Fatalf("unexpected status after reverting all %+v %v", status, err)
+	}
+
+	if err := db.MigrateTo(last - 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.MigrateTo(last + 1); err == nil {
+		t.Error("expected error for unknown version")
+	}
+
+	if err := db.MigrateSteps(2); err == nil {
+		t.Error("expected error when there are fewer migrations than steps")
+	}
+
+	// The database works normally after moving around
+	status, err = db.MigrationStatus()
+	if err != nil || status.Version != last {
+		t.Fatalf("unexpected status after up %+v %v", status, err)
+	}
+
+	saveTestBookmarks(t, db, model.Bookmark{URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "lang/go"}}})
+}
+
+func testSaveBookmark(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saved := saveTestBookmarks(t, db, model.Bookmark{
+		URL:     "https://github.com/go-shiori/shiori",
+		Title:   "shiori",
+		Content: "simple bookmark manager",
+		HTML:    "<p>simple bookmark manager</p>",
+	})
+	if saved[0].ID == 0 {
+		t.Fatal("saved bookmark has no ID")
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{saved[0].ID}, WithContent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 {
+		t.Fatalf("expected 1 bookmark, got %d", len(books))
+	}
+	if books[0].Title != "shiori" || !books[0].HasContent ||
+		books[0].Content != "simple bookmark manager" || books[0].HTML != "<p>simple bookmark manager</p>" {
+		t.Errorf("unexpected bookmark %+v", books[0])
+	}
+
+	// Content is only fetched when requested
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{saved[0].ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if books[0].Content != "" || books[0].HTML != "" {
+		t.Errorf("content fetched without WithContent: %+v", books[0])
+	}
+}
+
+func testSaveBookmarkTags(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saved := saveTestBookmarks(t, db, model.Bookmark{
+		URL:   "https://github.com/go-shiori/shiori",
+		Title: "shiori",
+		Tags:  []model.Tag{{Name: "Go"}, {Name: "bookmark"}},
+	})
+	other := saveTestBookmarks(t, db, model.Bookmark{
+		URL:   "https://go.dev",
+		Title: "go",
+		Tags:  []model.Tag{{Name: "go"}},
+	})
+
+	// Existing tag is reused
+	if saved[0].Tags[0].ID != other[0].Tags[0].ID {
+		t.Errorf("tag go saved twice: %+v %+v", saved[0].Tags, other[0].Tags)
+	}
+
+	// Remove the deleted tag
+	book := saved[0]
+	book.Tags[0].Deleted = true
+	book.Title = "shiori bookmark manager"
+	if _, err := db.SaveBookmarks(ctx, false, book); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{book.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if books[0].Title != "shiori bookmark manager" {
+		t.Errorf("title not updated: %q", books[0].Title)
+	}
+	if len(books[0].Tags) != 1 || books[0].Tags[0].Name != "bookmark" {
+		t.Errorf("unexpected tags %+v", books[0].Tags)
+	}
+}
+
+func testSaveDuplicateURL(t *testing.T, db DB) {
+	book := model.Bookmark{URL: "https://github.com/go-shiori/shiori", Title: "shiori"}
+	saveTestBookmarks(t, db, book)
+
+	_, err := db.SaveBookmarks(context.TODO(), true, book)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	// Updating to the URL of another bookmark fails as well
+	other := saveTestBookmarks(t, db, model.Bookmark{URL: "https://go.dev", Title: "go"})[0]
+	other.URL = book.URL
+	_, err = db.SaveBookmarks(context.TODO(), false, other)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists on update, got %v", err)
+	}
+
+	// Nothing in the batch is saved when one of them fails
+	_, err = db.SaveBookmarks(context.TODO(), true,
+		model.Bookmark{URL: "https://example.com", Title: "example"},
+		model.Bookmark{URL: "https://example.com", Title: "example again"},
+	)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists in batch, got %v", err)
+	}
+
+	books, err := db.GetBookMarks(context.TODO(), GetBookmarksOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books[1].URL != "https://go.dev" {
+		t.Errorf("unexpected bookmarks after failed saves %+v", books)
+	}
+}
+
+func testSaveSamePage(t *testing.T, db DB) {
+	ctx := context.TODO()
+	book := saveTestBookmarks(t, db, model.Bookmark{URL: "https://www.example.com/a/?b=2&a=1", Title: "example"})[0]
+
+	// Another URL of the same page
+	_, err := db.SaveBookmarks(ctx, true, model.Bookmark{
+		URL:   "http://example.com:80/a?a=1&b=2&utm_source=feed#top",
+		Title: "example again",
+	})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	other := saveTestBookmarks(t, db, model.Bookmark{URL: "https://example.com/b", Title: "other"})[0]
+	other.URL = "https://EXAMPLE.com/a?a=1&b=2"
+	_, err = db.SaveBookmarks(ctx, false, other)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists on update, got %v", err)
+	}
+
+	// The bookmark itself can be saved with another URL of its page
+	book.URL = "https://example.com/a?b=2&a=1"
+	if _, err := db.SaveBookmarks(ctx, false, book); err != nil {
+		t.Errorf("failed to update URL of the same page: %v", err)
+	}
+
+	// Different query is a different page
+	saveTestBookmarks(t, db, model.Bookmark{URL: "https://example.com/a?a=2", Title: "page 2"})
+}
+
+// setBookmarkURL changes the URL of bookmark without checking its canonical URL,
+// like the duplicates that were saved before canonical URLs are checked.
+func setBookmarkURL(t *testing.T, db DB, id int, url string) {
+	t.Helper()
+
+	switch db := db.(type) {
+	case *MemoryDatabase:
+		db.mu.Lock()
+		book := db.data.bookmarks[id]
+		book.URL = url
+		db.data.bookmarks[id] = book
+		db.mu.Unlock()
+	case sqlx.ExtContext:
+		_, err := db.ExecContext(context.TODO(), db.Rebind(`UPDATE bookmark
+			SET url = ?, canonical_url = ? WHERE id = ?`), url, CanonicalURL(url), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("unknown database %T", db)
+	}
+}
+
+func testDedupe(t *testing.T, db DB) {
+	ctx := context.TODO()
+	books := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev/doc", Title: "Go", Tags: []model.Tag{{Name: "go"}}},
+		model.Bookmark{URL: "https://go.dev/1", Title: "Go docs", Excerpt: "documentation",
+			Content: "effective go", Tags: []model.Tag{{Name: "docs"}, {Name: "go"}}},
+		model.Bookmark{URL: "https://go.dev/2", Title: "Go trash", Tags: []model.Tag{{Name: "old"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "Rust"},
+		model.Bookmark{URL: "https://rust-lang.org/x", Title: "Rust again"},
+	)
+	setBookmarkURL(t, db, books[1].ID, "http://www.go.dev/doc/?utm_source=feed")
+	setBookmarkURL(t, db, books[2].ID, "https://go.dev/doc#intro")
+	setBookmarkURL(t, db, books[3].ID, "https://rust-lang.org/")
+	setBookmarkURL(t, db, books[4].ID, "https://www.rust-lang.org")
+
+	// The oldest bookmark outside of trash is kept
+	if err := db.TrashBookmarks(ctx, books[3].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := db.GetDuplicateIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || !equalIDs(groups[0], bookmarkIDs(books[:3])) || !equalIDs(groups[1], bookmarkIDs(books[3:])) {
+		t.Errorf("unexpected IDs of duplicates %v", groups)
+	}
+
+	dups, err := FindDuplicates(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 2 {
+		t.Fatalf("expected 2 groups of duplicates, got %+v", dups)
+	}
+
+	if dups[0].CanonicalURL != "https://go.dev/doc" || dups[0].Keep.ID != books[0].ID ||
+		!equalIDs(bookmarkIDs(dups[0].Others), []int{books[1].ID, books[2].ID}) {
+		t.Errorf("unexpected duplicates %+v", dups[0])
+	}
+	if dups[1].Keep.ID != books[4].ID || !equalIDs(bookmarkIDs(dups[1].Others), []int{books[3].ID}) {
+		t.Errorf("unexpected duplicates %+v", dups[1])
+	}
+
+	// The kept bookmark gets the archive of a merged one, the rest are removed
+	dataDir := t.TempDir()
+	db.SetDataDir(dataDir)
+	writeBookmarkFiles(t, dataDir, books[1].ID, books[2].ID)
+
+	merged, err := MergeDuplicates(ctx, db, dups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.ID != books[0].ID {
+		t.Errorf("unexpected merged bookmark %+v", merged)
+	}
+
+	if got := bookmarkFiles(t, dataDir, "archive"); got != strconv.Itoa(books[0].ID) {
+		t.Errorf("unexpected archives after merge %s", got)
+	}
+	archive, err := os.ReadFile(fp.Join(dataDir, "archive", strconv.Itoa(books[0].ID)))
+	if err != nil || string(archive) != fmt.Sprintf("archive of %d", books[1].ID) {
+		t.Errorf("unexpected archive of merged bookmark %q %v", archive, err)
+	}
+
+	result, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{books[0].ID}, WithContent: true})
+	if err != nil || len(result) != 1 {
+		t.Fatalf("failed to get merged bookmark: %v %+v", err, result)
+	}
+
+	book := result[0]
+	if book.URL != "https://go.dev/doc" || book.Title != "Go" || book.Excerpt != "documentation" ||
+		book.Content != "effective go" || strings.Join(tagNames(book.Tags), ",") != "docs,go,old" {
+		t.Errorf("unexpected merged bookmark %+v", book)
+	}
+
+	if dups, _ := FindDuplicates(ctx, db); len(dups) != 1 {
+		t.Errorf("expected 1 group of duplicates after merge, got %+v", dups)
+	}
+
+	if result, _ := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{books[1].ID, books[2].ID}}); len(result) != 0 {
+		t.Errorf("merged bookmarks remain %+v", result)
+	}
+}
+
+func testDedupeAnnotations(t *testing.T, db DB) {
+	ctx := context.TODO()
+	books := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev/doc", Title: "Go", Content: "build simple secure systems", Notes: "first notes"},
+		model.Bookmark{URL: "https://go.dev/1", Title: "Go docs", Content: "build simple secure systems", Notes: "second notes"},
+	)
+	setBookmarkURL(t, db, books[1].ID, "https://go.dev/doc?utm_source=feed")
+
+	for _, highlight := range []model.Highlight{
+		{BookmarkID: books[0].ID, Quote: "build", StartOffset: 0, EndOffset: 5, Comment: "kept"},
+		{BookmarkID: books[1].ID, Quote: "secure", StartOffset: 13, EndOffset: 19, Comment: "merged"},
+	} {
+		if _, err := db.SaveHighlight(ctx, highlight); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dups, err := FindDuplicates(ctx, db)
+	if err != nil || len(dups) != 1 {
+		t.Fatalf("unexpected duplicates %+v %v", dups, err)
+	}
+
+	// Notes and highlights of both bookmarks are kept
+	merged, err := MergeDuplicates(ctx, db, dups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.ID != books[0].ID || merged.Notes != "first notes\n\nsecond notes" {
+		t.Errorf("unexpected merged bookmark %+v", merged)
+	}
+
+	highlights, err := db.GetHighlights(ctx, books[0].ID)
+	if err != nil || len(highlights) != 2 || highlights[0].Comment != "kept" ||
+		highlights[1].Comment != "merged" || highlights[1].Quote != "secure" {
+		t.Errorf("unexpected highlights after merge %+v %v", highlights, err)
+	}
+
+	// The moved annotations are searched with the kept bookmark
+	for _, keyword := range []string{"second", "merged"} {
+		result, err := db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: keyword})
+		if err != nil || !equalIDs(bookmarkIDs(result), []int{books[0].ID}) {
+			t.Errorf("unexpected bookmarks with keyword %q after merge %v %v", keyword, bookmarkIDs(result), err)
+		}
+	}
+}
+
+func testUpdateMissing(t *testing.T, db DB) {
+	book := model.Bookmark{ID: 100, URL: "https://github.com/go-shiori/shiori", Title: "shiori"}
+
+	_, err := db.SaveBookmarks(context.TODO(), false, book)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testSaveWithID(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	// ID and trash time of copied bookmarks are kept
+	saved := saveTestBookmarks(t, db, model.Bookmark{
+		ID:        10,
+		URL:       "https://go.dev",
+		Title:     "go",
+		Modified:  "2020-01-02 03:04:05",
+		DeletedAt: "2020-02-03 04:05:06",
+	})
+	if saved[0].ID != 10 {
+		t.Fatalf("expected bookmark ID 10, got %d", saved[0].ID)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Trashed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].ID != 10 ||
+		books[0].Modified != "2020-01-02 03:04:05" || books[0].DeletedAt != "2020-02-03 04:05:06" {
+		t.Fatalf("unexpected copied bookmark %+v", books)
+	}
+
+	// New IDs continue after the kept one
+	saved = saveTestBookmarks(t, db, model.Bookmark{URL: "https://example.com", Title: "example"})
+	if saved[0].ID <= 10 {
+		t.Errorf("expected bookmark ID after 10, got %d", saved[0].ID)
+	}
+
+	_, err = db.SaveBookmarks(ctx, true, model.Bookmark{ID: 10, URL: "https://example.org", Title: "example"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists for used ID, got %v", err)
+	}
+
+	// Copied accounts keep their ID and password hash
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := db.SaveAccountWithHash(ctx, model.Account{ID: 5, Username: "shiori", Password: string(hash)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != 5 || account.Password != "" {
+		t.Errorf("unexpected copied account %+v", account)
+	}
+
+	account, _, err = db.GetAccountWithPassword(ctx, "shiori")
+	if err != nil || account.ID != 5 || account.Password != string(hash) {
+		t.Errorf("unexpected copied account %+v %v", account, err)
+	}
+
+	account, err = db.SaveAccount(ctx, model.Account{Username: "reader", Password: "secret"})
+	if err != nil || account.ID <= 5 {
+		t.Errorf("expected account ID after 5, got %d %v", account.ID, err)
+	}
+}
+
+func testTagUpsert(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	// Tag names are normalized before they are saved
+	saved := saveTestBookmarks(t, db, model.Bookmark{
+		URL:   "https://go.dev",
+		Title: "go",
+		Tags:  []model.Tag{{Name: " Web  Dev "}},
+	})
+	tag := saved[0].Tags[0]
+	if tag.ID == 0 || tag.Name != "web dev" {
+		t.Fatalf("unexpected saved tag %+v", tag)
+	}
+
+	// Tag is linked by its ID or by its name, without creating it again
+	saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://example.com", Title: "example", Tags: []model.Tag{{ID: tag.ID}}},
+		model.Bookmark{URL: "https://example.org", Title: "example", Tags: []model.Tag{{Name: "WEB DEV"}}},
+	)
+
+	// Saving a bookmark with the tags it already has doesn't link them twice
+	if _, err := db.SaveBookmarks(ctx, false, saved[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].ID != tag.ID || tags[0].NBookmarks != 3 {
+		t.Fatalf("unexpected tags %+v", tags)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Tags: []string{"web dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 3 {
+		t.Fatalf("expected 3 bookmarks with tag, got %d", len(books))
+	}
+	for _, book := range books {
+		if len(book.Tags) != 1 || book.Tags[0].ID != tag.ID || book.Tags[0].Name != "web dev" {
+			t.Errorf("unexpected tags of bookmark %d: %+v", book.ID, book.Tags)
+		}
+	}
+
+	// Another account can't link the tag by its ID, its name is the account's own tag
+	reader, err := db.SaveAccount(ctx, model.Account{Username: "reader", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SaveBookmarks(ctx, true, model.Bookmark{AccountID: reader.ID, URL: "https://go.dev", Title: "go",
+		Tags: []model.Tag{{ID: tag.ID}}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for tag of another account, got %v", err)
+	}
+
+	saved = saveTestBookmarks(t, db, model.Bookmark{AccountID: reader.ID, URL: "https://go.dev", Title: "go",
+		Tags: []model.Tag{{ID: tag.ID, Name: "web dev"}}})
+	if len(saved[0].Tags) != 1 || saved[0].Tags[0].ID == tag.ID {
+		t.Errorf("bookmark is linked to the tag of another account %+v", saved[0].Tags)
+	}
+
+	tags, err = db.GetTags(ctx, 0)
+	if err != nil || len(tags) != 2 || tags[0].NBookmarks != 3 || tags[1].NBookmarks != 1 {
+		t.Errorf("unexpected tags of accounts %+v %v", tags, err)
+	}
+}
+
+func testGetBookmarksFilters(t *testing.T, db DB) {
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{
+			URL:     "https://go.dev",
+			Title:   "The Go Programming Language",
+			Content: "build simple secure scalable systems",
+			Tags:    []model.Tag{{Name: "go"}, {Name: "lang"}},
+		},
+		model.Bookmark{
+			URL:     "https://www.rust-lang.org",
+			Title:   "Rust",
+			Excerpt: "reliable and efficient software",
+			Tags:    []model.Tag{{Name: "lang"}},
+		},
+		model.Bookmark{
+			URL:   "https://example.com",
+			Title: "Example",
+		},
+	)
+	ids := bookmarkIDs(saved)
+
+	tests := []struct {
+		name     string
+		opts     GetBookmarksOptions
+		expected []int
+	}{
+		{"all", GetBookmarksOptions{}, ids},
+		{"ids", GetBookmarksOptions{IDs: ids[1:]}, ids[1:]},
+		{"tag", GetBookmarksOptions{Tags: []string{"lang"}}, ids[:2]},
+		{"all tags required", GetBookmarksOptions{Tags: []string{"lang", "go"}}, ids[:1]},
+		{"any tag", GetBookmarksOptions{Tags: []string{"*"}}, ids[:2]},
+		{"excluded tag", GetBookmarksOptions{ExcludedTags: []string{"go"}}, ids[1:]},
+		{"without tags", GetBookmarksOptions{ExcludedTags: []string{"*"}}, ids[2:]},
+		{"keyword in url", GetBookmarksOptions{Keyword: "rust-lang"}, ids[1:2]},
+		{"keyword in excerpt", GetBookmarksOptions{Keyword: "efficient"}, ids[1:2]},
+		{"keyword in content", GetBookmarksOptions{Keyword: "scalable"}, ids[:1]},
+		{"limit", GetBookmarksOptions{Limit: 2}, ids[:2]},
+		{"offset", GetBookmarksOptions{Limit: 2, Offset: 2}, ids[2:]},
+	}
+
+	for _, test := range tests {
+		books, err := db.GetBookMarks(context.TODO(), test.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := bookmarkIDs(books); !equalIDs(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func testSearch(t *testing.T, db DB) {
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{
+			URL:      "https://go.dev/doc",
+			Title:    "The Go Programming Language",
+			Content:  "build simple secure scalable systems",
+			Public:   1,
+			Modified: "2020-01-02 03:04:05",
+			Tags:     []model.Tag{{Name: "lang/go"}},
+		},
+		model.Bookmark{
+			URL:      "https://blog.rust-lang.org",
+			Title:    "Rust Blog",
+			Excerpt:  "reliable and efficient software",
+			Modified: "2021-06-07 08:09:10",
+			Tags:     []model.Tag{{Name: "lang/rust"}, {Name: "old"}},
+		},
+		model.Bookmark{
+			URL:      "https://example.com:8080?q=go.dev",
+			Title:    "Example",
+			Modified: "2022-01-01 00:00:00",
+		},
+	)
+	ids := bookmarkIDs(saved)
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"", ids},
+		{"rust", ids[1:2]},
+		{"-rust", []int{ids[0], ids[2]}},
+		{`"secure scalable"`, ids[:1]},
+		{`"scalable secure"`, []int{}},
+		{"go OR example", []int{ids[0], ids[2]}},
+		{"tag:lang", ids[:2]},
+		{"tag:lang -tag:old", ids[:1]},
+		{"tag:*", ids[:2]},
+		{"-tag:*", ids[2:]},
+		{"tag:LANG/Go OR tag:old", ids[:2]},
+		{"site:go.dev", ids[:1]},
+		{"site:rust-lang.org", ids[1:2]},
+		{"site:example.com", ids[2:]},
+		{"site:dev", ids[:1]},
+		{"site:o.dev", []int{}},
+		{"is:public", ids[:1]},
+		{"is:private", ids[1:]},
+		{"has:archive", ids[2:]},
+		{"has:content", ids[:1]},
+		{"-has:content -has:archive", ids[1:2]},
+		{"before:2021-06-07", ids[:1]},
+		{"after:2021-06-06", ids[1:]},
+		{"after:2021-06-07", ids[2:]},
+		{"after:2020-01-01 before:2022-01-01", ids[:2]},
+		{"tag:lang is:public OR efficient", ids[:2]},
+	}
+
+	for _, test := range tests {
+		search, err := ParseSearch(test.query)
+		if err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+
+		books, err := db.GetBookMarks(context.TODO(), GetBookmarksOptions{
+			Search:     search,
+			ArchiveIDs: ids[2:],
+		})
+		if err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+
+		if got := bookmarkIDs(books); !equalIDs(got, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.query, test.expected, got)
+		}
+	}
+
+	// Search keywords are used for relevance
+	search, _ := ParseSearch("efficient OR rust")
+	books, err := db.GetBookMarks(context.TODO(), GetBookmarksOptions{Search: search, OrderMethod: ByRelevance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bookmarkIDs(books); !equalIDs(got, ids[1:2]) {
+		t.Errorf("unexpected bookmarks ordered by relevance %v", got)
+	}
+}
+
+func testGetBookmarksKeyword(t *testing.T, db DB) {
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{
+			URL:   "https://golang.example.com",
+			Title: "Example",
+			Tags:  []model.Tag{{Name: "go"}},
+		},
+		model.Bookmark{
+			URL:     "https://go.dev",
+			Title:   "The Golang Programming Language",
+			Content: "golang makes it easy to build simple, reliable and efficient software",
+		},
+		model.Bookmark{
+			URL:     "https://www.rust-lang.org",
+			Title:   "Rust",
+			Content: "a language empowering everyone",
+		},
+	)
+	ids := bookmarkIDs(saved)
+
+	tests := []struct {
+		name     string
+		opts     GetBookmarksOptions
+		expected []int
+	}{
+		{"case insensitive", GetBookmarksOptions{Keyword: "GOLANG"}, ids[:2]},
+		{"with tag", GetBookmarksOptions{Keyword: "golang", Tags: []string{"go"}}, ids[:1]},
+		{"with excluded tag", GetBookmarksOptions{Keyword: "golang", ExcludedTags: []string{"go"}}, ids[1:2]},
+		{"no match", GetBookmarksOptions{Keyword: "python"}, []int{}},
+		// Content is matched by words like its full text index, not by part of them
+		{"word in content", GetBookmarksOptions{Keyword: "Everyone"}, ids[2:]},
+		{"part of word in content", GetBookmarksOptions{Keyword: "power"}, []int{}},
+		{"phrase in content", GetBookmarksOptions{Keyword: "simple, reliable"}, ids[1:2]},
+		// Matches in title and content come before matches in URL only
+		{"relevance", GetBookmarksOptions{Keyword: "golang", OrderMethod: ByRelevance}, []int{ids[1], ids[0]}},
+	}
+
+	for _, test := range tests {
+		books, err := db.GetBookMarks(context.TODO(), test.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := bookmarkIDs(books); !equalIDs(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func testGetBookmarksOrder(t *testing.T, db DB) {
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://b.example.com", Title: "bravo", Modified: "2020-01-02 00:00:00"},
+		model.Bookmark{URL: "http://c.example.com", Title: "alpha", Modified: "2020-01-03 00:00:00"},
+		model.Bookmark{URL: "https://a.example.com", Title: "charlie", Modified: "2020-01-01 00:00:00"},
+	)
+	ids := bookmarkIDs(saved)
+
+	tests := []struct {
+		order    OrderMethod
+		expected []int
+	}{
+		{DefaultOrder, []int{ids[0], ids[1], ids[2]}},
+		{ByLastAdded, []int{ids[2], ids[1], ids[0]}},
+		{ByLastModified, []int{ids[1], ids[0], ids[2]}},
+		{ByTitle, []int{ids[1], ids[0], ids[2]}},
+		{ByURL, []int{ids[2], ids[0], ids[1]}},
+		{ByRelevance, []int{ids[2], ids[1], ids[0]}},
+	}
+
+	for _, test := range tests {
+		books, err := db.GetBookMarks(context.TODO(), GetBookmarksOptions{OrderMethod: test.order})
+		if err != nil {
+			t.Fatalf("order %d: %v", test.order, err)
+		}
+
+		if got := bookmarkIDs(books); !equalIDs(got, test.expected) {
+			t.Errorf("order %d: expected %v, got %v", test.order, test.expected, got)
+		}
+	}
+
+	_, err := db.GetBookMarks(context.TODO(), GetBookmarksOptions{OrderMethod: OrderMethod(-1)})
+	if err == nil {
+		t.Error("expected error for unknown order method")
+	}
+
+	// URL without scheme is ordered as it is, and it can be used as cursor
+	short := saveTestBookmarks(t, db, model.Bookmark{URL: "b", Title: "short"})
+	opts := GetBookmarksOptions{OrderMethod: ByURL, Limit: 2}
+	books, err := db.GetBookMarks(context.TODO(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bookmarkIDs(books); !equalIDs(got, []int{ids[2], short[0].ID}) {
+		t.Errorf("unexpected order of URL without scheme %v", got)
+	}
+
+	opts.Cursor, _, err = BookmarkCursors(opts, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	books, err = db.GetBookMarks(context.TODO(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bookmarkIDs(books); !equalIDs(got, []int{ids[0], ids[1]}) {
+		t.Errorf("unexpected page after URL without scheme %v", got)
+	}
+}
+
+func testGetBookmarksPages(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	titles := []string{"echo", "alpha", "delta", "bravo", "charlie"}
+	for i, title := range titles {
+		saveTestBookmarks(t, db, model.Bookmark{
+			URL:   fmt.Sprintf("https://%d.example.com", i),
+			Title: title,
+			Tags:  []model.Tag{{Name: "page"}},
+		})
+	}
+
+	// Every bookmark is on exactly one page, in the requested order
+	got := []string{}
+	for offset := 0; offset < len(titles); offset += 2 {
+		books, err := db.GetBookMarks(ctx, GetBookmarksOptions{
+			Tags:        []string{"page"},
+			OrderMethod: ByTitle,
+			Limit:       2,
+			Offset:      offset,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) > 2 {
+			t.Fatalf("page at offset %d has %d bookmarks", offset, len(books))
+		}
+
+		for _, book := range books {
+			got = append(got, book.Title)
+		}
+	}
+
+	if strings.Join(got, ",") != "alpha,bravo,charlie,delta,echo" {
+		t.Errorf("unexpected pages %v", got)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Limit: 2, Offset: len(titles)})
+	if err != nil || len(books) != 0 {
+		t.Errorf("expected empty page after the last one, got %d %v", len(books), err)
+	}
+}
+
+func testGetBookmarksCursor(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://e.example.com", Title: "bravo", Content: "paged", Modified: "2020-01-02 00:00:00"},
+		model.Bookmark{URL: "http://d.example.com", Title: "alpha", Content: "paged paged", Modified: "2020-01-03 00:00:00"},
+		model.Bookmark{URL: "https://c.example.com", Title: "Bravo", Content: "paged", Modified: "2020-01-02 00:00:00"},
+		model.Bookmark{URL: "https://b.example.com", Title: "delta", Content: "paged", Modified: "2020-01-01 00:00:00"},
+		model.Bookmark{URL: "http://a.example.com", Title: "charlie", Content: "paged paged paged", Modified: "2020-01-03 00:00:00"},
+	)
+
+	// Relevance is paginated by the offset of page, as it has no stable key
+	for _, base := range []GetBookmarksOptions{
+		{OrderMethod: DefaultOrder},
+		{OrderMethod: ByLastAdded},
+		{OrderMethod: ByLastModified},
+		{OrderMethod: ByTitle},
+		{OrderMethod: ByURL},
+		{OrderMethod: ByRelevance, Keyword: "paged"},
+	} {
+		order := base.OrderMethod
+		all, err := db.GetBookMarks(ctx, base)
+		if err != nil {
+			t.Fatalf("order %d: %v", order, err)
+		}
+		expected := bookmarkIDs(all)
+		if len(expected) != 5 {
+			t.Fatalf("order %d: expected 5 bookmarks, got %v", order, expected)
+		}
+
+		// Walk forward through all pages
+		opts := base
+		opts.Limit = 2
+		forward := []int{}
+		for i := 0; i < len(all); i++ {
+			books, err := db.GetBookMarks(ctx, opts)
+			if err != nil {
+				t.Fatalf("order %d: %v", order, err)
+			}
+			forward = append(forward, bookmarkIDs(books)...)
+
+			next, _, err := BookmarkCursors(opts, books)
+			if err != nil {
+				t.Fatalf("order %d: %v", order, err)
+			}
+			if next == "" {
+				break
+			}
+			opts.Cursor = next
+		}
+
+		if !equalIDs(forward, expected) {
+			t.Errorf("order %d forward: expected %v, got %v", order, expected, forward)
+		}
+
+		// Walk backward from the last page
+		books, err := db.GetBookMarks(ctx, opts)
+		if err != nil {
+			t.Fatalf("order %d: %v", order, err)
+		}
+		backward := bookmarkIDs(books)
+		for i := 0; i < len(all); i++ {
+			_, prev, err := BookmarkCursors(opts, books)
+			if err != nil {
+				t.Fatalf("order %d: %v", order, err)
+			}
+			if prev == "" {
+				break
+			}
+
+			opts.Cursor = prev
+			books, err = db.GetBookMarks(ctx, opts)
+			if err != nil {
+				t.Fatalf("order %d: %v", order, err)
+			}
+			backward = append(bookmarkIDs(books), backward...)
+		}
+
+		if !equalIDs(backward, expected) {
+			t.Errorf("order %d backward: expected %v, got %v", order, expected, backward)
+		}
+	}
+
+	// Cursor can only be used with its own order method
+	cursor := Cursor{OrderMethod: ByTitle, Key: "alpha", ID: 1}.Encode()
+	_, err := db.GetBookMarks(ctx, GetBookmarksOptions{OrderMethod: ByLastAdded, Cursor: cursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	cursor = Cursor{OrderMethod: ByRelevance, Offset: -1}.Encode()
+	_, err = db.GetBookMarks(ctx, GetBookmarksOptions{OrderMethod: ByRelevance, Keyword: "paged", Cursor: cursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for negative offset, got %v", err)
+	}
+}
+
+func testDeleteBookmarks(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Content: "golang", Tags: []model.Tag{{Name: "go"}, {Name: "lang"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust", Content: "rust", Tags: []model.Tag{{Name: "lang"}}},
+		model.Bookmark{URL: "https://example.com", Title: "example", Content: "example"},
+	)
+
+	if err := db.DeleteBookmarks(ctx, saved[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bookmarkIDs(books); !equalIDs(got, bookmarkIDs(saved[1:])) {
+		t.Errorf("expected %v, got %v", bookmarkIDs(saved[1:]), got)
+	}
+
+	// Content of deleted bookmark is no longer searchable
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "golang"})
+	if err != nil || len(books) != 0 {
+		t.Errorf("deleted bookmark found by keyword: %+v %v", books, err)
+	}
+
+	// Tag go is no longer used, while lang is still used by rust
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Tags: []string{"lang"}})
+	if err != nil || len(books) != 1 {
+		t.Errorf("unexpected bookmarks with tag lang: %+v %v", books, err)
+	}
+
+	rebook := saveTestBookmarks(t, db, model.Bookmark{URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "go"}}})
+	if rebook[0].Tags[0].ID == saved[0].Tags[0].ID {
+		t.Errorf("unused tag go wasn't removed")
+	}
+
+	// Without ids everything is removed
+	if err := db.DeleteBookmarks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{})
+	if err != nil || len(books) != 0 {
+		t.Errorf("bookmarks not deleted: %+v %v", books, err)
+	}
+}
+
+// writeBookmarkFiles creates the thumbnail image and archive of bookmarks in data dir.
+func writeBookmarkFiles(t *testing.T, dataDir string, ids ...int) {
+	t.Helper()
+
+	for _, dir := range bookmarkFileDirs {
+		if err := os.MkdirAll(fp.Join(dataDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range ids {
+			content := []byte(fmt.Sprintf("%s of %d", dir, id))
+			if err := os.WriteFile(fp.Join(dataDir, dir, strconv.Itoa(id)), content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// bookmarkFiles returns the names of files in the dir of data dir.
+func bookmarkFiles(t *testing.T, dataDir, dir string) string {
+	t.Helper()
+
+	entries, err := os.ReadDir(fp.Join(dataDir, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func testDeleteBookmarkFiles(t *testing.T, db DB) {
+	ctx := context.TODO()
+	dataDir := t.TempDir()
+	db.SetDataDir(dataDir)
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go"},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust"},
+		model.Bookmark{URL: "https://example.com", Title: "example"},
+		model.Bookmark{URL: "https://example.org", Title: "example"},
+	)
+	ids := bookmarkIDs(saved)
+	writeBookmarkFiles(t, dataDir, ids...)
+
+	expectFiles := func(expected ...int) {
+		t.Helper()
+
+		names := []string{}
+		for _, id := range expected {
+			names = append(names, strconv.Itoa(id))
+		}
+		for _, dir := range bookmarkFileDirs {
+			if got := bookmarkFiles(t, dataDir, dir); got != strings.Join(names, ",") {
+				t.Errorf("expected %s files %v, got %s", dir, names, got)
+			}
+		}
+	}
+
+	if err := db.DeleteBookmarks(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles(ids[1:]...)
+
+	// Inside WithTx files are removed after commit, and kept on rollback
+	err := db.WithTx(ctx, func(tx DB) error {
+		if err := tx.DeleteBookmarks(ctx, ids[1]); err != nil {
+			return err
+		}
+		expectFiles(ids[1:]...)
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("expected rollback, got %v", err)
+	}
+	expectFiles(ids[1:]...)
+
+	err = db.WithTx(ctx, func(tx DB) error {
+		return tx.DeleteBookmarks(ctx, ids[1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFiles(ids[2:]...)
+
+	// Purged bookmarks lose their files as well
+	if err := db.TrashBookmarks(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PurgeBookmarks(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles(ids[3:]...)
+
+	// Without ids files of all bookmarks are removed
+	if err := db.DeleteBookmarks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles()
+}
+
+func testTrash(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Content: "golang", Tags: []model.Tag{{Name: "go"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust"},
+		model.Bookmark{URL: "https://example.com", Title: "example"},
+	)
+	ids := bookmarkIDs(saved)
+
+	getIDs := func(opts GetBookmarksOptions) []int {
+		books, err := db.GetBookMarks(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bookmarkIDs(books)
+	}
+
+	if err := db.TrashBookmarks(ctx, ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trashed bookmarks are hidden by default
+	if got := getIDs(GetBookmarksOptions{}); !equalIDs(got, ids[2:]) {
+		t.Errorf("expected %v, got %v", ids[2:], got)
+	}
+	if got := getIDs(GetBookmarksOptions{Trashed: true}); !equalIDs(got, ids[:2]) {
+		t.Errorf("expected trash %v, got %v", ids[:2], got)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Trashed: true, IDs: ids[:1]})
+	if err != nil || len(books) != 1 || books[0].DeletedAt == "" {
+		t.Errorf("unexpected trashed bookmark %+v %v", books, err)
+	}
+
+	// Trashed bookmarks aren't counted in tags
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil || len(tags) != 1 || tags[0].NBookmarks != 0 {
+		t.Errorf("unexpected tags %+v %v", tags, err)
+	}
+
+	// Restore
+	if err := db.RestoreBookmarks(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := getIDs(GetBookmarksOptions{}); !equalIDs(got, []int{ids[0], ids[2]}) {
+		t.Errorf("expected %v, got %v", []int{ids[0], ids[2]}, got)
+	}
+
+	// Purge only removes bookmarks trashed before the time
+	purged, err := db.PurgeBookmarks(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(purged) != 0 {
+		t.Errorf("unexpected purged bookmarks %v %v", purged, err)
+	}
+
+	purged, err = db.PurgeBookmarks(ctx, time.Now().Add(time.Hour))
+	if err != nil || !equalIDs(purged, ids[1:2]) {
+		t.Errorf("expected purged %v, got %v %v", ids[1:2], purged, err)
+	}
+
+	if got := getIDs(GetBookmarksOptions{Trashed: true}); len(got) != 0 {
+		t.Errorf("trash not empty after purge: %v", got)
+	}
+	if got := getIDs(GetBookmarksOptions{}); !equalIDs(got, []int{ids[0], ids[2]}) {
+		t.Errorf("purge removed normal bookmarks: %v", got)
+	}
+}
+
+func testTags(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "go"}, {Name: "golang"}}},
+		model.Bookmark{URL: "https://pkg.go.dev", Title: "pkg", Tags: []model.Tag{{Name: "golang"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust", Tags: []model.Tag{{Name: "rust"}}},
+	)
+
+	tagCounts := func() map[string]int {
+		tags, err := db.GetTags(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts := map[string]int{}
+		for _, tag := range tags {
+			counts[tag.Name] = tag.NBookmarks
+		}
+		return counts
+	}
+
+	counts := tagCounts()
+	if len(counts) != 3 || counts["go"] != 1 || counts["golang"] != 2 || counts["rust"] != 1 {
+		t.Errorf("unexpected tags %v", counts)
+	}
+
+	// Rename to a free name
+	rustID := saved[2].Tags[0].ID
+	tag, err := db.RenameTag(ctx, rustID, "Rust Lang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.ID != rustID || tag.Name != "rust lang" {
+		t.Errorf("unexpected renamed tag %+v", tag)
+	}
+
+	// Rename to existing name merges both tags
+	goID := saved[0].Tags[0].ID
+	tag, err = db.RenameTag(ctx, saved[0].Tags[1].ID, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.ID != goID || tag.Name != "go" {
+		t.Errorf("unexpected merged tag %+v", tag)
+	}
+
+	counts = tagCounts()
+	if len(counts) != 2 || counts["go"] != 2 || counts["rust lang"] != 1 {
+		t.Errorf("unexpected tags after rename %v", counts)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Tags: []string{"go"}})
+	if err != nil || len(books) != 2 {
+		t.Errorf("unexpected bookmarks with merged tag %+v %v", books, err)
+	}
+
+	_, err = db.RenameTag(ctx, 100, "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testNestedTags(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "Lang / Go"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust", Tags: []model.Tag{{Name: "lang/rust"}}},
+		model.Bookmark{URL: "https://example.com", Title: "lang", Tags: []model.Tag{{Name: "lang"}}},
+		model.Bookmark{URL: "https://example.org", Title: "other", Tags: []model.Tag{{Name: "language"}}},
+	)
+	if saved[0].Tags[0].Name != "lang/go" {
+		t.Errorf("unexpected tag name %q", saved[0].Tags[0].Name)
+	}
+
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := TagTree(tags)
+	if len(tree) != 2 || tree[0].Name != "lang" || tree[1].Name != "language" {
+		t.Fatalf("unexpected tag roots %+v", tree)
+	}
+	if len(tree[0].Children) != 2 || tree[0].Children[0].Name != "lang/go" || tree[0].Children[1].Name != "lang/rust" {
+		t.Errorf("unexpected tag children %+v", tree[0].Children)
+	}
+	if tree[0].Children[0].ParentID != tree[0].ID {
+		t.Errorf("unexpected parent of %+v", tree[0].Children[0])
+	}
+
+	// Parent matches its descendants, but not tags with the same prefix
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Tags: []string{"lang"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := bookmarkIDs(books); !equalIDs(ids, []int{saved[0].ID, saved[1].ID, saved[2].ID}) {
+		t.Errorf("unexpected bookmarks of parent tag %v", ids)
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{ExcludedTags: []string{"lang/go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := bookmarkIDs(books); !equalIDs(ids, []int{saved[1].ID, saved[2].ID, saved[3].ID}) {
+		t.Errorf("unexpected bookmarks without child tag %v", ids)
+	}
+
+	// Renaming the parent moves its subtree
+	_, err = db.RenameTag(ctx, tree[0].ID, "code/languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Tags: []string{"code"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 3 {
+		t.Errorf("unexpected bookmarks of moved tags %+v", books)
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{saved[0].ID}})
+	if err != nil || len(books) != 1 || len(books[0].Tags) != 1 || books[0].Tags[0].Name != "code/languages/go" {
+		t.Errorf("unexpected bookmark after moving tags %+v %v", books, err)
+	}
+
+	// A tag can't be moved into its own subtree
+	_, err = db.RenameTag(ctx, tree[0].ID, "code/languages/go/old")
+	if err == nil {
+		t.Error("expected error when moving tag into itself")
+	}
+
+	// Deleting the bookmarks removes the unused parents as well
+	err = db.DeleteBookmarks(ctx, saved[0].ID, saved[1].ID, saved[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err = db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "language" {
+		t.Errorf("unexpected tags after delete %+v", tags)
+	}
+}
+
+func testRevisions(t *testing.T, db DB) {
+	ctx := context.TODO()
+	db.SetRevisionLimit(2)
+
+	book := saveTestBookmarks(t, db, model.Bookmark{
+		URL:     "https://go.dev",
+		Title:   "Go",
+		Excerpt: "first",
+		Content: "line 1\nline 2",
+		Tags:    []model.Tag{{Name: "go"}, {Name: "old"}},
+	})[0]
+
+	// Nothing is recorded when bookmark is created
+	revisions, err := db.GetBookmarkRevisions(ctx, book.ID)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("unexpected revisions of new bookmark %+v %v", revisions, err)
+	}
+
+	// Every update records the previous state
+	for _, title := range []string{"Go 2", "Go 3", "Go 4"} {
+		book.Title = title
+		book.Excerpt = "second"
+		book.Content = "line 1\nline two"
+		book.Tags = []model.Tag{{Name: "go"}, {Name: "old", Deleted: true}, {Name: "new"}}
+
+		_, err = db.SaveBookmarks(ctx, false, book)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the newest revisions are kept
+	revisions, err = db.GetBookmarkRevisions(ctx, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Title != "Go 3" || revisions[1].Title != "Go 2" {
+		t.Fatalf("unexpected revisions %+v", revisions)
+	}
+	if revisions[0].Content != "" || len(revisions[0].Tags) != 2 || revisions[0].Created == "" {
+		t.Errorf("unexpected revision in list %+v", revisions[0])
+	}
+
+	// A single revision is loaded with its content
+	db.SetRevisionLimit(DefaultRevisionLimit)
+	revision, err := db.GetBookmarkRevision(ctx, revisions[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.Content != "line 1\nline two" {
+		t.Errorf("unexpected revision content %q", revision.Content)
+	}
+
+	diffs, err := DiffBookmarkRevisions(ctx, db, revisions[1].ID, revisions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Field != "title" || len(diffs[0].Lines) != 2 {
+		t.Errorf("unexpected diff %+v", diffs)
+	}
+
+	// Roll back the changes made after the newest revision
+	book.Title = "Go"
+	book.Excerpt = "first"
+	book.Content = "line 1\nline 2"
+	book.Tags = []model.Tag{{Name: "old"}, {Name: "new", Deleted: true}}
+	_, err = db.SaveBookmarks(ctx, false, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err = db.GetBookmarkRevisions(ctx, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := db.RollbackBookmark(ctx, revisions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Title != "Go 4" || rolledBack.Excerpt != "second" {
+		t.Errorf("unexpected rolled back bookmark %+v", rolledBack)
+	}
+
+	current, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{book.ID}, WithContent: true})
+	if err != nil || len(current) != 1 {
+		t.Fatalf("failed to get rolled back bookmark %+v %v", current, err)
+	}
+	if current[0].Content != "line 1\nline two" {
+		t.Errorf("unexpected rolled back content %q", current[0].Content)
+	}
+	tags := NewBookmarkRevision(current[0]).Tags
+	if len(tags) != 2 || tags[0] != "go" || tags[1] != "new" {
+		t.Errorf("unexpected rolled back tags %v", tags)
+	}
+
+	// The rollback itself is recorded, so it can be compared and undone
+	diffs, err = DiffBookmarkRevisions(ctx, db, revisions[0].ID+1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := []string{}
+	for _, diff := range diffs {
+		fields = append(fields, diff.Field)
+	}
+	if len(fields) != 4 || fields[0] != "title" || fields[3] != "content" {
+		t.Errorf("unexpected diff with current bookmark %v", fields)
+	}
+
+	expected := []DiffLine{{" ", "line 1"}, {"-", "line 2"}, {"+", "line two"}}
+	if lines := diffs[3].Lines; len(lines) != len(expected) || lines[0] != expected[0] ||
+		lines[1] != expected[1] || lines[2] != expected[2] {
+		t.Errorf("unexpected content diff %+v", diffs[3].Lines)
+	}
+
+	// Deleting bookmark removes its revisions
+	err = db.DeleteBookmarks(ctx, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GetBookmarkRevision(ctx, revisions[0].ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testAccounts(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	owner, err := db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret", Owner: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.ID == 0 || owner.Password != "" {
+		t.Errorf("unexpected saved account %+v", owner)
+	}
+
+	_, err = db.SaveAccount(ctx, model.Account{Username: "reader", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "other"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	// Password is only fetched on request, and it's hashed
+	account, exist, err := db.GetAccount(ctx, "shiori")
+	if err != nil || !exist || account.Password != "" || !account.Owner {
+		t.Errorf("unexpected account %+v %v %v", account, exist, err)
+	}
+
+	account, exist, err = db.GetAccountWithPassword(ctx, "shiori")
+	if err != nil || !exist {
+		t.Fatalf("unexpected account %+v %v %v", account, exist, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte("secret")); err != nil {
+		t.Errorf("password hash doesn't match: %v", err)
+	}
+
+	_, exist, err = db.GetAccount(ctx, "nobody")
+	if err != nil || exist {
+		t.Errorf("missing account exists: %v %v", exist, err)
+	}
+
+	// Filter accounts
+	accounts, err := db.GetAccounts(ctx, GetAccountsOptions{Owner: true})
+	if err != nil || len(accounts) != 1 || accounts[0].Username != "shiori" {
+		t.Errorf("unexpected owners %+v %v", accounts, err)
+	}
+
+	accounts, err = db.GetAccounts(ctx, GetAccountsOptions{Keyword: "read"})
+	if err != nil || len(accounts) != 1 || accounts[0].Username != "reader" {
+		t.Errorf("unexpected accounts %+v %v", accounts, err)
+	}
+
+	// Update without password keeps the old one
+	owner.Owner = false
+	if err := db.UpdateAccount(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	account, _, _ = db.GetAccountWithPassword(ctx, "shiori")
+	if account.Owner || bcrypt.CompareHashAndPassword([]byte(account.Password), []byte("secret")) != nil {
+		t.Errorf("unexpected updated account %+v", account)
+	}
+
+	owner.Password = "changed"
+	if err := db.UpdateAccount(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	account, _, _ = db.GetAccountWithPassword(ctx, "shiori")
+	if bcrypt.CompareHashAndPassword([]byte(account.Password), []byte("changed")) != nil {
+		t.Error("password not updated")
+	}
+
+	err = db.UpdateAccount(ctx, model.Account{ID: 100, Username: "nobody"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Username stays unique when it's changed
+	owner.Username = "reader"
+	owner.Password = ""
+	err = db.UpdateAccount(ctx, owner)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	// Delete accounts
+	if err := db.DeleteAccounts(ctx, "shiori", "reader"); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err = db.GetAccounts(ctx, GetAccountsOptions{})
+	if err != nil || len(accounts) != 0 {
+		t.Errorf("accounts not deleted %+v %v", accounts, err)
+	}
+}
+
+func testWithTx(t *testing.T, db DB) {
+	ctx := context.TODO()
+	errFailed := errors.New("failed")
+
+	// Changes are committed together, nested calls join the transaction
+	err := db.WithTx(ctx, func(tx DB) error {
+		if _, err := tx.SaveBookmarks(ctx, true, model.Bookmark{URL: "https://go.dev", Title: "go"}); err != nil {
+			return err
+		}
+
+		return tx.WithTx(ctx, func(tx DB) error {
+			_, err := tx.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{})
+	if err != nil || len(books) != 1 {
+		t.Errorf("unexpected committed bookmarks %+v %v", books, err)
+	}
+
+	if _, exist, err := db.GetAccount(ctx, "shiori"); err != nil || !exist {
+		t.Errorf("committed account doesn't exist: %v %v", exist, err)
+	}
+
+	// Changes are rolled back on error, including the ones of nested calls
+	err = db.WithTx(ctx, func(tx DB) error {
+		err := tx.WithTx(ctx, func(tx DB) error {
+			_, err := tx.SaveBookmarks(ctx, true, model.Bookmark{URL: "https://example.com", Title: "example"})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Changes are visible inside of the transaction
+		books, err := tx.GetBookMarks(ctx, GetBookmarksOptions{})
+		if err != nil || len(books) != 2 {
+			t.Errorf("unexpected bookmarks inside transaction %+v %v", books, err)
+		}
+
+		if err := tx.DeleteAccounts(ctx, "shiori"); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected error of fn, got %v", err)
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{})
+	if err != nil || len(books) != 1 || books[0].URL != "https://go.dev" {
+		t.Errorf("unexpected bookmarks after rollback %+v %v", books, err)
+	}
+
+	if _, exist, err := db.GetAccount(ctx, "shiori"); err != nil || !exist {
+		t.Errorf("deleted account is not rolled back: %v %v", exist, err)
+	}
+}
+
+func testBookmarksCount(t *testing.T, db DB) {
+	ctx := context.TODO()
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "Go", Tags: []model.Tag{{Name: "lang"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "Rust", Tags: []model.Tag{{Name: "lang"}}},
+		model.Bookmark{URL: "https://example.com", Title: "Example"},
+	)
+
+	if err := db.TrashBookmarks(ctx, saved[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := ParseSearch("go OR example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     GetBookmarksOptions
+		expected int
+	}{
+		{"all", GetBookmarksOptions{}, 2},
+		{"trash", GetBookmarksOptions{Trashed: true}, 1},
+		{"tag", GetBookmarksOptions{Tags: []string{"lang"}, Limit: 1, OrderMethod: ByTitle}, 2},
+		{"keyword", GetBookmarksOptions{Keyword: "rust", OrderMethod: ByRelevance}, 1},
+		{"search", GetBookmarksOptions{Search: search}, 1},
+	}
+
+	for _, test := range tests {
+		count, err := db.GetBookmarksCount(ctx, test.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if count != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, count)
+		}
+	}
+}
+
+func testSavedSearches(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	shiori, err := db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := db.SaveAccount(ctx, model.Account{Username: "reader", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golang, err := db.SaveSavedSearch(ctx, model.SavedSearch{AccountID: shiori.ID, Name: " Go ", Query: "tag:go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golang.ID == 0 || golang.Name != "Go" {
+		t.Errorf("unexpected saved search %+v", golang)
+	}
+
+	_, err = db.SaveSavedSearch(ctx, model.SavedSearch{AccountID: shiori.ID, Name: "articles", Query: "has:content"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Names are unique for each account only
+	_, err = db.SaveSavedSearch(ctx, model.SavedSearch{AccountID: shiori.ID, Name: "Go", Query: "go"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	other, err := db.SaveSavedSearch(ctx, model.SavedSearch{AccountID: reader.ID, Name: "Go", Query: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Name and query must be valid
+	invalid := []model.SavedSearch{
+		{AccountID: shiori.ID, Name: " ", Query: "go"},
+		{AccountID: shiori.ID, Name: "broken", Query: "tag:"},
+	}
+	for _, search := range invalid {
+		if _, err := db.SaveSavedSearch(ctx, search); err == nil {
+			t.Errorf("expected error for invalid saved search %+v", search)
+		}
+	}
+
+	searches, err := db.GetSavedSearches(ctx, shiori.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searches) != 2 || searches[0].Name != "articles" || searches[1].Name != "Go" {
+		t.Errorf("unexpected saved searches %+v", searches)
+	}
+
+	// Update the query, the search of another account can't be changed
+	golang.Query = "tag:go OR site:go.dev"
+	if _, err := db.SaveSavedSearch(ctx, golang); err != nil {
+		t.Fatal(err)
+	}
+
+	search, exist, err := db.GetSavedSearch(ctx, shiori.ID, golang.ID)
+	if err != nil || !exist || search.Query != golang.Query {
+		t.Errorf("unexpected updated search %+v %v %v", search, exist, err)
+	}
+
+	other.AccountID = shiori.ID
+	other.Name = "stolen"
+	if _, err := db.SaveSavedSearch(ctx, other); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, exist, err := db.GetSavedSearch(ctx, shiori.ID, other.ID); err != nil || exist {
+		t.Errorf("search of another account is found: %v %v", exist, err)
+	}
+
+	// Delete only removes the searches of the account
+	if err := db.DeleteSavedSearches(ctx, shiori.ID, golang.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if searches, _ := db.GetSavedSearches(ctx, shiori.ID); len(searches) != 1 {
+		t.Errorf("unexpected saved searches after delete %+v", searches)
+	}
+
+	if _, exist, _ := db.GetSavedSearch(ctx, reader.ID, other.ID); !exist {
+		t.Error("search of another account is deleted")
+	}
+
+	// Searches are removed with their account
+	if err := db.DeleteAccounts(ctx, "reader"); err != nil {
+		t.Fatal(err)
+	}
+
+	if searches, _ := db.GetSavedSearches(ctx, reader.ID); len(searches) != 0 {
+		t.Errorf("searches of deleted account remain %+v", searches)
+	}
+}
+
+func testNotes(t *testing.T, db DB) {
+	ctx := context.TODO()
+	book := saveTestBookmarks(t, db, model.Bookmark{
+		URL:      "https://go.dev",
+		Title:    "go",
+		Modified: "2020-01-02 03:04:05",
+		Notes:    "# Reading list",
+	})[0]
+	saveTestBookmarks(t, db, model.Bookmark{URL: "https://example.com", Title: "example"})
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{book.ID}})
+	if err != nil || len(books) != 1 || books[0].Notes != "# Reading list" {
+		t.Fatalf("unexpected notes of saved bookmark %+v %v", books, err)
+	}
+
+	// Notes are changed without a revision and keep the modified time
+	if err := db.SaveBookmarkNotes(ctx, book.ID, "Compare *generics* with templates"); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{book.ID}})
+	if err != nil || len(books) != 1 || books[0].Notes != "Compare *generics* with templates" ||
+		books[0].Modified != "2020-01-02 03:04:05" {
+		t.Errorf("unexpected bookmark after saving notes %+v %v", books, err)
+	}
+
+	if revisions, _ := db.GetBookmarkRevisions(ctx, book.ID); len(revisions) != 0 {
+		t.Errorf("saving notes shouldn't record revision %+v", revisions)
+	}
+
+	// Notes are searched with the content
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "generics"})
+	if err != nil || !equalIDs(bookmarkIDs(books), []int{book.ID}) {
+		t.Errorf("unexpected bookmarks with keyword of notes %+v %v", books, err)
+	}
+
+	// Without annotations, e.g. for public bookmarks, notes aren't searched
+	search, _ := ParseSearch("generics")
+	for _, opts := range []GetBookmarksOptions{
+		{Keyword: "generics", WithoutAnnotations: true},
+		{Search: search, WithoutAnnotations: true},
+		{Search: search, OrderMethod: ByRelevance, WithoutAnnotations: true},
+	} {
+		if books, err := db.GetBookMarks(ctx, opts); err != nil || len(books) != 0 {
+			t.Errorf("notes are searched without annotations %+v %v", books, err)
+		}
+	}
+
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "go", WithoutAnnotations: true})
+	if err != nil || !equalIDs(bookmarkIDs(books), []int{book.ID}) {
+		t.Errorf("unexpected bookmarks with keyword without annotations %+v %v", books, err)
+	}
+
+	search, _ = ParseSearch("-templates")
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Search: search})
+	if err != nil || len(books) != 1 || books[0].ID == book.ID {
+		t.Errorf("unexpected bookmarks without keyword of notes %+v %v", books, err)
+	}
+
+	// The old notes aren't found anymore
+	if books, _ := db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "Reading"}); len(books) != 0 {
+		t.Errorf("old notes are still searched %+v", books)
+	}
+
+	if err := db.SaveBookmarkNotes(ctx, 100, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testHighlights(t *testing.T, db DB) {
+	ctx := context.TODO()
+	books := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Content: "build simple secure scalable systems"},
+		model.Bookmark{URL: "https://example.com", Title: "example"},
+	)
+	book := books[0]
+
+	for _, highlight := range []model.Highlight{
+		{BookmarkID: book.ID, Quote: " ", StartOffset: 0, EndOffset: 1},
+		{BookmarkID: book.ID, Quote: "simple", StartOffset: -1, EndOffset: 5},
+		{BookmarkID: book.ID, Quote: "simple", StartOffset: 6, EndOffset: 6},
+	} {
+		if _, err := db.SaveHighlight(ctx, highlight); err == nil {
+			t.Errorf("expected error for invalid highlight %+v", highlight)
+		}
+	}
+
+	_, err := db.SaveHighlight(ctx, model.Highlight{BookmarkID: 100, Quote: "missing", StartOffset: 0, EndOffset: 7})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing bookmark, got %v", err)
+	}
+
+	scalable, err := db.SaveHighlight(ctx, model.Highlight{
+		BookmarkID:  book.ID,
+		Quote:       "scalable",
+		Prefix:      "secure ",
+		Suffix:      " systems",
+		StartOffset: 20,
+		EndOffset:   28,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scalable.ID == 0 || scalable.Created == "" {
+		t.Errorf("unexpected saved highlight %+v", scalable)
+	}
+
+	simple, err := db.SaveHighlight(ctx, model.Highlight{
+		BookmarkID:  book.ID,
+		Quote:       "simple",
+		Prefix:      "build ",
+		Suffix:      " secure",
+		StartOffset: 6,
+		EndOffset:   12,
+		Comment:     "compared to Kubernetes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	highlights, err := db.GetHighlights(ctx, book.ID)
+	if err != nil || len(highlights) != 2 || highlights[0].ID != simple.ID || highlights[1].ID != scalable.ID ||
+		highlights[0].Prefix != "build " || highlights[0].Suffix != " secure" || highlights[0].EndOffset != 12 {
+		t.Fatalf("unexpected highlights %+v %v", highlights, err)
+	}
+
+	// Comments are searched with the content
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "Kubernetes"})
+	if err != nil || !equalIDs(bookmarkIDs(books), []int{book.ID}) {
+		t.Errorf("unexpected bookmarks with keyword of comment %+v %v", books, err)
+	}
+
+	if books, _ := db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "Kubernetes", WithoutAnnotations: true}); len(books) != 0 {
+		t.Errorf("comment is searched without annotations %+v", books)
+	}
+
+	// Update the comment, the bookmark can't be changed
+	simple.Comment = "compared to Borgmon"
+	simple.BookmarkID = book.ID + 1
+	simple, err = db.SaveHighlight(ctx, simple)
+	if err != nil || simple.BookmarkID != book.ID {
+		t.Fatalf("unexpected updated highlight %+v %v", simple, err)
+	}
+
+	if books, _ := db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "Kubernetes"}); len(books) != 0 {
+		t.Errorf("old comment is still searched %+v", books)
+	}
+
+	search, _ := ParseSearch("Borgmon")
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{Search: search})
+	if err != nil || !equalIDs(bookmarkIDs(books), []int{book.ID}) {
+		t.Errorf("unexpected bookmarks with keyword of updated comment %+v %v", books, err)
+	}
+
+	if _, err := db.SaveHighlight(ctx, model.Highlight{ID: 100, Quote: "missing", EndOffset: 7}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing highlight, got %v", err)
+	}
+
+	// Delete one highlight, then the rest with the bookmark
+	if err := db.DeleteHighlights(ctx, simple.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if books, _ := db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "Borgmon"}); len(books) != 0 {
+		t.Errorf("comment of deleted highlight is still searched %+v", books)
+	}
+
+	if highlights, _ := db.GetHighlights(ctx, book.ID); len(highlights) != 1 || highlights[0].ID != scalable.ID {
+		t.Errorf("unexpected highlights after delete %+v", highlights)
+	}
+
+	if err := db.DeleteBookmarks(ctx, book.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if highlights, _ := db.GetHighlights(ctx, book.ID); len(highlights) != 0 {
+		t.Errorf("highlights of deleted bookmark remain %+v", highlights)
+	}
+}
+
+func testReadingState(t *testing.T, db DB) {
+	ctx := context.TODO()
+	books := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Modified: "2020-01-02 03:04:05"},
+		model.Bookmark{URL: "https://example.com", Title: "example"},
+		model.Bookmark{URL: "https://example.org", Title: "example org",
+			ReadingStatus: model.StatusRead, ReadingProgress: 100},
+		model.Bookmark{URL: "https://example.net", Title: "example net"},
+	)
+
+	// New bookmark is unread
+	got, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{books[0].ID}})
+	if err != nil || len(got) != 1 || got[0].ReadingStatus != model.StatusUnread || got[0].ReadingProgress != 0 {
+		t.Fatalf("unexpected reading state of new bookmark %+v %v", got, err)
+	}
+
+	// Reading state is changed without a revision and keeps the modified time
+	if err := db.SaveReadingState(ctx, books[0].ID, model.StatusInProgress, 40); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{books[0].ID}})
+	if err != nil || len(got) != 1 || got[0].ReadingStatus != model.StatusInProgress ||
+		got[0].ReadingProgress != 40 || got[0].Modified != "2020-01-02 03:04:05" {
+		t.Errorf("unexpected bookmark after saving reading state %+v %v", got, err)
+	}
+
+	if revisions, _ := db.GetBookmarkRevisions(ctx, books[0].ID); len(revisions) != 0 {
+		t.Errorf("saving reading state shouldn't record revision %+v", revisions)
+	}
+
+	// Saving the bookmark keeps its reading state
+	if _, err := db.SaveBookmarks(ctx, false, got[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{books[0].ID}})
+	if err != nil || len(got) != 1 || got[0].ReadingStatus != model.StatusInProgress || got[0].ReadingProgress != 40 {
+		t.Errorf("unexpected reading state after saving bookmark %+v %v", got, err)
+	}
+
+	// Filter by reading status
+	got, err = db.GetBookMarks(ctx, GetBookmarksOptions{
+		ReadingStatus: []string{model.StatusUnread},
+		OrderMethod:   DefaultOrder,
+	})
+	if err != nil || !equalIDs(bookmarkIDs(got), []int{books[1].ID, books[3].ID}) {
+		t.Errorf("unexpected unread bookmarks %+v %v", got, err)
+	}
+
+	got, err = db.GetBookMarks(ctx, GetBookmarksOptions{
+		ReadingStatus: []string{model.StatusInProgress, model.StatusRead},
+		OrderMethod:   DefaultOrder,
+	})
+	if err != nil || !equalIDs(bookmarkIDs(got), []int{books[0].ID, books[2].ID}) {
+		t.Errorf("unexpected started bookmarks %+v %v", got, err)
+	}
+
+	if count, err := db.GetBookmarksCount(ctx, GetBookmarksOptions{ReadingStatus: []string{model.StatusRead}}); err != nil || count != 1 {
+		t.Errorf("unexpected count of read bookmarks %d %v", count, err)
+	}
+
+	// Oldest unread first, then the ones in progress and the read ones
+	want := []int{books[1].ID, books[3].ID, books[0].ID, books[2].ID}
+	got, err = db.GetBookMarks(ctx, GetBookmarksOptions{OrderMethod: ByUnread})
+	if err != nil || !equalIDs(bookmarkIDs(got), want) {
+		t.Errorf("unexpected unread order %v %v", bookmarkIDs(got), err)
+	}
+
+	// The order is paginated with cursor
+	opts := GetBookmarksOptions{OrderMethod: ByUnread, Limit: 3}
+	first, err := db.GetBookMarks(ctx, opts)
+	if err != nil || !equalIDs(bookmarkIDs(first), want[:3]) {
+		t.Fatalf("unexpected first page %v %v", bookmarkIDs(first), err)
+	}
+
+	next, _, err := BookmarkCursors(opts, first)
+	if err != nil || next == "" {
+		t.Fatalf("expected cursor to next page %q %v", next, err)
+	}
+
+	opts.Cursor = next
+	second, err := db.GetBookMarks(ctx, opts)
+	if err != nil || !equalIDs(bookmarkIDs(second), want[3:]) {
+		t.Errorf("unexpected second page %v %v", bookmarkIDs(second), err)
+	}
+
+	_, prev, err := BookmarkCursors(opts, second)
+	if err != nil || prev == "" {
+		t.Fatalf("expected cursor to previous page %q %v", prev, err)
+	}
+
+	opts.Cursor = prev
+	if back, err := db.GetBookMarks(ctx, opts); err != nil || !equalIDs(bookmarkIDs(back), want[:3]) {
+		t.Errorf("unexpected previous page %v %v", bookmarkIDs(back), err)
+	}
+
+	// Invalid reading state
+	if err := db.SaveReadingState(ctx, books[0].ID, "skimmed", 10); err == nil {
+		t.Error("expected error for unknown reading status")
+	}
+
+	if err := db.SaveReadingState(ctx, books[0].ID, model.StatusInProgress, 120); err == nil {
+		t.Error("expected error for progress above 100")
+	}
+
+	if _, err := db.SaveBookmarks(ctx, true, model.Bookmark{URL: "https://go.dev/doc", Title: "doc",
+		ReadingStatus: "skimmed"}); err == nil {
+		t.Error("expected error for bookmark with unknown reading status")
+	}
+
+	if err := db.SaveReadingState(ctx, 100, model.StatusRead, 100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testAccountLibraries(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	// Every account can save the same page with the same tags
+	books := saveTestBookmarks(t, db,
+		model.Bookmark{AccountID: 1, URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "lang/go"}}},
+		model.Bookmark{AccountID: 2, URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "lang/go"}}},
+		model.Bookmark{AccountID: 2, URL: "https://www.rust-lang.org", Title: "rust", Tags: []model.Tag{{Name: "lang/rust"}}},
+	)
+
+	_, err := db.SaveBookmarks(ctx, true, model.Bookmark{AccountID: 1, URL: "https://www.go.dev/", Title: "go again"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists within the account, got %v", err)
+	}
+
+	// Bookmarks are fetched for a single account, or every account with zero
+	for accountID, want := range map[int][]int{
+		0: bookmarkIDs(books),
+		1: {books[0].ID},
+		2: {books[1].ID, books[2].ID},
+		3: {},
+	} {
+		got, err := db.GetBookMarks(ctx, GetBookmarksOptions{AccountID: accountID, OrderMethod: DefaultOrder})
+		if err != nil || !equalIDs(bookmarkIDs(got), want) {
+			t.Errorf("unexpected bookmarks of account %d: %v %v", accountID, bookmarkIDs(got), err)
+		}
+	}
+
+	if count, err := db.GetBookmarksCount(ctx, GetBookmarksOptions{AccountID: 2}); err != nil || count != 2 {
+		t.Errorf("unexpected count of account bookmarks %d %v", count, err)
+	}
+
+	// Update doesn't move bookmark to another account
+	moved := books[2]
+	moved.AccountID = 1
+	if _, err := db.SaveBookmarks(ctx, false, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := db.GetBookMarks(ctx, GetBookmarksOptions{AccountID: 2}); err != nil || len(got) != 2 {
+		t.Errorf("bookmark shouldn't be moved to another account %+v %v", got, err)
+	}
+
+	// Each account has its own tags
+	tagNames := func(accountID int) (string, map[string]model.Tag) {
+		t.Helper()
+
+		tags, err := db.GetTags(ctx, accountID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := []string{}
+		byName := map[string]model.Tag{}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+			byName[tag.Name] = tag
+		}
+		return strings.Join(names, ","), byName
+	}
+
+	if names, _ := tagNames(0); names != "lang,lang,lang/go,lang/go,lang/rust" {
+		t.Errorf("unexpected tags of every account %s", names)
+	}
+	if names, _ := tagNames(1); names != "lang,lang/go" {
+		t.Errorf("unexpected tags of account 1 %s", names)
+	}
+
+	// Renaming merges into the tag of the same account only
+	_, tags := tagNames(2)
+	renamed, err := db.RenameTag(ctx, tags["lang/rust"].ID, "lang/go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.ID != tags["lang/go"].ID || renamed.AccountID != 2 {
+		t.Errorf("expected merge into the tag of account 2, got %+v", renamed)
+	}
+
+	if _, tags := tagNames(1); tags["lang/go"].NBookmarks != 1 {
+		t.Errorf("unexpected tag of account 1 after merge %+v", tags["lang/go"])
+	}
+	if names, tags := tagNames(2); names != "lang,lang/go" || tags["lang/go"].NBookmarks != 2 {
+		t.Errorf("unexpected tags of account 2 after merge %s %+v", names, tags)
+	}
+
+	// The same page of different accounts isn't a duplicate
+	if groups, err := FindDuplicates(ctx, db); err != nil || len(groups) != 0 {
+		t.Errorf("unexpected duplicates %+v %v", groups, err)
+	}
+}
+
+func testRevertAccounts(t *testing.T, db DB) {
+	ctx := context.TODO()
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Migrations) == 0 {
+		t.Skip("database has no migrations")
+	}
+	last := status.Version
+
+	owner, err := db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret", Owner: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := db.SaveAccount(ctx, model.Account{Username: "reader", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveTestBookmarks(t, db,
+		model.Bookmark{AccountID: owner.ID, URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "lang/go"}}},
+		model.Bookmark{AccountID: reader.ID, URL: "https://www.rust-lang.org", Title: "rust",
+			Tags: []model.Tag{{Name: "lang/go"}, {Name: "lang/rust"}}},
+	)
+
+	// Tags of the accounts are merged by name, as they share names again before version 9
+	if err := db.MigrateTo(8); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if strings.Join(names, ",") != "lang,lang/go,lang/rust" {
+		t.Errorf("unexpected tags after reverting accounts %v", names)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{OrderMethod: DefaultOrder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || len(books[0].Tags) != 1 || len(books[1].Tags) != 2 || books[1].Tags[0].Name != "lang/go" {
+		t.Errorf("unexpected bookmarks after reverting accounts %+v", books)
+	}
+
+	// The same URL of two accounts can't be reverted, and the schema stays as it is
+	saveTestBookmarks(t, db, model.Bookmark{AccountID: reader.ID, URL: "https://go.dev", Title: "go"})
+	if err := db.MigrateTo(8); err == nil || !strings.Contains(err.Error(), "https://go.dev") {
+		t.Errorf("expected error for URL saved by two accounts, got %v", err)
+	}
+
+	status, err = db.MigrationStatus()
+	if err != nil || status.Version != last || status.Dirty {
+		t.Errorf("unexpected status after refused revert %+v %v", status, err)
+	}
+}
+
+func testDeleteAccountData(t *testing.T, db DB) {
+	ctx := context.TODO()
+	dataDir := t.TempDir()
+	db.SetDataDir(dataDir)
+
+	reader, err := db.SaveAccount(ctx, model.Account{Username: "reader", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shiori, err := db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books := saveTestBookmarks(t, db,
+		model.Bookmark{AccountID: shiori.ID, URL: "https://go.dev", Title: "go",
+			Content: "build simple secure scalable systems", Tags: []model.Tag{{Name: "lang/go"}}},
+		model.Bookmark{AccountID: reader.ID, URL: "https://go.dev", Title: "go", Tags: []model.Tag{{Name: "lang/go"}}},
+	)
+	writeBookmarkFiles(t, dataDir, bookmarkIDs(books)...)
+
+	book := books[0]
+	book.Title = "Go"
+	if _, err := db.SaveBookmarks(ctx, false, book); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SaveHighlight(ctx, model.Highlight{BookmarkID: book.ID, Quote: "simple", StartOffset: 6, EndOffset: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything of the account is removed with it, other accounts keep theirs
+	if err := db.DeleteAccounts(ctx, "shiori"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := db.GetBookMarks(ctx, GetBookmarksOptions{}); err != nil || !equalIDs(bookmarkIDs(got), []int{books[1].ID}) {
+		t.Errorf("unexpected bookmarks after deleting account %v %v", bookmarkIDs(got), err)
+	}
+
+	if revisions, _ := db.GetBookmarkRevisions(ctx, book.ID); len(revisions) != 0 {
+		t.Errorf("revisions of deleted account remain %+v", revisions)
+	}
+
+	if highlights, _ := db.GetHighlights(ctx, book.ID); len(highlights) != 0 {
+		t.Errorf("highlights of deleted account remain %+v", highlights)
+	}
+
+	if tags, _ := db.GetTags(ctx, shiori.ID); len(tags) != 0 {
+		t.Errorf("tags of deleted account remain %+v", tags)
+	}
+
+	if tags, _ := db.GetTags(ctx, reader.ID); len(tags) != 2 {
+		t.Errorf("unexpected tags of other account %+v", tags)
+	}
+
+	for _, dir := range bookmarkFileDirs {
+		if got := bookmarkFiles(t, dataDir, dir); got != strconv.Itoa(books[1].ID) {
+			t.Errorf("unexpected %s files after deleting account %s", dir, got)
+		}
+	}
+
+	// The ID of deleted account isn't given to the next one
+	account, err := db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.ID == shiori.ID {
+		t.Errorf("ID %d of deleted account is reused", account.ID)
+	}
+
+	if got, err := db.GetBookMarks(ctx, GetBookmarksOptions{AccountID: account.ID}); err != nil || len(got) != 0 {
+		t.Errorf("new account has bookmarks %v %v", bookmarkIDs(got), err)
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"io"
+	"os"
+	fp "path/filepath"
+	"strconv"
+)
+
+// bookmarkFileDirs is the dirs in data dir that have a file for each bookmark,
+// named after the bookmark ID.
+var bookmarkFileDirs = []string{"thumb", "archive"}
+
+// removeBookmarkFiles removes the thumbnail image and archive of the bookmarks
+// from data dir. Nothing is removed when there is no data dir.
+func removeBookmarkFiles(dataDir string, ids ...int) error {
+	if dataDir == "" {
+		return nil
+	}
+
+	for _, id := range ids {
+		for _, dir := range bookmarkFileDirs {
+			err := os.Remove(fp.Join(dataDir, dir, strconv.Itoa(id)))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyMissingBookmarkFiles gives the kept bookmark the first thumbnail image and
+// archive of the other bookmarks when it doesn't have one. The files are copied,
+// so nothing is lost when the other bookmarks aren't deleted after all.
+func copyMissingBookmarkFiles(dataDir string, keepID int, ids ...int) error {
+	if dataDir == "" {
+		return nil
+	}
+
+	for _, dir := range bookmarkFileDirs {
+		keepPath := fp.Join(dataDir, dir, strconv.Itoa(keepID))
+		if _, err := os.Stat(keepPath); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		for _, id := range ids {
+			err := copyFile(fp.Join(dataDir, dir, strconv.Itoa(id)), keepPath)
+			if err == nil {
+				break
+			}
+			if !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the file in src to dst, which must not exist yet.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return dstFile.Close()
+}
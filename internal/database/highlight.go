@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+// annotationsQuery updates the searched text of notes and highlights of bookmark,
+// it's stored in the bookmark table except for SQLite.
+const annotationsQuery = `UPDATE bookmark SET annotations = ? WHERE id = ?`
+
+// validateHighlight checks that highlight has a quote and its offsets are a valid range.
+func validateHighlight(highlight model.Highlight) error {
+	if strings.TrimSpace(highlight.Quote) == "" {
+		return errors.New("quote of highlight must not be empty")
+	}
+
+	if highlight.StartOffset < 0 || highlight.EndOffset <= highlight.StartOffset {
+		return errors.Errorf("invalid offsets of highlight %d-%d", highlight.StartOffset, highlight.EndOffset)
+	}
+
+	return nil
+}
+
+// annotationText returns the text of notes and highlights that is searched
+// together with the content of bookmark.
+func annotationText(notes string, highlights []model.Highlight) string {
+	texts := []string{}
+	if notes != "" {
+		texts = append(texts, notes)
+	}
+
+	for _, highlight := range highlights {
+		texts = append(texts, highlight.Quote)
+		if highlight.Comment != "" {
+			texts = append(texts, highlight.Comment)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// saveAnnotations updates the searched text of notes and highlights of bookmark.
+// updateQuery sets the text of the bookmark, with the text and bookmark ID as arguments.
+func saveAnnotations(ctx context.Context, tx *sqlx.Tx, bookmarkID int, updateQuery string) error {
+	var notes string
+	err := tx.GetContext(ctx, &notes, tx.Rebind(`SELECT notes FROM bookmark WHERE id = ?`), bookmarkID)
+	if err == sql.ErrNoRows {
+		return errors.Wrapf(ErrNotFound, "bookmark %d", bookmarkID)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	highlights := []model.Highlight{}
+	err = tx.SelectContext(ctx, &highlights, tx.Rebind(`SELECT quote, comment
+		FROM highlight
+		WHERE bookmark_id = ?
+		ORDER BY start_offset, id`), bookmarkID)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.WithStack(err)
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(updateQuery), annotationText(notes, highlights), bookmarkID)
+	return errors.WithStack(err)
+}
+
+// saveBookmarkNotes replaces the notes of bookmark, then updates its searched text.
+func saveBookmarkNotes(ctx context.Context, tx *sqlx.Tx, bookmarkID int, notes string, updateQuery string) error {
+	_, err := tx.ExecContext(ctx, tx.Rebind(`UPDATE bookmark SET notes = ? WHERE id = ?`), notes, bookmarkID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The missing bookmark is reported by saveAnnotations
+	return saveAnnotations(ctx, tx, bookmarkID, updateQuery)
+}
+
+// getHighlights fetch the highlights of bookmark, ordered by their position in the content.
+// createdColumn is the expression that selects created time as "2006-01-02 15:04:05".
+func getHighlights(ctx context.Context, db sqlx.ExtContext, bookmarkID int, createdColumn string) ([]model.Highlight, error) {
+	highlights := []model.Highlight{}
+	err := sqlx.SelectContext(ctx, db, &highlights, db.Rebind(`SELECT id, bookmark_id,
+		`+createdColumn+` created, quote, prefix, suffix, start_offset, end_offset, comment
+		FROM highlight
+		WHERE bookmark_id = ?
+		ORDER BY start_offset, id`), bookmarkID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	return highlights, nil
+}
+
+// getHighlight fetch a single highlight with matching ID.
+// createdColumn is the expression that selects created time as "2006-01-02 15:04:05".
+func getHighlight(ctx context.Context, db sqlx.ExtContext, id int, createdColumn string) (model.Highlight, error) {
+	highlight := model.Highlight{}
+	err := sqlx.GetContext(ctx, db, &highlight, db.Rebind(`SELECT id, bookmark_id,
+		`+createdColumn+` created, quote, prefix, suffix, start_offset, end_offset, comment
+		FROM highlight
+		WHERE id = ?`), id)
+	if err == sql.ErrNoRows {
+		return highlight, errors.Wrapf(ErrNotFound, "highlight %d", id)
+	}
+
+	return highlight, errors.WithStack(err)
+}
+
+// highlightInserter inserts new highlight and returns its ID.
+type highlightInserter func(ctx context.Context, tx *sqlx.Tx, highlight model.Highlight) (int, error)
+
+// saveHighlight creates new highlight with insert, or updates the one with matching ID,
+// then updates the searched text of its bookmark. The bookmark of highlight isn't changed.
+// createdColumn is the expression that selects created time as "2006-01-02 15:04:05".
+func saveHighlight(ctx context.Context, tx *sqlx.Tx, highlight model.Highlight,
+	createdColumn string, updateQuery string, insert highlightInserter) (model.Highlight, error) {
+	if err := validateHighlight(highlight); err != nil {
+		return highlight, err
+	}
+
+	if highlight.ID == 0 {
+		var nBookmarks int
+		err := tx.GetContext(ctx, &nBookmarks, tx.Rebind(`SELECT COUNT(id) FROM bookmark WHERE id = ?`), highlight.BookmarkID)
+		if err != nil {
+			return highlight, errors.WithStack(err)
+		}
+		if nBookmarks == 0 {
+			return highlight, errors.Wrapf(ErrNotFound, "bookmark %d", highlight.BookmarkID)
+		}
+
+		if highlight.Created == "" {
+			highlight.Created = time.Now().UTC().Format("2006-01-02 15:04:05")
+		}
+
+		highlight.ID, err = insert(ctx, tx, highlight)
+		if err != nil {
+			return highlight, err
+		}
+	} else {
+		existing := model.Highlight{}
+		err := tx.GetContext(ctx, &existing, tx.Rebind(`SELECT bookmark_id, `+createdColumn+` created
+			FROM highlight WHERE id = ?`), highlight.ID)
+		if err == sql.ErrNoRows {
+			return highlight, errors.Wrapf(ErrNotFound, "highlight %d", highlight.ID)
+		}
+		if err != nil {
+			return highlight, errors.WithStack(err)
+		}
+		highlight.BookmarkID = existing.BookmarkID
+		highlight.Created = existing.Created
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE highlight SET
+			quote = ?, prefix = ?, suffix = ?, start_offset = ?, end_offset = ?, comment = ?
+			WHERE id = ?`),
+			highlight.Quote, highlight.Prefix, highlight.Suffix,
+			highlight.StartOffset, highlight.EndOffset, highlight.Comment, highlight.ID)
+		if err != nil {
+			return highlight, errors.WithStack(err)
+		}
+	}
+
+	return highlight, saveAnnotations(ctx, tx, highlight.BookmarkID, updateQuery)
+}
+
+// deleteHighlights removes the highlights with matching IDs, then updates
+// the searched text of their bookmarks.
+func deleteHighlights(ctx context.Context, tx *sqlx.Tx, ids []int, updateQuery string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(`SELECT DISTINCT bookmark_id FROM highlight WHERE id IN (?)`, ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	bookmarkIDs := []int{}
+	if err := tx.SelectContext(ctx, &bookmarkIDs, tx.Rebind(query), args...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	query, args, err = sqlx.In(`DELETE FROM highlight WHERE id IN (?)`, ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, bookmarkID := range bookmarkIDs {
+		if err := saveAnnotations(ctx, tx, bookmarkID, updateQuery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
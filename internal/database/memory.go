@@ -0,0 +1,1373 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+)
+
+// MemoryDatabase is implementation of Database interface that keeps
+// everything in memory, with the same behavior as SQLite database.
+// It's meant for tests and throwaway demo instances, all data is lost
+// when the process exits.
+type MemoryDatabase struct {
+	mu            sync.RWMutex
+	data          *memoryData
+	revisionLimit int
+	dataDir       string
+
+	// deletedIDs is the bookmarks deleted inside WithTx,
+	// their files are removed once the transaction is committed.
+	deletedIDs *[]int
+}
+
+// memoryData is the content of MemoryDatabase. It's never changed in place:
+// every change is made on a copy that replaces it when the change succeeds,
+// the same way a transaction is committed or rolled back.
+type memoryData struct {
+	// bookmarks is stored without their tags
+	bookmarks map[int]model.Bookmark
+	// bookmarkTags is the set of tag IDs for each bookmark ID
+	bookmarkTags map[int]map[int]bool
+	tags         map[int]model.Tag
+	// revisions is ordered by their ID
+	revisions []model.BookmarkRevision
+	// accounts is stored with their password hash
+	accounts      map[int]model.Account
+	savedSearches map[int]model.SavedSearch
+	highlights    map[int]model.Highlight
+	// lastID is the last generated ID of each record type
+	lastID map[string]int
+}
+
+// NewMemoryDatabase creates new empty in-memory database.
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{
+		data: &memoryData{
+			bookmarks:     map[int]model.Bookmark{},
+			bookmarkTags:  map[int]map[int]bool{},
+			tags:          map[int]model.Tag{},
+			revisions:     []model.BookmarkRevision{},
+			accounts:      map[int]model.Account{},
+			savedSearches: map[int]model.SavedSearch{},
+			highlights:    map[int]model.Highlight{},
+			lastID:        map[string]int{},
+		},
+		revisionLimit: DefaultRevisionLimit,
+	}
+}
+
+// snapshot returns the current data for reading.
+func (db *MemoryDatabase) snapshot() *memoryData {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.data
+}
+
+// update runs fn with a copy of the data. The copy replaces
+// the data when fn succeeds, otherwise it's discarded.
+func (db *MemoryDatabase) update(fn func(data *memoryData) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	data := db.data.clone()
+	if err := fn(data); err != nil {
+		return err
+	}
+
+	db.data = data
+	return nil
+}
+
+func (data *memoryData) clone() *memoryData {
+	result := &memoryData{
+		bookmarks:     make(map[int]model.Bookmark, len(data.bookmarks)),
+		bookmarkTags:  make(map[int]map[int]bool, len(data.bookmarkTags)),
+		tags:          make(map[int]model.Tag, len(data.tags)),
+		revisions:     append([]model.BookmarkRevision{}, data.revisions...),
+		accounts:      make(map[int]model.Account, len(data.accounts)),
+		savedSearches: make(map[int]model.SavedSearch, len(data.savedSearches)),
+		highlights:    make(map[int]model.Highlight, len(data.highlights)),
+		lastID:        make(map[string]int, len(data.lastID)),
+	}
+
+	for id, book := range data.bookmarks {
+		result.bookmarks[id] = book
+	}
+	for id, tagIDs := range data.bookmarkTags {
+		result.bookmarkTags[id] = make(map[int]bool, len(tagIDs))
+		for tagID := range tagIDs {
+			result.bookmarkTags[id][tagID] = true
+		}
+	}
+	for id, tag := range data.tags {
+		result.tags[id] = tag
+	}
+	for id, account := range data.accounts {
+		result.accounts[id] = account
+	}
+	for id, search := range data.savedSearches {
+		result.savedSearches[id] = search
+	}
+	for id, highlight := range data.highlights {
+		result.highlights[id] = highlight
+	}
+	for name, id := range data.lastID {
+		result.lastID[name] = id
+	}
+
+	return result
+}
+
+// nextID generates ID for new record, like auto increment column.
+func (data *memoryData) nextID(record string) int {
+	data.lastID[record]++
+	return data.lastID[record]
+}
+
+// keepID returns the ID that was set for new record, or generates it when it's 0.
+// Like auto increment column, the generated IDs continue after the largest ID.
+func (data *memoryData) keepID(record string, id int) int {
+	if id == 0 {
+		return data.nextID(record)
+	}
+
+	if id > data.lastID[record] {
+		data.lastID[record] = id
+	}
+	return id
+}
+
+// Migrate does nothing, in-memory database has no schema to migrate.
+func (db *MemoryDatabase) Migrate() error {
+	return nil
+}
+
+// MigrateSteps fails for any steps, in-memory database has no migrations.
+func (db *MemoryDatabase) MigrateSteps(n int) error {
+	if n == 0 {
+		return nil
+	}
+	return errors.Errorf("only 0 of %d migrations were run", abs(n))
+}
+
+// MigrateTo fails for any version but 0, in-memory database has no migrations.
+func (db *MemoryDatabase) MigrateTo(version uint) error {
+	if version == 0 {
+		return nil
+	}
+	return errors.Errorf("migration version %d doesn't exist", version)
+}
+
+// MigrationStatus reports an empty list of migrations.
+func (db *MemoryDatabase) MigrationStatus() (MigrationStatus, error) {
+	return MigrationStatus{}, nil
+}
+
+// SaveBookmarks saves new or updated bookmarks to database.
+// When create is true the bookmarks are inserted, otherwise they are updated by ID.
+// Returns the saved bookmarks with their IDs filled in.
+func (db *MemoryDatabase) SaveBookmarks(ctx context.Context, create bool, bookmarks ...model.Bookmark) ([]model.Bookmark, error) {
+	result := []model.Bookmark{}
+
+	err := db.update(func(data *memoryData) error {
+		// Prepare modified time
+		modifiedTime := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+		for _, book := range bookmarks {
+			// Check URL and title
+			if book.URL == "" {
+				return errors.New("URL must not be empty")
+			}
+
+			if book.Title == "" {
+				return errors.New("title must not be empty")
+			}
+
+			// Set modified time
+			if book.Modified == "" {
+				book.Modified = modifiedTime
+			}
+
+			// Check reading state, new bookmark is unread
+			var err error
+			book.ReadingStatus, err = validateReadingState(book.ReadingStatus, book.ReadingProgress)
+			if err != nil {
+				return err
+			}
+
+			// Create or update bookmark, the same page must not be saved twice
+			// by the account. The account of bookmark isn't changed by update.
+			if create {
+				_, exist := data.bookmarks[book.ID]
+				if exist || data.bookmarkIDByURL(book.AccountID, book.URL) != 0 {
+					return errors.Wrap(ErrAlreadyExists, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				// A new ID is generated unless the bookmark already has one
+				book.ID = data.keepID("bookmark", book.ID)
+			} else {
+				old, ok := data.bookmarks[book.ID]
+				if !ok {
+					return errors.Wrapf(ErrNotFound, "bookmark %d", book.ID)
+				}
+				book.AccountID = old.AccountID
+
+				existingID := data.bookmarkIDByURL(book.AccountID, book.URL)
+				if existingID != 0 && existingID != book.ID {
+					return errors.Wrap(ErrAlreadyExists, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				// Keep the current state as revision before updating it
+				data.saveRevision(old, db.revisionLimit)
+				book.DeletedAt = old.DeletedAt
+			}
+
+			data.bookmarks[book.ID] = model.Bookmark{
+				ID:        book.ID,
+				AccountID: book.AccountID,
+				URL:       book.URL,
+				Title:     book.Title,
+				Excerpt:   book.Excerpt,
+				Author:    book.Author,
+				Public:    book.Public,
+				Modified:  book.Modified,
+				DeletedAt: book.DeletedAt,
+				Content:   book.Content,
+				HTML:      book.HTML,
+				Notes:     book.Notes,
+
+				ReadingStatus:   book.ReadingStatus,
+				ReadingProgress: book.ReadingProgress,
+			}
+			book.HasContent = book.Content != ""
+
+			// Save bookmark tags
+			tagIDs := data.bookmarkTags[book.ID]
+			if tagIDs == nil {
+				tagIDs = map[int]bool{}
+				data.bookmarkTags[book.ID] = tagIDs
+			}
+
+			newTags := []model.Tag{}
+			for _, tag := range book.Tags {
+				// Normalize tag name
+				tag.Name = normalizeTagName(tag.Name)
+
+				// Tag is found by its name within the account of bookmark, its ID is
+				// only used without name and must belong to the account as well
+				if tag.Name != "" {
+					tag.ID = data.tagIDByName(book.AccountID, tag.Name)
+				} else if tag.ID != 0 {
+					if existing, ok := data.tags[tag.ID]; !ok || existing.AccountID != book.AccountID {
+						return errors.Wrapf(ErrNotFound, "tag %d", tag.ID)
+					}
+				}
+
+				// If it's deleted tag, delete and continue
+				if tag.Deleted {
+					delete(tagIDs, tag.ID)
+					continue
+				}
+
+				// If tag doesn't exist, create it with its missing parents
+				if tag.ID == 0 {
+					if tag.Name == "" {
+						continue
+					}
+					tag.ID = data.saveTag(book.AccountID, tag.Name)
+				}
+
+				tagIDs[tag.ID] = true
+				newTags = append(newTags, tag)
+			}
+
+			book.Tags = newTags
+			result = append(result, book)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// bookmarkIDByURL returns the ID of the account's bookmark with the same canonical URL.
+func (data *memoryData) bookmarkIDByURL(accountID int, url string) int {
+	canonicalURL := CanonicalURL(url)
+	for id, book := range data.bookmarks {
+		if book.AccountID == accountID && CanonicalURL(book.URL) == canonicalURL {
+			return id
+		}
+	}
+	return 0
+}
+
+// bookmarkTags returns the tags of bookmark ordered by name.
+func (data *memoryData) bookmarkTagList(bookmarkID int) []model.Tag {
+	tags := []model.Tag{}
+	for tagID := range data.bookmarkTags[bookmarkID] {
+		tag := data.tags[tagID]
+		tags = append(tags, model.Tag{ID: tag.ID, Name: tag.Name})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags
+}
+
+// memoryOrders is the sort order of bookmarks for each OrderMethod.
+// The key is the bookmark field, see memoryOrderKey.
+var memoryOrders = map[OrderMethod]orderSpec{
+	DefaultOrder:   {},
+	ByLastAdded:    {desc: true},
+	ByLastModified: {key: "modified", desc: true},
+	ByTitle:        {key: "title"},
+	ByURL:          {key: "url"},
+	ByUnread:       {key: "reading_status"},
+}
+
+// memoryOrderKey returns the sort key of the bookmark,
+// the same as the key expression of SQLite.
+func memoryOrderKey(order orderSpec, book model.Bookmark) string {
+	switch order.key {
+	case "modified":
+		return book.Modified
+	case "title":
+		return strings.ToLower(book.Title)
+	case "url":
+		return strings.ToLower(urlWithoutScheme(book.URL))
+	case "reading_status":
+		return statusRank(book.ReadingStatus)
+	default:
+		return ""
+	}
+}
+
+// memoryCompare compares two bookmarks in ascending order of their key and ID.
+func memoryCompare(keyA string, idA int, keyB string, idB int) int {
+	switch {
+	case keyA < keyB:
+		return -1
+	case keyA > keyB:
+		return 1
+	case idA < idB:
+		return -1
+	case idA > idB:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// GetBookMarks fetch list of bookmarks based on submitted options.
+func (db *MemoryDatabase) GetBookMarks(ctx context.Context, opts GetBookmarksOptions) ([]model.Bookmark, error) {
+	order, cursor, err := orderAndCursor(memoryOrders, &opts)
+	if err != nil {
+		return nil, err
+	}
+	keywords := opts.keywords()
+	orderByRelevance := opts.OrderMethod == ByRelevance && len(keywords) > 0
+	backward := cursor != nil && cursor.Backward
+
+	data := db.snapshot()
+
+	ids := map[int]bool{}
+	for _, id := range opts.IDs {
+		ids[id] = true
+	}
+
+	archives := map[int]bool{}
+	for _, id := range opts.ArchiveIDs {
+		archives[id] = true
+	}
+
+	statuses := map[string]bool{}
+	for _, status := range opts.ReadingStatus {
+		statuses[status] = true
+	}
+
+	tags, includeAllTags := normalizeTagFilter(opts.Tags)
+	excludedTags, excludeAllTags := normalizeTagFilter(opts.ExcludedTags)
+
+	var cursorKey string
+	if cursor != nil {
+		cursorKey = cursor.Key
+		if order.key == "title" || order.key == "url" {
+			cursorKey = strings.ToLower(cursorKey)
+		}
+	}
+
+	// Find the matching bookmarks. The relevance is the number of times
+	// the keywords appear in the title and content.
+	bookmarks := []model.Bookmark{}
+	relevance := map[int]int{}
+	for _, book := range data.bookmarks {
+		if (book.DeletedAt != "") != opts.Trashed {
+			continue
+		}
+
+		if len(ids) > 0 && !ids[book.ID] {
+			continue
+		}
+
+		if opts.AccountID != 0 && book.AccountID != opts.AccountID {
+			continue
+		}
+
+		if len(statuses) > 0 && !statuses[book.ReadingStatus] {
+			continue
+		}
+
+		annotations := ""
+		if !opts.WithoutAnnotations {
+			annotations = data.annotations(book)
+		}
+
+		if opts.Keyword != "" && !memoryMatchTerm(SearchTerm{Value: opts.Keyword}, book, annotations, nil, nil) {
+			continue
+		}
+
+		for _, word := range keywords {
+			word = strings.ToLower(word)
+			relevance[book.ID] += strings.Count(strings.ToLower(book.Title), word) +
+				strings.Count(strings.ToLower(book.Content), word) +
+				strings.Count(strings.ToLower(annotations), word)
+		}
+
+		// Tags match their descendants as well
+		tagNames := []string{}
+		for _, tag := range data.bookmarkTagList(book.ID) {
+			tagNames = append(tagNames, tag.Name)
+		}
+
+		if excludeAllTags && len(tagNames) > 0 {
+			continue
+		} else if !excludeAllTags && includeAllTags && len(tagNames) == 0 {
+			continue
+		}
+
+		if !memoryHasAllTags(tagNames, tags) || memoryHasAnyTag(tagNames, excludedTags) {
+			continue
+		}
+
+		if !memoryMatchSearch(opts.Search, book, annotations, tagNames, archives) {
+			continue
+		}
+
+		// Only keep bookmarks after the cursor, or before it when backward
+		if cursor != nil {
+			cmp := memoryCompare(memoryOrderKey(order, book), book.ID, cursorKey, cursor.ID)
+			if (order.desc == cursor.Backward && cmp <= 0) || (order.desc != cursor.Backward && cmp >= 0) {
+				continue
+			}
+		}
+
+		bookmarks = append(bookmarks, book)
+	}
+
+	// Sort the bookmarks. The better matches come first when ordered by relevance,
+	// and the order is reversed for backward cursor.
+	descending := order.desc != backward
+	sort.Slice(bookmarks, func(i, j int) bool {
+		a, b := bookmarks[i], bookmarks[j]
+		if orderByRelevance {
+			if relevance[a.ID] != relevance[b.ID] {
+				return relevance[a.ID] > relevance[b.ID]
+			}
+			return a.ID > b.ID
+		}
+
+		cmp := memoryCompare(memoryOrderKey(order, a), a.ID, memoryOrderKey(order, b), b.ID)
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	// Apply limit and offset
+	if opts.Limit > 0 {
+		offset := 0
+		if cursor == nil && opts.Offset > 0 {
+			offset = opts.Offset
+		}
+
+		if offset > len(bookmarks) {
+			offset = len(bookmarks)
+		}
+		bookmarks = bookmarks[offset:]
+
+		if len(bookmarks) > opts.Limit {
+			bookmarks = bookmarks[:opts.Limit]
+		}
+	}
+
+	if backward {
+		reverseBookmarks(bookmarks)
+	}
+
+	// Fill in tags, and content when needed
+	for i := range bookmarks {
+		bookmarks[i].Tags = data.bookmarkTagList(bookmarks[i].ID)
+		bookmarks[i].HasContent = bookmarks[i].Content != ""
+		if !opts.WithContent {
+			bookmarks[i].Content = ""
+			bookmarks[i].HTML = ""
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// GetBookmarksCount returns the number of bookmarks that match opts.
+func (db *MemoryDatabase) GetBookmarksCount(ctx context.Context, opts GetBookmarksOptions) (int, error) {
+	opts.Limit, opts.Offset, opts.Cursor = 0, 0, ""
+	opts.OrderMethod = DefaultOrder
+	opts.WithContent = false
+
+	bookmarks, err := db.GetBookMarks(ctx, opts)
+	return len(bookmarks), err
+}
+
+// memoryHasAllTags checks whether every tag in filter, or one of its descendants, is in names.
+func memoryHasAllTags(names, filter []string) bool {
+	for _, tag := range filter {
+		if !memoryHasAnyTag(names, []string{tag}) {
+			return false
+		}
+	}
+	return true
+}
+
+// memoryHasAnyTag checks whether any tag in filter, or one of its descendants, is in names.
+func memoryHasAnyTag(names, filter []string) bool {
+	for _, tag := range filter {
+		for _, name := range names {
+			if name == tag || strings.HasPrefix(name, tag+tagSeparator) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetDuplicateIDs returns the IDs of bookmarks of the same page, see DB.
+func (db *MemoryDatabase) GetDuplicateIDs(ctx context.Context) ([][]int, error) {
+	data := db.snapshot()
+
+	rows := []duplicateRow{}
+	for _, book := range data.bookmarks {
+		rows = append(rows, duplicateRow{ID: book.ID, AccountID: book.AccountID, CanonicalURL: CanonicalURL(book.URL)})
+	}
+
+	return groupDuplicateIDs(rows), nil
+}
+
+// DeleteBookmarks removes all record with matching ids from database.
+// Without ids all bookmarks are removed.
+func (db *MemoryDatabase) DeleteBookmarks(ctx context.Context, ids ...int) error {
+	err := db.update(func(data *memoryData) error {
+		ids = data.deleteBookmarks(ids)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// deleteBookmarkFiles removes the files of deleted bookmarks,
+// or leaves them to WithTx when it's inside of it.
+func (db *MemoryDatabase) deleteBookmarkFiles(ids []int) error {
+	if db.deletedIDs != nil {
+		*db.deletedIDs = append(*db.deletedIDs, ids...)
+		return nil
+	}
+
+	return removeBookmarkFiles(db.dataDir, ids...)
+}
+
+// deleteBookmarks removes bookmarks with matching ids, or all of them when
+// there are no ids, along with their tag links, revisions and highlights. The tags that
+// are no longer used by any bookmark are removed as well. Returns the removed IDs.
+func (data *memoryData) deleteBookmarks(ids []int) []int {
+	if len(ids) == 0 {
+		for id := range data.bookmarks {
+			ids = append(ids, id)
+		}
+	}
+
+	deleted := map[int]bool{}
+	for _, id := range ids {
+		delete(data.bookmarks, id)
+		delete(data.bookmarkTags, id)
+		deleted[id] = true
+	}
+
+	revisions := []model.BookmarkRevision{}
+	for _, revision := range data.revisions {
+		if !deleted[revision.BookmarkID] {
+			revisions = append(revisions, revision)
+		}
+	}
+	data.revisions = revisions
+
+	for id, highlight := range data.highlights {
+		if deleted[highlight.BookmarkID] {
+			delete(data.highlights, id)
+		}
+	}
+
+	data.removeUnusedTags()
+	return ids
+}
+
+// TrashBookmarks moves bookmarks with matching ids to trash.
+// Without ids all bookmarks are moved.
+func (db *MemoryDatabase) TrashBookmarks(ctx context.Context, ids ...int) error {
+	deletedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	return db.update(func(data *memoryData) error {
+		data.setBookmarksDeletedAt(ids, deletedAt)
+		return nil
+	})
+}
+
+// RestoreBookmarks restores bookmarks with matching ids from trash.
+// Without ids all bookmarks in trash are restored.
+func (db *MemoryDatabase) RestoreBookmarks(ctx context.Context, ids ...int) error {
+	return db.update(func(data *memoryData) error {
+		data.setBookmarksDeletedAt(ids, "")
+		return nil
+	})
+}
+
+// setBookmarksDeletedAt moves bookmarks to trash by setting their DeletedAt,
+// or restores them when deletedAt is empty. The bookmarks that are already
+// in the requested state are left untouched.
+func (data *memoryData) setBookmarksDeletedAt(ids []int, deletedAt string) {
+	if len(ids) == 0 {
+		for id := range data.bookmarks {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range ids {
+		book, ok := data.bookmarks[id]
+		if !ok || (book.DeletedAt == "") == (deletedAt == "") {
+			continue
+		}
+
+		book.DeletedAt = deletedAt
+		data.bookmarks[id] = book
+	}
+}
+
+// PurgeBookmarks permanently removes the bookmarks that were moved to trash
+// before olderThan. Returns the ids of removed bookmarks.
+func (db *MemoryDatabase) PurgeBookmarks(ctx context.Context, olderThan time.Time) ([]int, error) {
+	ids := []int{}
+	limit := olderThan.UTC().Format("2006-01-02 15:04:05")
+
+	err := db.update(func(data *memoryData) error {
+		for id, book := range data.bookmarks {
+			if book.DeletedAt != "" && book.DeletedAt < limit {
+				ids = append(ids, id)
+			}
+		}
+		sort.Ints(ids)
+
+		// Without ids deleteBookmarks removes everything
+		if len(ids) > 0 {
+			data.deleteBookmarks(ids)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, db.deleteBookmarkFiles(ids)
+}
+
+// SetRevisionLimit sets how many revisions are kept for each bookmark.
+func (db *MemoryDatabase) SetRevisionLimit(limit int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.revisionLimit = limit
+}
+
+// SetDataDir sets the data dir that has the archives and thumbnails of bookmarks.
+func (db *MemoryDatabase) SetDataDir(dir string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.dataDir = dir
+}
+
+// DataDir returns the data dir set by SetDataDir.
+func (db *MemoryDatabase) DataDir() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.dataDir
+}
+
+// saveRevision records the state of the bookmark, then removes its
+// oldest revisions so at most limit revisions are kept.
+func (data *memoryData) saveRevision(book model.Bookmark, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	tags := []string{}
+	for _, tag := range data.bookmarkTagList(book.ID) {
+		tags = append(tags, tag.Name)
+	}
+
+	data.revisions = append(data.revisions, model.BookmarkRevision{
+		ID:         data.nextID("bookmark_revision"),
+		BookmarkID: book.ID,
+		Created:    time.Now().UTC().Format("2006-01-02 15:04:05"),
+		Title:      book.Title,
+		Excerpt:    book.Excerpt,
+		Tags:       tags,
+		Content:    book.Content,
+		HTML:       book.HTML,
+	})
+
+	// Remove the revisions beyond the limit
+	count := 0
+	for _, revision := range data.revisions {
+		if revision.BookmarkID == book.ID {
+			count++
+		}
+	}
+
+	revisions := []model.BookmarkRevision{}
+	for _, revision := range data.revisions {
+		if revision.BookmarkID == book.ID && count > limit {
+			count--
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	data.revisions = revisions
+}
+
+// GetBookmarkRevisions fetch the revisions of a bookmark, newest first.
+func (db *MemoryDatabase) GetBookmarkRevisions(ctx context.Context, bookmarkID int) ([]model.BookmarkRevision, error) {
+	data := db.snapshot()
+
+	revisions := []model.BookmarkRevision{}
+	for i := len(data.revisions) - 1; i >= 0; i-- {
+		if revision := data.revisions[i]; revision.BookmarkID == bookmarkID {
+			revision.Content = ""
+			revision.HTML = ""
+			revisions = append(revisions, revision)
+		}
+	}
+
+	return revisions, nil
+}
+
+// GetBookmarkRevision fetch a revision including its content.
+func (db *MemoryDatabase) GetBookmarkRevision(ctx context.Context, id int) (model.BookmarkRevision, error) {
+	for _, revision := range db.snapshot().revisions {
+		if revision.ID == id {
+			return revision, nil
+		}
+	}
+
+	return model.BookmarkRevision{}, errors.Wrapf(ErrNotFound, "revision %d", id)
+}
+
+// RollbackBookmark restores the bookmark to the state of the revision.
+func (db *MemoryDatabase) RollbackBookmark(ctx context.Context, revisionID int) (model.Bookmark, error) {
+	return rollbackBookmark(ctx, db, revisionID)
+}
+
+// SaveBookmarkNotes replaces the Markdown notes of bookmark.
+func (db *MemoryDatabase) SaveBookmarkNotes(ctx context.Context, bookmarkID int, notes string) error {
+	return db.update(func(data *memoryData) error {
+		book, ok := data.bookmarks[bookmarkID]
+		if !ok {
+			return errors.Wrapf(ErrNotFound, "bookmark %d", bookmarkID)
+		}
+
+		book.Notes = notes
+		data.bookmarks[bookmarkID] = book
+		return nil
+	})
+}
+
+// SaveReadingState updates the reading status and progress of bookmark.
+func (db *MemoryDatabase) SaveReadingState(ctx context.Context, bookmarkID int, status string, progress int) error {
+	status, err := validateReadingState(status, progress)
+	if err != nil {
+		return err
+	}
+
+	return db.update(func(data *memoryData) error {
+		book, ok := data.bookmarks[bookmarkID]
+		if !ok {
+			return errors.Wrapf(ErrNotFound, "bookmark %d", bookmarkID)
+		}
+
+		book.ReadingStatus = status
+		book.ReadingProgress = progress
+		data.bookmarks[bookmarkID] = book
+		return nil
+	})
+}
+
+// GetHighlights fetch the highlights of bookmark, ordered by their position in the content.
+func (db *MemoryDatabase) GetHighlights(ctx context.Context, bookmarkID int) ([]model.Highlight, error) {
+	return db.snapshot().highlightList(bookmarkID), nil
+}
+
+// GetHighlight fetch a single highlight with matching ID.
+func (db *MemoryDatabase) GetHighlight(ctx context.Context, id int) (model.Highlight, error) {
+	highlight, ok := db.snapshot().highlights[id]
+	if !ok {
+		return highlight, errors.Wrapf(ErrNotFound, "highlight %d", id)
+	}
+	return highlight, nil
+}
+
+// SaveHighlight creates new highlight of the bookmark, or updates the one with matching ID.
+func (db *MemoryDatabase) SaveHighlight(ctx context.Context, highlight model.Highlight) (model.Highlight, error) {
+	if err := validateHighlight(highlight); err != nil {
+		return highlight, err
+	}
+
+	err := db.update(func(data *memoryData) error {
+		if highlight.ID == 0 {
+			if _, ok := data.bookmarks[highlight.BookmarkID]; !ok {
+				return errors.Wrapf(ErrNotFound, "bookmark %d", highlight.BookmarkID)
+			}
+
+			if highlight.Created == "" {
+				highlight.Created = time.Now().UTC().Format("2006-01-02 15:04:05")
+			}
+			highlight.ID = data.nextID("highlight")
+		} else {
+			existing, ok := data.highlights[highlight.ID]
+			if !ok {
+				return errors.Wrapf(ErrNotFound, "highlight %d", highlight.ID)
+			}
+
+			highlight.BookmarkID = existing.BookmarkID
+			highlight.Created = existing.Created
+		}
+
+		data.highlights[highlight.ID] = highlight
+		return nil
+	})
+
+	return highlight, err
+}
+
+// DeleteHighlights removes the highlights with matching IDs.
+func (db *MemoryDatabase) DeleteHighlights(ctx context.Context, ids ...int) error {
+	return db.update(func(data *memoryData) error {
+		for _, id := range ids {
+			delete(data.highlights, id)
+		}
+		return nil
+	})
+}
+
+// highlightList returns the highlights of bookmark ordered by their position.
+func (data *memoryData) highlightList(bookmarkID int) []model.Highlight {
+	highlights := []model.Highlight{}
+	for _, highlight := range data.highlights {
+		if highlight.BookmarkID == bookmarkID {
+			highlights = append(highlights, highlight)
+		}
+	}
+
+	sort.Slice(highlights, func(i, j int) bool {
+		a, b := highlights[i], highlights[j]
+		if a.StartOffset != b.StartOffset {
+			return a.StartOffset < b.StartOffset
+		}
+		return a.ID < b.ID
+	})
+
+	return highlights
+}
+
+// annotations returns the searched text of notes and highlights of bookmark.
+func (data *memoryData) annotations(book model.Bookmark) string {
+	return annotationText(book.Notes, data.highlightList(book.ID))
+}
+
+// WithTx runs fn with a database whose changes are made in one transaction.
+// The changes are made on its own data, which replaces the data of database
+// when fn succeeds. Meanwhile, the database is locked for everyone else.
+func (db *MemoryDatabase) WithTx(ctx context.Context, fn func(tx DB) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// The data is never changed in place, so it's shared until tx changes it
+	tx := &MemoryDatabase{data: db.data, revisionLimit: db.revisionLimit, dataDir: db.dataDir, deletedIDs: db.deletedIDs}
+	if tx.deletedIDs == nil {
+		tx.deletedIDs = &[]int{}
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	db.data = tx.data
+
+	// Inside another WithTx the files are removed when it's done
+	if db.deletedIDs != nil {
+		return nil
+	}
+
+	return removeBookmarkFiles(db.dataDir, *tx.deletedIDs...)
+}
+
+// GetTags fetch list of tags of the account and the number of their bookmarks.
+func (db *MemoryDatabase) GetTags(ctx context.Context, accountID int) ([]model.Tag, error) {
+	data := db.snapshot()
+
+	counts := map[int]int{}
+	for bookmarkID, tagIDs := range data.bookmarkTags {
+		if data.bookmarks[bookmarkID].DeletedAt != "" {
+			continue
+		}
+		for tagID := range tagIDs {
+			counts[tagID]++
+		}
+	}
+
+	tags := []model.Tag{}
+	for _, tag := range data.tags {
+		if accountID != 0 && tag.AccountID != accountID {
+			continue
+		}
+		tag.NBookmarks = counts[tag.ID]
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+		return tags[i].AccountID < tags[j].AccountID
+	})
+
+	return tags, nil
+}
+
+// RenameTag changes the name of a tag together with its subtree,
+// or merges it into the tag that already has the new name.
+func (db *MemoryDatabase) RenameTag(ctx context.Context, id int, newName string) (tag model.Tag, err error) {
+	err = db.update(func(data *memoryData) error {
+		tag, err = data.renameTag(id, newName)
+		return err
+	})
+
+	return tag, err
+}
+
+func (data *memoryData) tagIDByName(accountID int, name string) int {
+	for id, tag := range data.tags {
+		if tag.AccountID == accountID && tag.Name == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// saveTag returns ID of the account's tag with the name. When it doesn't exist yet,
+// the tag is created together with its missing ancestors.
+func (data *memoryData) saveTag(accountID int, name string) int {
+	if id := data.tagIDByName(accountID, name); id != 0 {
+		return id
+	}
+
+	tag := model.Tag{
+		ID:        data.nextID("tag"),
+		AccountID: accountID,
+		Name:      name,
+		ParentID:  data.saveTagParent(accountID, name),
+	}
+	data.tags[tag.ID] = tag
+
+	return tag.ID
+}
+
+// saveTagParent returns ID of the parent of the tag, creating it when needed.
+// It's 0 for root tags.
+func (data *memoryData) saveTagParent(accountID int, name string) int {
+	parentName := tagParentName(name)
+	if parentName == "" {
+		return 0
+	}
+	return data.saveTag(accountID, parentName)
+}
+
+// removeUnusedTags removes tags that don't have any bookmarks nor children.
+func (data *memoryData) removeUnusedTags() {
+	for {
+		used := map[int]bool{}
+		for _, tagIDs := range data.bookmarkTags {
+			for tagID := range tagIDs {
+				used[tagID] = true
+			}
+		}
+		for _, tag := range data.tags {
+			used[tag.ParentID] = true
+		}
+
+		removed := false
+		for id := range data.tags {
+			if !used[id] {
+				delete(data.tags, id)
+				removed = true
+			}
+		}
+
+		if !removed {
+			return
+		}
+	}
+}
+
+// renameTag changes the name of a tag and moves its whole subtree along.
+// A tag is merged into the tag that already has the new name.
+func (data *memoryData) renameTag(id int, newName string) (model.Tag, error) {
+	tag := model.Tag{ID: id, Name: normalizeTagName(newName)}
+	if tag.Name == "" {
+		return tag, errors.New("tag name must not be empty")
+	}
+
+	// Make sure the tag exists, it's renamed within its account
+	old, ok := data.tags[id]
+	if !ok {
+		return tag, errors.Wrapf(ErrNotFound, "tag %d", id)
+	}
+	tag.AccountID = old.AccountID
+
+	if tag.Name == old.Name {
+		return tag, nil
+	}
+	if strings.HasPrefix(tag.Name, old.Name+tagSeparator) {
+		return tag, errors.Errorf("tag %q can't be moved into itself", old.Name)
+	}
+
+	// Fetch the descendants before the tag is renamed,
+	// parents must be renamed before their children
+	descendants := []model.Tag{}
+	for _, descendant := range data.tags {
+		if descendant.AccountID == old.AccountID && strings.HasPrefix(descendant.Name, old.Name+tagSeparator) {
+			descendants = append(descendants, descendant)
+		}
+	}
+
+	sort.Slice(descendants, func(i, j int) bool {
+		return strings.Count(descendants[i].Name, tagSeparator) < strings.Count(descendants[j].Name, tagSeparator)
+	})
+
+	tag.ID = data.renameTagNode(old.AccountID, id, tag.Name)
+	for _, descendant := range descendants {
+		data.renameTagNode(old.AccountID, descendant.ID, tag.Name+descendant.Name[len(old.Name):])
+	}
+
+	return tag, nil
+}
+
+// renameTagNode renames a single tag and links it to the parent of its new path.
+// It returns ID of the tag that it is merged into, or its own ID.
+func (data *memoryData) renameTagNode(accountID, id int, name string) int {
+	// Just rename it when the name is free
+	targetID := data.tagIDByName(accountID, name)
+	if targetID == 0 || targetID == id {
+		tag := data.tags[id]
+		tag.Name = name
+		tag.ParentID = data.saveTagParent(accountID, name)
+		data.tags[id] = tag
+		return id
+	}
+
+	// Otherwise move its bookmarks and children to the existing tag and remove it
+	for _, tagIDs := range data.bookmarkTags {
+		if tagIDs[id] {
+			delete(tagIDs, id)
+			tagIDs[targetID] = true
+		}
+	}
+
+	for childID, child := range data.tags {
+		if child.ParentID == id {
+			child.ParentID = targetID
+			data.tags[childID] = child
+		}
+	}
+
+	delete(data.tags, id)
+	return targetID
+}
+
+// GetAccount fetch account with matching username.
+// Returns the account and boolean whether it's exist or not.
+func (db *MemoryDatabase) GetAccount(ctx context.Context, username string) (model.Account, bool, error) {
+	account, exist, err := db.GetAccountWithPassword(ctx, username)
+	account.Password = ""
+	return account, exist, err
+}
+
+// GetAccountWithPassword fetch account with matching username, including its password hash.
+// Returns the account and boolean whether it's exist or not.
+func (db *MemoryDatabase) GetAccountWithPassword(ctx context.Context, username string) (model.Account, bool, error) {
+	for _, account := range db.snapshot().accounts {
+		if account.Username == username {
+			return account, true, nil
+		}
+	}
+
+	return model.Account{}, false, nil
+}
+
+// GetAccounts fetch list of account (without its password) based on submitted options
+func (db *MemoryDatabase) GetAccounts(ctx context.Context, opts GetAccountsOptions) ([]model.Account, error) {
+	keyword := strings.ToLower(opts.Keyword)
+
+	accounts := []model.Account{}
+	for _, account := range db.snapshot().accounts {
+		if keyword != "" && !strings.Contains(strings.ToLower(account.Username), keyword) {
+			continue
+		}
+		if opts.Owner && !account.Owner {
+			continue
+		}
+
+		account.Password = ""
+		accounts = append(accounts, account)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Username < accounts[j].Username
+	})
+
+	return accounts, nil
+}
+
+// SaveAccount creates new account, its password is hashed with bcrypt.
+// Returns the saved account with its ID filled in, without the password.
+func (db *MemoryDatabase) SaveAccount(ctx context.Context, account model.Account) (model.Account, error) {
+	hash, err := hashPassword(account.Password)
+	if err != nil {
+		return account, err
+	}
+
+	account.ID = 0
+	account.Password = hash
+	return db.SaveAccountWithHash(ctx, account)
+}
+
+// SaveAccountWithHash creates new account whose password is already hashed with bcrypt.
+// A new ID is generated unless the account already has one.
+// Returns the saved account with its ID filled in, without the password.
+func (db *MemoryDatabase) SaveAccountWithHash(ctx context.Context, account model.Account) (model.Account, error) {
+	if account.Username == "" {
+		return account, errors.New("username must not be empty")
+	}
+
+	if account.Password == "" {
+		return account, errors.New("password must not be empty")
+	}
+
+	hash := account.Password
+	account.Password = ""
+
+	err := db.update(func(data *memoryData) error {
+		if _, exist := data.accounts[account.ID]; exist || data.accountIDByUsername(account.Username) != 0 {
+			return errors.Wrap(ErrAlreadyExists, fmt.Sprintf("account %q", account.Username))
+		}
+
+		account.ID = data.keepID("account", account.ID)
+		saved := account
+		saved.Password = hash
+		data.accounts[account.ID] = saved
+		return nil
+	})
+
+	return account, err
+}
+
+// UpdateAccount updates the username and owner of account with matching ID.
+// The password is hashed and updated as well when it's not empty.
+func (db *MemoryDatabase) UpdateAccount(ctx context.Context, account model.Account) error {
+	if account.Username == "" {
+		return errors.New("username must not be empty")
+	}
+
+	var hash string
+	if account.Password != "" {
+		var err error
+		if hash, err = hashPassword(account.Password); err != nil {
+			return err
+		}
+	}
+
+	return db.update(func(data *memoryData) error {
+		saved, ok := data.accounts[account.ID]
+		if !ok {
+			return errors.Wrapf(ErrNotFound, "account %d", account.ID)
+		}
+
+		if id := data.accountIDByUsername(account.Username); id != 0 && id != account.ID {
+			return errors.Wrap(ErrAlreadyExists, fmt.Sprintf("account %q", account.Username))
+		}
+
+		saved.Username = account.Username
+		saved.Owner = account.Owner
+		if hash != "" {
+			saved.Password = hash
+		}
+
+		data.accounts[account.ID] = saved
+		return nil
+	})
+}
+
+func (data *memoryData) accountIDByUsername(username string) int {
+	for id, account := range data.accounts {
+		if account.Username == username {
+			return id
+		}
+	}
+	return 0
+}
+
+// DeleteAccounts removes all record with matching usernames
+func (db *MemoryDatabase) DeleteAccounts(ctx context.Context, usernames ...string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	var ids []int
+	err := db.update(func(data *memoryData) error {
+		for _, username := range usernames {
+			id := data.accountIDByUsername(username)
+			if id == 0 {
+				continue
+			}
+
+			bookmarkIDs := []int{}
+			for bookmarkID, book := range data.bookmarks {
+				if book.AccountID == id {
+					bookmarkIDs = append(bookmarkIDs, bookmarkID)
+				}
+			}
+			// Without ids deleteBookmarks removes everything
+			if len(bookmarkIDs) > 0 {
+				ids = append(ids, data.deleteBookmarks(bookmarkIDs)...)
+			}
+			data.removeUnusedTags()
+
+			delete(data.accounts, id)
+			for searchID, search := range data.savedSearches {
+				if search.AccountID == id {
+					delete(data.savedSearches, searchID)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// GetSavedSearches fetch the saved searches of the account, ordered by name.
+func (db *MemoryDatabase) GetSavedSearches(ctx context.Context, accountID int) ([]model.SavedSearch, error) {
+	data := db.snapshot()
+
+	searches := []model.SavedSearch{}
+	for _, search := range data.savedSearches {
+		if search.AccountID == accountID {
+			searches = append(searches, search)
+		}
+	}
+
+	sort.Slice(searches, func(i, j int) bool {
+		a, b := strings.ToLower(searches[i].Name), strings.ToLower(searches[j].Name)
+		if a != b {
+			return a < b
+		}
+		return searches[i].ID < searches[j].ID
+	})
+
+	return searches, nil
+}
+
+// GetSavedSearch fetch the saved search with matching ID that belongs to the account.
+func (db *MemoryDatabase) GetSavedSearch(ctx context.Context, accountID, id int) (model.SavedSearch, bool, error) {
+	search, exist := db.snapshot().savedSearches[id]
+	if !exist || search.AccountID != accountID {
+		return model.SavedSearch{}, false, nil
+	}
+
+	return search, true, nil
+}
+
+// SaveSavedSearch creates new saved search, or updates the one with matching ID.
+func (db *MemoryDatabase) SaveSavedSearch(ctx context.Context, search model.SavedSearch) (model.SavedSearch, error) {
+	if err := validateSavedSearch(&search); err != nil {
+		return search, err
+	}
+
+	err := db.update(func(data *memoryData) error {
+		if _, exist := data.accounts[search.AccountID]; !exist {
+			return errors.Errorf("account %d doesn't exist", search.AccountID)
+		}
+
+		if old, exist := data.savedSearches[search.ID]; search.ID != 0 && (!exist || old.AccountID != search.AccountID) {
+			return errors.Wrapf(ErrNotFound, "saved search %d", search.ID)
+		}
+
+		for _, other := range data.savedSearches {
+			if other.ID != search.ID && other.AccountID == search.AccountID && other.Name == search.Name {
+				return errors.Wrap(ErrAlreadyExists, fmt.Sprintf("saved search %q", search.Name))
+			}
+		}
+
+		if search.ID == 0 {
+			search.ID = data.nextID("saved_search")
+		}
+		search.NBookmarks = 0
+		data.savedSearches[search.ID] = search
+		return nil
+	})
+
+	return search, err
+}
+
+// DeleteSavedSearches removes the saved searches of the account with matching IDs.
+func (db *MemoryDatabase) DeleteSavedSearches(ctx context.Context, accountID int, ids ...int) error {
+	return db.update(func(data *memoryData) error {
+		for _, id := range ids {
+			if search, exist := data.savedSearches[id]; exist && search.AccountID == accountID {
+				delete(data.savedSearches, id)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,13 @@
+package database
+
+import (
+	"testing"
+)
+
+func memoryTestDatabaseFactory(t *testing.T) DB {
+	return NewMemoryDatabase()
+}
+
+func TestMemoryDatabase(t *testing.T) {
+	testDatabase(t, memoryTestDatabaseFactory)
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Migration is a schema migration of the database engine.
+type Migration struct {
+	Version uint
+	Name    string
+	Applied bool
+	// Failed is true for the migration that failed halfway, see MigrationStatus.Dirty.
+	// It isn't applied.
+	Failed bool
+}
+
+// MigrationStatus is the state of the database schema.
+type MigrationStatus struct {
+	// Version is the last applied migration, 0 when nothing is applied yet.
+	Version uint
+	// Dirty is true when the last migration failed halfway and
+	// the schema has to be fixed manually.
+	Dirty bool
+	// Migrations is all available migrations, ordered by their version.
+	Migrations []Migration
+}
+
+// Pending returns the number of migrations that are not applied yet.
+func (status MigrationStatus) Pending() int {
+	pending := 0
+	for _, migration := range status.Migrations {
+		if !migration.Applied {
+			pending++
+		}
+	}
+	return pending
+}
+
+// newMigration creates the migration of the embedded migrations in dir.
+func newMigration(dir, databaseName string, dbDrive migratedb.Driver) (*migrate.Migrate, error) {
+	sourceDrive, err := iofs.New(migrations, dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	migration, err := migrate.NewWithInstance(
+		"iofs",
+		sourceDrive,
+		databaseName,
+		dbDrive,
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return migration, nil
+}
+
+// migrateUp applies all migrations that are not applied yet.
+func migrateUp(migration *migrate.Migrate) error {
+	if err := migration.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// migrateSteps applies the next n migrations, or reverts the last -n migrations.
+func migrateSteps(migration *migrate.Migrate, n int) error {
+	if n == 0 {
+		return nil
+	}
+
+	// The available migrations are still run when there are fewer than n
+	err := migration.Steps(n)
+	var shortErr migrate.ErrShortLimit
+	if errors.As(err, &shortErr) {
+		return errors.Errorf("only %d of %d migrations were run", abs(n)-int(shortErr.Short), abs(n))
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// migrateTo migrates the schema up or down to the version.
+// Version 0 reverts every migration.
+func migrateTo(migration *migrate.Migrate, version uint) error {
+	var err error
+	if version == 0 {
+		err = migration.Down()
+	} else {
+		err = migration.Migrate(version)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return errors.Errorf("migration version %d doesn't exist", version)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// migrationStatus reports the current version of the schema and the
+// embedded migrations in dir.
+func migrationStatus(migration *migrate.Migrate, dir string) (MigrationStatus, error) {
+	status := MigrationStatus{}
+
+	version, dirty, err := migration.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return status, errors.WithStack(err)
+	}
+	status.Version = version
+	status.Dirty = dirty
+
+	sourceDrive, err := iofs.New(migrations, dir)
+	if err != nil {
+		return status, errors.WithStack(err)
+	}
+	defer sourceDrive.Close()
+
+	// Source returns fs.ErrNotExist when there are no more migrations
+	version, err = sourceDrive.First()
+	for ; err == nil; version, err = sourceDrive.Next(version) {
+		r, name, readErr := sourceDrive.ReadUp(version)
+		if readErr != nil {
+			return status, errors.WithStack(readErr)
+		}
+		r.Close()
+
+		failed := status.Dirty && version == status.Version
+		status.Migrations = append(status.Migrations, Migration{
+			Version: version,
+			Name:    name,
+			Applied: version <= status.Version && !failed,
+			Failed:  failed,
+		})
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return status, errors.WithStack(err)
+	}
+
+	return status, nil
+}
+
+// migrationFix fixes the data that SQL migrations can't, once the schema
+// has the migration of version.
+type migrationFix struct {
+	version uint
+	fn      func(ctx context.Context, tx *sqlx.Tx) error
+}
+
+// migrationFixes returns the fixes that run after migrating, with the tag inserter
+// and the tag merge query of the database engine:
+// nest the tags that were saved with slash separated names within their account,
+// fill the canonical URL of bookmarks saved before it's stored, and give
+// the bookmarks without account to the first owner.
+func migrationFixes(insert tagInserter, mergeQuery string) []migrationFix {
+	return []migrationFix{
+		{version: 9, fn: func(ctx context.Context, tx *sqlx.Tx) error {
+			return linkTagParents(ctx, tx, insert)
+		}},
+		{version: 6, fn: fillCanonicalURLs},
+		{version: 9, fn: func(ctx context.Context, tx *sqlx.Tx) error {
+			return claimOrphans(ctx, tx, mergeQuery)
+		}},
+	}
+}
+
+// migrationVersion returns the current schema version of migration,
+// 0 when nothing is applied yet.
+func migrationVersion(migration *migrate.Migrate) (uint, error) {
+	version, _, err := migration.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return version, nil
+}
+
+// fixMigratedData runs the fixes of the migrations that were just applied, i.e. the
+// ones after fromVersion up to the current schema version of migration, so each fix
+// is done once after migrating to any version. Nothing is fixed when the schema is dirty.
+func fixMigratedData(db *dbbase, migration *migrate.Migrate, fromVersion uint, fixes []migrationFix) error {
+	version, dirty, err := migration.Version()
+	if errors.Is(err, migrate.ErrNilVersion) || dirty {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ctx := context.Background()
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		for _, fix := range fixes {
+			if fix.version <= fromVersion || fix.version > version {
+				continue
+			}
+			if err := fix.fn(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrationReverts returns the preparations that run before reverting migrations, with
+// the tag merge query of the database engine: the data of accounts can't share URLs
+// and tag names anymore once version 9 is reverted, see unshareAccountData.
+func migrationReverts(mergeQuery string) []migrationFix {
+	return []migrationFix{
+		{version: 9, fn: func(ctx context.Context, tx *sqlx.Tx) error {
+			return unshareAccountData(ctx, tx, mergeQuery)
+		}},
+	}
+}
+
+// prepareRevert runs the preparations of the migrations that are about to be reverted
+// when migrating down to toVersion, i.e. the ones after toVersion up to the current
+// schema version of migration. Nothing is prepared when the schema is dirty.
+func prepareRevert(db *dbbase, migration *migrate.Migrate, toVersion uint, reverts []migrationFix) error {
+	version, dirty, err := migration.Version()
+	if errors.Is(err, migrate.ErrNilVersion) || dirty || toVersion >= version {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ctx := context.Background()
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		for _, fix := range reverts {
+			if fix.version <= toVersion || fix.version > version {
+				continue
+			}
+			if err := fix.fn(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// stepsVersion returns the schema version after n steps from version,
+// as the migrations are numbered one after another.
+func stepsVersion(version uint, n int) uint {
+	if n < 0 && uint(-n) > version {
+		return 0
+	}
+	return uint(int(version) + n)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	for _, dir := range []string{"migrations/sqlite", "migrations/mysql", "migrations/postgres"} {
+		entries, err := fs.ReadDir(migrations, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string]bool{}
+		for _, entry := range entries {
+			files[entry.Name()] = true
+		}
+
+		for name := range files {
+			if !strings.HasSuffix(name, ".up.sql") {
+				continue
+			}
+
+			down := strings.TrimSuffix(name, ".up.sql") + ".down.sql"
+			if !files[down] {
+				t.Errorf("%s has no matching %s", path.Join(dir, name), down)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS account(
+    id INT(11) NOT NULL AUTO_INCREMENT,
+    username VARCHAR(250) NOT NULL,
+    password VARCHAR(100) NOT NULL,
+    owner TINYINT(1) NOT NULL DEFAULT 0,
+    PRIMARY KEY(id),
+    UNIQUE KEY account_username_UNIQUE(username)
+) CHARACTER SET utf8mb4;
+
+CREATE TABLE IF NOT EXISTS bookmark(
+    id INT(11) NOT NULL AUTO_INCREMENT,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    excerpt TEXT NOT NULL,
+    author TEXT NOT NULL,
+    public TINYINT(1) NOT NULL DEFAULT 0,
+    content MEDIUMTEXT NOT NULL,
+    html MEDIUMTEXT NOT NULL,
+    modified TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(id),
+    UNIQUE KEY bookmark_url_UNIQUE(url(190)),
+    FULLTEXT KEY bookmark_content_FT(title, excerpt, content)
+) CHARACTER SET utf8mb4;
+
+CREATE TABLE IF NOT EXISTS tag(
+    id INT(11) NOT NULL AUTO_INCREMENT,
+    name VARCHAR(250) NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE KEY tag_name_UNIQUE(name)
+) CHARACTER SET utf8mb4;
+
+CREATE TABLE IF NOT EXISTS bookmark_tag(
+    bookmark_id INT(11) NOT NULL,
+    tag_id INT(11) NOT NULL,
+    PRIMARY KEY(bookmark_id, tag_id),
+    KEY bookmark_tag_tag_id_FK(tag_id),
+    CONSTRAINT bookmark_tag_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+    CONSTRAINT bookmark_tag_tag_id_FK FOREIGN KEY(tag_id) REFERENCES tag(id)
+) CHARACTER SET utf8mb4;
@@ -0,0 +1,3 @@
+ALTER TABLE bookmark
+    DROP INDEX bookmark_deleted_at_IDX,
+    DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE bookmark
+    ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL,
+    ADD INDEX bookmark_deleted_at_IDX(deleted_at);
@@ -0,0 +1,5 @@
+ALTER TABLE tag DROP FOREIGN KEY tag_parent_id_FK;
+
+ALTER TABLE tag
+    DROP INDEX tag_parent_id_IDX,
+    DROP COLUMN parent_id;
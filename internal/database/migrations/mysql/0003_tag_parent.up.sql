@@ -0,0 +1,4 @@
+ALTER TABLE tag
+    ADD COLUMN parent_id INT(11) NULL DEFAULT NULL,
+    ADD INDEX tag_parent_id_IDX(parent_id),
+    ADD CONSTRAINT tag_parent_id_FK FOREIGN KEY (parent_id) REFERENCES tag(id);
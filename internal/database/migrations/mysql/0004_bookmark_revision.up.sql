@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS bookmark_revision(
+    id INT(11) NOT NULL AUTO_INCREMENT,
+    bookmark_id INT(11) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title TEXT NOT NULL,
+    excerpt TEXT NOT NULL,
+    tags TEXT NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    html MEDIUMTEXT NOT NULL,
+    PRIMARY KEY(id),
+    KEY bookmark_revision_bookmark_id_FK(bookmark_id),
+    CONSTRAINT bookmark_revision_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id)
+) CHARACTER SET utf8mb4;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS saved_search(
+    id INT(11) NOT NULL AUTO_INCREMENT,
+    account_id INT(11) NOT NULL,
+    name VARCHAR(250) NOT NULL,
+    query TEXT NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE KEY saved_search_account_id_name_UNIQUE(account_id, name),
+    CONSTRAINT saved_search_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id)
+) CHARACTER SET utf8mb4;
@@ -0,0 +1,3 @@
+ALTER TABLE bookmark
+    DROP INDEX bookmark_canonical_url_IDX,
+    DROP COLUMN canonical_url;
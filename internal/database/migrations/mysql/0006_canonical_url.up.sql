@@ -0,0 +1,3 @@
+ALTER TABLE bookmark
+    ADD COLUMN canonical_url TEXT NOT NULL,
+    ADD INDEX bookmark_canonical_url_IDX(canonical_url(190));
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS highlight;
+
+ALTER TABLE bookmark
+    DROP INDEX bookmark_content_FT,
+    DROP COLUMN annotations,
+    DROP COLUMN notes,
+    ADD FULLTEXT KEY bookmark_content_FT(title, excerpt, content);
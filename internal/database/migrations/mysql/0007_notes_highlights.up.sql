@@ -0,0 +1,20 @@
+ALTER TABLE bookmark
+    ADD COLUMN notes MEDIUMTEXT NOT NULL,
+    ADD COLUMN annotations MEDIUMTEXT NOT NULL,
+    DROP INDEX bookmark_content_FT,
+    ADD FULLTEXT KEY bookmark_content_FT(title, excerpt, content, annotations);
+
+CREATE TABLE IF NOT EXISTS highlight(
+    id INT(11) NOT NULL AUTO_INCREMENT,
+    bookmark_id INT(11) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    quote TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    suffix TEXT NOT NULL,
+    start_offset INT(11) NOT NULL,
+    end_offset INT(11) NOT NULL,
+    comment TEXT NOT NULL,
+    PRIMARY KEY(id),
+    KEY highlight_bookmark_id_FK(bookmark_id),
+    CONSTRAINT highlight_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id)
+) CHARACTER SET utf8mb4;
@@ -0,0 +1,4 @@
+ALTER TABLE bookmark
+    DROP INDEX bookmark_reading_status_IDX,
+    DROP COLUMN reading_progress,
+    DROP COLUMN reading_status;
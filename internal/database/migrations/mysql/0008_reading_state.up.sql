@@ -0,0 +1,4 @@
+ALTER TABLE bookmark
+    ADD COLUMN reading_status VARCHAR(20) NOT NULL DEFAULT 'unread',
+    ADD COLUMN reading_progress TINYINT NOT NULL DEFAULT 0,
+    ADD INDEX bookmark_reading_status_IDX(reading_status);
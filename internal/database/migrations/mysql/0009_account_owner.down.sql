@@ -0,0 +1,12 @@
+-- The URL of bookmark and the name of tag are unique across accounts again. Before this
+-- runs, the tags of accounts with the same name are merged and it is refused when accounts
+-- saved the same URL, see unshareAccountData.
+ALTER TABLE tag
+    DROP INDEX tag_account_id_name_UNIQUE,
+    ADD UNIQUE KEY tag_name_UNIQUE(name),
+    DROP COLUMN account_id;
+
+ALTER TABLE bookmark
+    DROP INDEX bookmark_account_id_url_UNIQUE,
+    ADD UNIQUE KEY bookmark_url_UNIQUE(url(190)),
+    DROP COLUMN account_id;
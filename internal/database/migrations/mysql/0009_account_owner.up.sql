@@ -0,0 +1,12 @@
+-- The account IDs are never reused, AUTO_INCREMENT of InnoDB keeps going up after
+-- the last account is deleted, and since MySQL 8.0 after restart as well.
+
+ALTER TABLE bookmark
+    ADD COLUMN account_id INT(11) NOT NULL DEFAULT 0,
+    DROP INDEX bookmark_url_UNIQUE,
+    ADD UNIQUE KEY bookmark_account_id_url_UNIQUE(account_id, url(190));
+
+ALTER TABLE tag
+    ADD COLUMN account_id INT(11) NOT NULL DEFAULT 0,
+    DROP INDEX tag_name_UNIQUE,
+    ADD UNIQUE KEY tag_account_id_name_UNIQUE(account_id, name);
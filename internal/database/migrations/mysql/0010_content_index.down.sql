@@ -0,0 +1,2 @@
+ALTER TABLE bookmark
+    DROP INDEX bookmark_public_content_FT;
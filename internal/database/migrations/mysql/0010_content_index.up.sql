@@ -0,0 +1,4 @@
+-- Public bookmarks are searched without the annotations, which are private to
+-- their account, and MATCH needs a full text index of exactly its columns.
+ALTER TABLE bookmark
+    ADD FULLTEXT KEY bookmark_public_content_FT(title, excerpt, content);
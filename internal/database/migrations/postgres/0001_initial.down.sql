@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS bookmark_tag;
+DROP TABLE IF EXISTS tag;
+DROP TABLE IF EXISTS bookmark;
+DROP TABLE IF EXISTS account;
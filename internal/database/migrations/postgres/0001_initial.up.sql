@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS account(
+    id SERIAL,
+    username VARCHAR(250) NOT NULL,
+    password TEXT NOT NULL,
+    owner BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT account_PK PRIMARY KEY(id),
+    CONSTRAINT account_username_UNIQUE UNIQUE(username)
+);
+
+CREATE TABLE IF NOT EXISTS bookmark(
+    id SERIAL,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    excerpt TEXT NOT NULL DEFAULT '',
+    author TEXT NOT NULL DEFAULT '',
+    public SMALLINT NOT NULL DEFAULT 0,
+    content TEXT NOT NULL DEFAULT '',
+    html TEXT NOT NULL DEFAULT '',
+    modified TIMESTAMP(0) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', title || ' ' || excerpt || ' ' || content)
+    ) STORED,
+    CONSTRAINT bookmark_PK PRIMARY KEY(id),
+    CONSTRAINT bookmark_url_UNIQUE UNIQUE(url)
+);
+
+CREATE INDEX IF NOT EXISTS bookmark_search_vector_GIN ON bookmark USING GIN(search_vector);
+
+CREATE TABLE IF NOT EXISTS tag(
+    id SERIAL,
+    name VARCHAR(250) NOT NULL,
+    CONSTRAINT tag_PK PRIMARY KEY(id),
+    CONSTRAINT tag_name_UNIQUE UNIQUE(name)
+);
+
+CREATE TABLE IF NOT EXISTS bookmark_tag(
+    bookmark_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    CONSTRAINT bookmark_tag_PK PRIMARY KEY(bookmark_id, tag_id),
+    CONSTRAINT bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+    CONSTRAINT tag_id_FK FOREIGN KEY(tag_id) REFERENCES tag(id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmark_tag_tag_id_IDX ON bookmark_tag(tag_id);
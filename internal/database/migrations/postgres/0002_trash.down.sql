@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS bookmark_deleted_at_IDX;
+
+ALTER TABLE bookmark DROP COLUMN IF EXISTS deleted_at;
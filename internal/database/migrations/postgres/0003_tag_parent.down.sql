@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tag_parent_id_IDX;
+
+ALTER TABLE tag DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,4 @@
+ALTER TABLE tag ADD COLUMN parent_id INTEGER DEFAULT NULL,
+    ADD CONSTRAINT tag_parent_id_FK FOREIGN KEY (parent_id) REFERENCES tag(id);
+
+CREATE INDEX IF NOT EXISTS tag_parent_id_IDX ON tag(parent_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS saved_search(
+    id SERIAL,
+    account_id INTEGER NOT NULL,
+    name VARCHAR(250) NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    CONSTRAINT saved_search_PK PRIMARY KEY(id),
+    CONSTRAINT saved_search_account_id_name_UNIQUE UNIQUE(account_id, name),
+    CONSTRAINT saved_search_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id)
+);
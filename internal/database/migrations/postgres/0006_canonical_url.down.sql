@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS bookmark_canonical_url_IDX;
+
+ALTER TABLE bookmark DROP COLUMN IF EXISTS canonical_url;
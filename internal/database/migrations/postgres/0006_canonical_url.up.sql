@@ -0,0 +1,3 @@
+ALTER TABLE bookmark ADD COLUMN canonical_url TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS bookmark_canonical_url_IDX ON bookmark(canonical_url);
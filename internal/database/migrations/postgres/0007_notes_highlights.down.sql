@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS highlight;
+
+DROP INDEX IF EXISTS bookmark_search_vector_GIN;
+ALTER TABLE bookmark DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE bookmark ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', title || ' ' || excerpt || ' ' || content)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS bookmark_search_vector_GIN ON bookmark USING GIN(search_vector);
+
+ALTER TABLE bookmark DROP COLUMN IF EXISTS annotations;
+ALTER TABLE bookmark DROP COLUMN IF EXISTS notes;
@@ -0,0 +1,27 @@
+ALTER TABLE bookmark ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE bookmark ADD COLUMN annotations TEXT NOT NULL DEFAULT '';
+
+-- Generated column can't be altered, so it's added again with the text of notes and highlights
+DROP INDEX IF EXISTS bookmark_search_vector_GIN;
+ALTER TABLE bookmark DROP COLUMN search_vector;
+ALTER TABLE bookmark ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', title || ' ' || excerpt || ' ' || content || ' ' || annotations)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS bookmark_search_vector_GIN ON bookmark USING GIN(search_vector);
+
+CREATE TABLE IF NOT EXISTS highlight(
+    id SERIAL,
+    bookmark_id INTEGER NOT NULL,
+    created TIMESTAMP(0) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    quote TEXT NOT NULL,
+    prefix TEXT NOT NULL DEFAULT '',
+    suffix TEXT NOT NULL DEFAULT '',
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    CONSTRAINT highlight_PK PRIMARY KEY(id),
+    CONSTRAINT highlight_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id)
+);
+
+CREATE INDEX IF NOT EXISTS highlight_bookmark_id_IDX ON highlight(bookmark_id);
@@ -0,0 +1,4 @@
+ALTER TABLE bookmark ADD COLUMN reading_status VARCHAR(20) NOT NULL DEFAULT 'unread';
+ALTER TABLE bookmark ADD COLUMN reading_progress SMALLINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS bookmark_reading_status_IDX ON bookmark(reading_status);
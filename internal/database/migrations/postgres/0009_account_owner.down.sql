@@ -0,0 +1,10 @@
+-- The URL of bookmark and the name of tag are unique across accounts again. Before this
+-- runs, the tags of accounts with the same name are merged and it is refused when accounts
+-- saved the same URL, see unshareAccountData.
+ALTER TABLE tag DROP CONSTRAINT IF EXISTS tag_account_id_name_UNIQUE;
+ALTER TABLE tag ADD CONSTRAINT tag_name_UNIQUE UNIQUE(name);
+ALTER TABLE tag DROP COLUMN IF EXISTS account_id;
+
+ALTER TABLE bookmark DROP CONSTRAINT IF EXISTS bookmark_account_id_url_UNIQUE;
+ALTER TABLE bookmark ADD CONSTRAINT bookmark_url_UNIQUE UNIQUE(url);
+ALTER TABLE bookmark DROP COLUMN IF EXISTS account_id;
@@ -0,0 +1,10 @@
+-- The account IDs are never reused, the sequence of SERIAL keeps going up after
+-- the last account is deleted.
+
+ALTER TABLE bookmark ADD COLUMN account_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE bookmark DROP CONSTRAINT bookmark_url_UNIQUE;
+ALTER TABLE bookmark ADD CONSTRAINT bookmark_account_id_url_UNIQUE UNIQUE(account_id, url);
+
+ALTER TABLE tag ADD COLUMN account_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tag DROP CONSTRAINT tag_name_UNIQUE;
+ALTER TABLE tag ADD CONSTRAINT tag_account_id_name_UNIQUE UNIQUE(account_id, name);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS bookmark_content;
+DROP TABLE IF EXISTS bookmark_tag;
+DROP TABLE IF EXISTS tag;
+DROP TABLE IF EXISTS bookmark;
+DROP TABLE IF EXISTS account;
@@ -0,0 +1,3 @@
+ALTER TABLE bookmark ADD COLUMN deleted_at TEXT;
+
+CREATE INDEX IF NOT EXISTS bookmark_deleted_at_IDX ON bookmark(deleted_at);
@@ -0,0 +1,16 @@
+-- SQLite can't drop a column that is used by foreign key, so the table is rebuilt.
+-- The tags keep their slash separated names.
+DROP INDEX IF EXISTS tag_parent_id_IDX;
+
+CREATE TABLE tag_old(
+    id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    CONSTRAINT tag_PK PRIMARY KEY(id),
+    CONSTRAINT tag_name_UNIQUE UNIQUE(name)
+);
+
+INSERT INTO tag_old (id, name) SELECT id, name FROM tag;
+
+DROP TABLE tag;
+
+ALTER TABLE tag_old RENAME TO tag;
@@ -0,0 +1,3 @@
+ALTER TABLE tag ADD COLUMN parent_id INTEGER DEFAULT NULL REFERENCES tag(id);
+
+CREATE INDEX IF NOT EXISTS tag_parent_id_IDX ON tag(parent_id);
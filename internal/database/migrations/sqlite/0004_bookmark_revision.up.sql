@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS bookmark_revision(
+    id INTEGER NOT NULL,
+    bookmark_id INTEGER NOT NULL,
+    created TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title TEXT NOT NULL,
+    excerpt TEXT NOT NULL DEFAULT "",
+    tags TEXT NOT NULL DEFAULT "",
+    content TEXT NOT NULL DEFAULT "",
+    html TEXT NOT NULL DEFAULT "",
+    CONSTRAINT bookmark_revision_PK PRIMARY KEY(id),
+    CONSTRAINT bookmark_revision_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmark_revision_bookmark_id_IDX ON bookmark_revision(bookmark_id);
@@ -0,0 +1,13 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS bookmark_content_old
+    USING fts5(title, content, html, docid);
+
+INSERT INTO bookmark_content_old(title, content, html, docid)
+    SELECT title, content, html, docid FROM bookmark_content;
+
+DROP TABLE bookmark_content;
+
+ALTER TABLE bookmark_content_old RENAME TO bookmark_content;
+
+DROP TABLE IF EXISTS highlight;
+
+ALTER TABLE bookmark DROP COLUMN notes;
@@ -0,0 +1,28 @@
+ALTER TABLE bookmark ADD COLUMN notes TEXT NOT NULL DEFAULT "";
+
+CREATE TABLE IF NOT EXISTS highlight(
+    id INTEGER NOT NULL,
+    bookmark_id INTEGER NOT NULL,
+    created TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    quote TEXT NOT NULL,
+    prefix TEXT NOT NULL DEFAULT "",
+    suffix TEXT NOT NULL DEFAULT "",
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    comment TEXT NOT NULL DEFAULT "",
+    CONSTRAINT highlight_PK PRIMARY KEY(id),
+    CONSTRAINT highlight_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id)
+);
+
+CREATE INDEX IF NOT EXISTS highlight_bookmark_id_IDX ON highlight(bookmark_id);
+
+-- FTS5 table can't add column, so it's rebuilt with the text of notes and highlights
+CREATE VIRTUAL TABLE IF NOT EXISTS bookmark_content_new
+    USING fts5(title, content, html, annotations, docid);
+
+INSERT INTO bookmark_content_new(title, content, html, annotations, docid)
+    SELECT title, content, html, "", docid FROM bookmark_content;
+
+DROP TABLE bookmark_content;
+
+ALTER TABLE bookmark_content_new RENAME TO bookmark_content;
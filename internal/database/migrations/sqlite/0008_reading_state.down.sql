@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS bookmark_reading_status_IDX;
+
+ALTER TABLE bookmark DROP COLUMN reading_progress;
+ALTER TABLE bookmark DROP COLUMN reading_status;
@@ -0,0 +1,4 @@
+ALTER TABLE bookmark ADD COLUMN reading_status TEXT NOT NULL DEFAULT "unread";
+ALTER TABLE bookmark ADD COLUMN reading_progress INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS bookmark_reading_status_IDX ON bookmark(reading_status);
@@ -0,0 +1,64 @@
+-- The URL of bookmark and the name of tag are unique across accounts again. Before this
+-- runs, the tags of accounts with the same name are merged and it is refused when accounts
+-- saved the same URL, see unshareAccountData.
+CREATE TABLE IF NOT EXISTS bookmark_old(
+    id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    excerpt TEXT NOT NULL DEFAULT "",
+    author TEXT NOT NULL DEFAULT "",
+    public INTEGER NOT NULL DEFAULT 0,
+    modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TEXT,
+    canonical_url TEXT NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT "",
+    reading_status TEXT NOT NULL DEFAULT "unread",
+    reading_progress INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT bookmark_PK PRIMARY KEY(id),
+    CONSTRAINT bookmark_url_UNIQUE UNIQUE(url)
+);
+
+INSERT INTO bookmark_old(id, url, title, excerpt, author, public, modified,
+    deleted_at, canonical_url, notes, reading_status, reading_progress)
+    SELECT id, url, title, excerpt, author, public, modified,
+    deleted_at, canonical_url, notes, reading_status, reading_progress FROM bookmark;
+
+DROP TABLE bookmark;
+
+ALTER TABLE bookmark_old RENAME TO bookmark;
+
+CREATE INDEX IF NOT EXISTS bookmark_deleted_at_IDX ON bookmark(deleted_at);
+CREATE INDEX IF NOT EXISTS bookmark_canonical_url_IDX ON bookmark(canonical_url);
+CREATE INDEX IF NOT EXISTS bookmark_reading_status_IDX ON bookmark(reading_status);
+
+CREATE TABLE IF NOT EXISTS tag_old(
+    id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    parent_id INTEGER DEFAULT NULL REFERENCES tag(id),
+    CONSTRAINT tag_PK PRIMARY KEY(id),
+    CONSTRAINT tag_name_UNIQUE UNIQUE(name)
+);
+
+INSERT INTO tag_old(id, name, parent_id) SELECT id, name, parent_id FROM tag;
+
+DROP TABLE tag;
+
+ALTER TABLE tag_old RENAME TO tag;
+
+CREATE INDEX IF NOT EXISTS tag_parent_id_IDX ON tag(parent_id);
+
+CREATE TABLE IF NOT EXISTS account_old(
+    id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    password TEXT NOT NULL,
+    owner INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT account_PK PRIMARY KEY(id),
+    CONSTRAINT account_username_UNIQUE UNIQUE(username)
+);
+
+INSERT INTO account_old(id, username, password, owner)
+    SELECT id, username, password, owner FROM account;
+
+DROP TABLE account;
+
+ALTER TABLE account_old RENAME TO account;
@@ -0,0 +1,67 @@
+-- Bookmarks and tags belong to an account, 0 is no account.
+-- The URL of bookmark and the name of tag are unique for each account, and SQLite
+-- can't change the constraints of a table, so both tables are rebuilt.
+CREATE TABLE IF NOT EXISTS bookmark_new(
+    id INTEGER NOT NULL,
+    account_id INTEGER NOT NULL DEFAULT 0,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    excerpt TEXT NOT NULL DEFAULT "",
+    author TEXT NOT NULL DEFAULT "",
+    public INTEGER NOT NULL DEFAULT 0,
+    modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TEXT,
+    canonical_url TEXT NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT "",
+    reading_status TEXT NOT NULL DEFAULT "unread",
+    reading_progress INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT bookmark_PK PRIMARY KEY(id),
+    CONSTRAINT bookmark_account_id_url_UNIQUE UNIQUE(account_id, url)
+);
+
+INSERT INTO bookmark_new(id, url, title, excerpt, author, public, modified,
+    deleted_at, canonical_url, notes, reading_status, reading_progress)
+    SELECT id, url, title, excerpt, author, public, modified,
+    deleted_at, canonical_url, notes, reading_status, reading_progress FROM bookmark;
+
+DROP TABLE bookmark;
+
+ALTER TABLE bookmark_new RENAME TO bookmark;
+
+CREATE INDEX IF NOT EXISTS bookmark_deleted_at_IDX ON bookmark(deleted_at);
+CREATE INDEX IF NOT EXISTS bookmark_canonical_url_IDX ON bookmark(canonical_url);
+CREATE INDEX IF NOT EXISTS bookmark_reading_status_IDX ON bookmark(reading_status);
+
+CREATE TABLE IF NOT EXISTS tag_new(
+    id INTEGER NOT NULL,
+    account_id INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    parent_id INTEGER DEFAULT NULL REFERENCES tag(id),
+    CONSTRAINT tag_PK PRIMARY KEY(id),
+    CONSTRAINT tag_account_id_name_UNIQUE UNIQUE(account_id, name)
+);
+
+INSERT INTO tag_new(id, name, parent_id) SELECT id, name, parent_id FROM tag;
+
+DROP TABLE tag;
+
+ALTER TABLE tag_new RENAME TO tag;
+
+CREATE INDEX IF NOT EXISTS tag_parent_id_IDX ON tag(parent_id);
+
+-- Without AUTOINCREMENT SQLite gives the ID of the last deleted account to the
+-- next one, which then would be seen as the owner of the old records.
+CREATE TABLE IF NOT EXISTS account_new(
+    id INTEGER NOT NULL CONSTRAINT account_PK PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    password TEXT NOT NULL,
+    owner INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT account_username_UNIQUE UNIQUE(username)
+);
+
+INSERT INTO account_new(id, username, password, owner)
+    SELECT id, username, password, owner FROM account;
+
+DROP TABLE account;
+
+ALTER TABLE account_new RENAME TO account;
@@ -0,0 +1,884 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// MySQLDatabase is implementation of Database interface
+// for connecting to MySQL or MariaDB database.
+type MySQLDatabase struct {
+	dbbase
+}
+
+// OpenMySQLDatabase creates and opens connection to a MySQL Database.
+func OpenMySQLDatabase(ctx context.Context, connString string) (mysqlDB *MySQLDatabase, err error) {
+	// Migrations contain several statements in one file
+	cfg, err := mysqldriver.ParseDSN(connString)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cfg.MultiStatements = true
+
+	// open database
+	db, err := sqlx.ConnectContext(ctx, "mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(100)
+	// in case mysql client has longer timeout (driver issue #674)
+	db.SetConnMaxLifetime(time.Second)
+
+	mysqlDB = &MySQLDatabase{
+		dbbase: dbbase{DB: *db, revisionLimit: DefaultRevisionLimit},
+	}
+	return mysqlDB, nil
+}
+
+// migration returns the migration of MySQL schema.
+func (db *MySQLDatabase) migration() (*migrate.Migrate, error) {
+	dbDrive, err := mysql.WithInstance(db.DB.DB, &mysql.Config{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return newMigration("migrations/mysql", "mysql", dbDrive)
+}
+
+// Migrate runs migrations for this database engine
+func (db *MySQLDatabase) Migrate() error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateUp(migration); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// fixMigratedData fixes the data after migrating from fromVersion, see migrationFixes.
+func (db *MySQLDatabase) fixMigratedData(migration *migrate.Migrate, fromVersion uint) error {
+	return fixMigratedData(&db.dbbase, migration, fromVersion, migrationFixes(insertTag, mysqlMergeTagQuery))
+}
+
+// prepareRevert prepares the data for migrating down to toVersion, see migrationReverts.
+func (db *MySQLDatabase) prepareRevert(migration *migrate.Migrate, toVersion uint) error {
+	return prepareRevert(&db.dbbase, migration, toVersion, migrationReverts(mysqlMergeTagQuery))
+}
+
+// MigrateSteps applies the next n migrations, or reverts the last -n migrations.
+func (db *MySQLDatabase) MigrateSteps(n int) error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := db.prepareRevert(migration, stepsVersion(fromVersion, n)); err != nil {
+		return err
+	}
+
+	if err := migrateSteps(migration, n); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// MigrateTo migrates the schema up or down to the version.
+func (db *MySQLDatabase) MigrateTo(version uint) error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := db.prepareRevert(migration, version); err != nil {
+		return err
+	}
+
+	if err := migrateTo(migration, version); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// MigrationStatus reports the schema version and the available migrations.
+func (db *MySQLDatabase) MigrationStatus() (MigrationStatus, error) {
+	migration, err := db.migration()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	return migrationStatus(migration, "migrations/mysql")
+}
+
+// SaveBookmarks saves new or updated bookmarks to database.
+// When create is true the bookmarks are inserted, otherwise they are updated by ID.
+// Returns the saved bookmarks with their IDs filled in.
+func (db *MySQLDatabase) SaveBookmarks(ctx context.Context, create bool, bookmarks ...model.Bookmark) ([]model.Bookmark, error) {
+	result := []model.Bookmark{}
+
+	err := db.withTx(ctx, func(tx *sqlx.Tx) error {
+		// Prepare statement
+		// A new ID is generated unless the bookmark already has one
+		stmtInsertBook, err := tx.PreparexContext(ctx, `INSERT INTO bookmark
+			(id, account_id, url, title, excerpt, author, public, content, html, modified, deleted_at, canonical_url,
+			notes, annotations, reading_status, reading_progress)
+			VALUES(NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, '', ?, ?)`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBook.Close()
+
+		stmtUpdateBook, err := tx.PreparexContext(ctx, `UPDATE bookmark SET
+			url = ?, title = ?, excerpt = ?, author = ?,
+			public = ?, content = ?, html = ?, modified = ?, canonical_url = ?, notes = ?,
+			reading_status = ?, reading_progress = ?
+			WHERE id = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtUpdateBook.Close()
+
+		stmtGetTag, err := tx.PreparexContext(ctx, `SELECT id FROM tag WHERE account_id = ? AND name = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtGetTag.Close()
+
+		stmtInsertBookTag, err := tx.PreparexContext(ctx, `INSERT IGNORE INTO bookmark_tag
+			(tag_id, bookmark_id) VALUES (?, ?)`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBookTag.Close()
+
+		stmtDeleteBookTag, err := tx.PreparexContext(ctx, `DELETE FROM bookmark_tag
+			WHERE bookmark_id = ? AND tag_id = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtDeleteBookTag.Close()
+
+		// Prepare modified time
+		modifiedTime := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+		// Execute statements
+		for _, book := range bookmarks {
+			// Check URL and title
+			if book.URL == "" {
+				return errors.New("URL must not be empty")
+			}
+
+			if book.Title == "" {
+				return errors.New("title must not be empty")
+			}
+
+			// Set modified time
+			if book.Modified == "" {
+				book.Modified = modifiedTime
+			}
+
+			// Check reading state, new bookmark is unread
+			book.ReadingStatus, err = validateReadingState(book.ReadingStatus, book.ReadingProgress)
+			if err != nil {
+				return err
+			}
+
+			// The account of bookmark isn't changed by update
+			if !create {
+				book.AccountID, err = bookmarkAccountID(ctx, tx, book.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			// The same page must not be saved twice by the account
+			canonicalURL := CanonicalURL(book.URL)
+			if err := checkCanonicalURL(ctx, tx, book, canonicalURL); err != nil {
+				return err
+			}
+
+			// Create or update bookmark
+			if create {
+				res, err := stmtInsertBook.ExecContext(ctx, book.ID, book.AccountID,
+					book.URL, book.Title, book.Excerpt, book.Author,
+					book.Public, book.Content, book.HTML, book.Modified, book.DeletedAt, canonicalURL, book.Notes,
+					book.ReadingStatus, book.ReadingProgress)
+				if err != nil {
+					return mysqlSaveError(err, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				bookID, err := res.LastInsertId()
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				book.ID = int(bookID)
+			} else {
+				// MySQL only reports the rows that actually changed, so the existence
+				// was checked together with the account of bookmark.
+				// Keep the current state as revision before updating it
+				err = saveBookmarkRevision(ctx, tx, book.ID, db.revisionLimit, `SELECT title, excerpt, content, html
+					FROM bookmark WHERE id = ?`)
+				if err != nil {
+					return err
+				}
+
+				_, err = stmtUpdateBook.ExecContext(ctx,
+					book.URL, book.Title, book.Excerpt, book.Author,
+					book.Public, book.Content, book.HTML, book.Modified, canonicalURL, book.Notes,
+					book.ReadingStatus, book.ReadingProgress, book.ID)
+				if err != nil {
+					return mysqlSaveError(err, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+			}
+			book.HasContent = book.Content != ""
+
+			// Index the notes together with the highlights
+			if err := saveAnnotations(ctx, tx, book.ID, annotationsQuery); err != nil {
+				return err
+			}
+
+			// Save bookmark tags
+			newTags := []model.Tag{}
+			for _, tag := range book.Tags {
+				// Normalize tag name
+				tag.Name = normalizeTagName(tag.Name)
+
+				// Tag is found by its name within the account of bookmark, its ID is
+				// only used without name and must belong to the account as well
+				if tag.Name != "" {
+					tag.ID = 0
+					err = stmtGetTag.GetContext(ctx, &tag.ID, book.AccountID, tag.Name)
+					if err != nil && err != sql.ErrNoRows {
+						return errors.WithStack(err)
+					}
+				} else if tag.ID != 0 {
+					if err := checkTagAccount(ctx, tx, tag.ID, book.AccountID); err != nil {
+						return err
+					}
+				}
+
+				// If it's deleted tag, delete and continue
+				if tag.Deleted {
+					if tag.ID != 0 {
+						_, err = stmtDeleteBookTag.ExecContext(ctx, book.ID, tag.ID)
+						if err != nil {
+							return errors.WithStack(err)
+						}
+					}
+					continue
+				}
+
+				// If tag doesn't exist in database, save it
+				if tag.ID == 0 {
+					if tag.Name == "" {
+						continue
+					}
+
+					// Create it with its missing parents
+					tag.ID, err = saveTag(ctx, tx, book.AccountID, tag.Name, insertTag)
+					if err != nil {
+						return err
+					}
+				}
+
+				_, err = stmtInsertBookTag.ExecContext(ctx, tag.ID, book.ID)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+
+				newTags = append(newTags, tag)
+			}
+
+			book.Tags = newTags
+			result = append(result, book)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// mysqlMatchColumns returns the columns of the full text index that is searched,
+// with annotations the notes and highlights are included.
+func mysqlMatchColumns(annotations bool) string {
+	if annotations {
+		return `b.title, b.excerpt, b.content, b.annotations`
+	}
+
+	return `b.title, b.excerpt, b.content`
+}
+
+// mysqlKeywordClause returns the condition for bookmarks that have the keyword
+// in their URL, title, excerpt, content or, with annotations, notes or highlights.
+func mysqlKeywordClause(keyword string, annotations bool) (string, []interface{}) {
+	query := `b.url LIKE ? OR b.title LIKE ? OR b.excerpt LIKE ? OR
+		MATCH(` + mysqlMatchColumns(annotations) + `) AGAINST (?)`
+
+	return query, []interface{}{
+		"%" + keyword + "%",
+		"%" + keyword + "%",
+		"%" + keyword + "%",
+		keyword}
+}
+
+// mysqlSearchDialect is the SQL of MySQL for search queries.
+var mysqlSearchDialect = searchDialect{
+	keyword:    mysqlKeywordClause,
+	hasContent: `b.content <> ''`,
+	host: `SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(
+		SUBSTRING(b.url, LOCATE('://', b.url) + 3), '/', 1), '?', 1), '#', 1), ':', 1)`,
+}
+
+// mysqlURLWithoutScheme is the URL after its scheme, see urlWithoutScheme.
+const mysqlURLWithoutScheme = `SUBSTRING(b.url,
+	CASE WHEN LOCATE('://', b.url) > 0 THEN LOCATE('://', b.url) + 3 ELSE 1 END)`
+
+// mysqlOrders is the sort order of bookmarks for each OrderMethod.
+var mysqlOrders = map[OrderMethod]orderSpec{
+	DefaultOrder:   {},
+	ByLastAdded:    {desc: true},
+	ByLastModified: {key: "b.modified", desc: true},
+	ByTitle:        {key: "b.title"},
+	ByURL:          {key: mysqlURLWithoutScheme},
+	ByUnread:       {key: readingStatusRank},
+}
+
+// GetBookMarks fetch list of bookmarks based on submitted options.
+func (db *MySQLDatabase) GetBookMarks(ctx context.Context, opts GetBookmarksOptions) ([]model.Bookmark, error) {
+	order, cursor, err := orderAndCursor(mysqlOrders, &opts)
+	if err != nil {
+		return nil, err
+	}
+	keywords := opts.keywords()
+	orderByRelevance := opts.OrderMethod == ByRelevance && len(keywords) > 0
+
+	// Create initial query
+	columns := []string{
+		`b.id`,
+		`b.account_id`,
+		`b.url`,
+		`b.title`,
+		`b.excerpt`,
+		`b.author`,
+		`b.public`,
+		`b.modified`,
+		`b.notes`,
+		`b.reading_status`,
+		`b.reading_progress`,
+		`b.content <> '' has_content`,
+		`COALESCE(b.deleted_at, '') deleted_at`}
+
+	if opts.WithContent {
+		columns = append(columns,
+			`b.content`,
+			`b.html`)
+	}
+
+	query := `SELECT ` + strings.Join(columns, ",") + `
+		FROM bookmark b
+		WHERE 1`
+
+	// Add where clause
+	args := []interface{}{}
+
+	// Add where clause for the filters of options
+	filterQuery, filterArgs := bookmarksFilterClause(opts, mysqlSearchDialect)
+	query += filterQuery
+	args = append(args, filterArgs...)
+
+	// Add where clause for cursor
+	if cursor != nil {
+		cursorQuery, cursorArgs := order.where(*cursor)
+		query += cursorQuery
+		args = append(args, cursorArgs...)
+	}
+
+	// Add order clause
+	if orderByRelevance {
+		query += ` ORDER BY MATCH(` + mysqlMatchColumns(!opts.WithoutAnnotations) + `) AGAINST (?) DESC, b.id DESC`
+		args = append(args, strings.Join(keywords, " "))
+	} else {
+		query += order.orderBy(cursor != nil && cursor.Backward)
+	}
+
+	if opts.Limit > 0 && cursor != nil {
+		query += ` LIMIT ?`
+		args = append(args, opts.Limit)
+	} else if opts.Limit > 0 && opts.Offset >= 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, opts.Limit, opts.Offset)
+	}
+
+	// Expand query, because some of the args might be an array
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Fetch bookmarks
+	bookmarks := []model.Bookmark{}
+	err = db.SelectContext(ctx, &bookmarks, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(bookmarks) == 0 {
+		return bookmarks, nil
+	}
+
+	if cursor != nil && cursor.Backward {
+		reverseBookmarks(bookmarks)
+	}
+
+	// Store bookmark index by its ID for further enrichment
+	bookmarkIDs := make([]int, 0, len(bookmarks))
+	bookmarkMap := make(map[int]int, len(bookmarks))
+	for i := range bookmarks {
+		bookmarks[i].Tags = []model.Tag{}
+		bookmarkIDs = append(bookmarkIDs, bookmarks[i].ID)
+		bookmarkMap[bookmarks[i].ID] = i
+	}
+
+	// Fetch tags for each bookmarks
+	tagsQuery, tagsArgs, err := sqlx.In(`SELECT bt.bookmark_id, t.id, t.name
+		FROM bookmark_tag bt
+		LEFT JOIN tag t ON bt.tag_id = t.id
+		WHERE bt.bookmark_id IN (?)
+		ORDER BY t.name`, bookmarkIDs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bookmarkTags := []struct {
+		BookmarkID int `db:"bookmark_id"`
+		model.Tag
+	}{}
+	err = db.SelectContext(ctx, &bookmarkTags, tagsQuery, tagsArgs...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, bt := range bookmarkTags {
+		if i, ok := bookmarkMap[bt.BookmarkID]; ok {
+			bookmarks[i].Tags = append(bookmarks[i].Tags, bt.Tag)
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// GetBookmarksCount returns the number of bookmarks that match opts.
+func (db *MySQLDatabase) GetBookmarksCount(ctx context.Context, opts GetBookmarksOptions) (int, error) {
+	filterQuery, filterArgs := bookmarksFilterClause(opts, mysqlSearchDialect)
+
+	// Expand query, because some of the args might be an array
+	query, args, err := sqlx.In(`SELECT COUNT(b.id) FROM bookmark b WHERE 1`+filterQuery, filterArgs...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	count := 0
+	err = db.GetContext(ctx, &count, db.Rebind(query), args...)
+	return count, errors.WithStack(err)
+}
+
+// GetDuplicateIDs returns the IDs of bookmarks of the same page, see DB.
+func (db *MySQLDatabase) GetDuplicateIDs(ctx context.Context) ([][]int, error) {
+	return getDuplicateIDs(ctx, db)
+}
+
+// DeleteBookmarks removes all record with matching ids from database.
+// Without ids all bookmarks are removed.
+func (db *MySQLDatabase) DeleteBookmarks(ctx context.Context, ids ...int) error {
+	err := db.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ids, err = deleteBookmarks(ctx, tx, ids)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// TrashBookmarks moves bookmarks with matching ids to trash.
+// Without ids all bookmarks are moved.
+func (db *MySQLDatabase) TrashBookmarks(ctx context.Context, ids ...int) error {
+	deletedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	return setBookmarksDeletedAt(ctx, db, ids, deletedAt)
+}
+
+// RestoreBookmarks restores bookmarks with matching ids from trash.
+// Without ids all bookmarks in trash are restored.
+func (db *MySQLDatabase) RestoreBookmarks(ctx context.Context, ids ...int) error {
+	return setBookmarksDeletedAt(ctx, db, ids, nil)
+}
+
+// PurgeBookmarks permanently removes the bookmarks that were moved to trash
+// before olderThan. Returns the ids of removed bookmarks.
+func (db *MySQLDatabase) PurgeBookmarks(ctx context.Context, olderThan time.Time) (ids []int, err error) {
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		ids, err = purgeBookmarks(ctx, tx, olderThan)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, db.deleteBookmarkFiles(ids)
+}
+
+// GetBookmarkRevisions fetch the revisions of a bookmark, newest first.
+func (db *MySQLDatabase) GetBookmarkRevisions(ctx context.Context, bookmarkID int) ([]model.BookmarkRevision, error) {
+	return getBookmarkRevisions(ctx, db, bookmarkID, `created`)
+}
+
+// GetBookmarkRevision fetch a revision including its content.
+func (db *MySQLDatabase) GetBookmarkRevision(ctx context.Context, id int) (model.BookmarkRevision, error) {
+	return getBookmarkRevision(ctx, db, id, `created`)
+}
+
+// RollbackBookmark restores the bookmark to the state of the revision.
+func (db *MySQLDatabase) RollbackBookmark(ctx context.Context, revisionID int) (model.Bookmark, error) {
+	return rollbackBookmark(ctx, db, revisionID)
+}
+
+// SaveBookmarkNotes replaces the Markdown notes of bookmark.
+func (db *MySQLDatabase) SaveBookmarkNotes(ctx context.Context, bookmarkID int, notes string) error {
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return saveBookmarkNotes(ctx, tx, bookmarkID, notes, annotationsQuery)
+	})
+}
+
+// GetHighlights fetch the highlights of bookmark, ordered by their position in the content.
+func (db *MySQLDatabase) GetHighlights(ctx context.Context, bookmarkID int) ([]model.Highlight, error) {
+	return getHighlights(ctx, db, bookmarkID, `created`)
+}
+
+// GetHighlight fetch a single highlight with matching ID.
+func (db *MySQLDatabase) GetHighlight(ctx context.Context, id int) (model.Highlight, error) {
+	return getHighlight(ctx, db, id, `created`)
+}
+
+// SaveHighlight creates new highlight of the bookmark, or updates the one with matching ID.
+func (db *MySQLDatabase) SaveHighlight(ctx context.Context, highlight model.Highlight) (result model.Highlight, err error) {
+	insert := func(ctx context.Context, tx *sqlx.Tx, highlight model.Highlight) (int, error) {
+		res, err := tx.ExecContext(ctx, `INSERT INTO highlight
+			(bookmark_id, created, quote, prefix, suffix, start_offset, end_offset, comment)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			highlight.BookmarkID, highlight.Created, highlight.Quote, highlight.Prefix,
+			highlight.Suffix, highlight.StartOffset, highlight.EndOffset, highlight.Comment)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		id, err := res.LastInsertId()
+		return int(id), errors.WithStack(err)
+	}
+
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err = saveHighlight(ctx, tx, highlight, `created`, annotationsQuery, insert)
+		return err
+	})
+
+	return result, err
+}
+
+// DeleteHighlights removes the highlights with matching IDs.
+func (db *MySQLDatabase) DeleteHighlights(ctx context.Context, ids ...int) error {
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return deleteHighlights(ctx, tx, ids, annotationsQuery)
+	})
+}
+
+// SaveReadingState updates the reading status and progress of bookmark.
+func (db *MySQLDatabase) SaveReadingState(ctx context.Context, bookmarkID int, status string, progress int) error {
+	return saveReadingState(ctx, db, bookmarkID, status, progress)
+}
+
+// WithTx runs fn with a database whose changes are made in one transaction.
+func (db *MySQLDatabase) WithTx(ctx context.Context, fn func(tx DB) error) error {
+	return db.runTx(ctx, func(tx dbbase) error {
+		return fn(&MySQLDatabase{dbbase: tx})
+	})
+}
+
+// GetTags fetch list of tags of the account and the number of their bookmarks.
+func (db *MySQLDatabase) GetTags(ctx context.Context, accountID int) ([]model.Tag, error) {
+	return getTags(ctx, db, accountID)
+}
+
+// mysqlMergeTagQuery copies the bookmarks of a tag to the tag it's merged into.
+const mysqlMergeTagQuery = `INSERT IGNORE INTO bookmark_tag (tag_id, bookmark_id)
+	SELECT ?, bookmark_id FROM bookmark_tag WHERE tag_id = ?`
+
+// RenameTag changes the name of a tag together with its subtree,
+// or merges it into the tag that already has the new name.
+func (db *MySQLDatabase) RenameTag(ctx context.Context, id int, newName string) (tag model.Tag, err error) {
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		tag, err = renameTag(ctx, tx, id, newName, mysqlMergeTagQuery, insertTag)
+		return err
+	})
+
+	return tag, err
+}
+
+// GetAccount fetch account with matching username.
+// Returns the account and boolean whether it's exist or not.
+func (db *MySQLDatabase) GetAccount(ctx context.Context, username string) (model.Account, bool, error) {
+	account := model.Account{}
+	err := db.GetContext(ctx, &account, `SELECT
+		id, username, owner FROM account WHERE username = ?`,
+		username)
+	if err != nil && err != sql.ErrNoRows {
+		return account, false, errors.WithStack(err)
+	}
+
+	return account, account.ID != 0, nil
+}
+
+// GetAccountWithPassword fetch account with matching username, including its password hash.
+// Returns the account and boolean whether it's exist or not.
+func (db *MySQLDatabase) GetAccountWithPassword(ctx context.Context, username string) (model.Account, bool, error) {
+	account := model.Account{}
+	err := db.GetContext(ctx, &account, `SELECT
+		id, username, password, owner FROM account WHERE username = ?`,
+		username)
+	if err != nil && err != sql.ErrNoRows {
+		return account, false, errors.WithStack(err)
+	}
+
+	return account, account.ID != 0, nil
+}
+
+// GetAccounts fetch list of account (without its password) based on submitted options
+func (db *MySQLDatabase) GetAccounts(ctx context.Context, opts GetAccountsOptions) ([]model.Account, error) {
+	// Create query
+	args := []interface{}{}
+	query := `SELECT id, username, owner FROM account WHERE 1`
+
+	if opts.Keyword != "" {
+		query += " AND username LIKE ?"
+		args = append(args, "%"+opts.Keyword+"%")
+	}
+
+	if opts.Owner {
+		query += " AND owner = 1"
+	}
+	query += " ORDER BY username"
+
+	// Fetch list account
+	accounts := []model.Account{}
+	err := db.SelectContext(ctx, &accounts, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	return accounts, nil
+}
+
+// SaveAccount creates new account, its password is hashed with bcrypt.
+// Returns the saved account with its ID filled in, without the password.
+func (db *MySQLDatabase) SaveAccount(ctx context.Context, account model.Account) (model.Account, error) {
+	hash, err := hashPassword(account.Password)
+	if err != nil {
+		return account, err
+	}
+
+	account.ID = 0
+	account.Password = hash
+	return db.SaveAccountWithHash(ctx, account)
+}
+
+// SaveAccountWithHash creates new account whose password is already hashed with bcrypt.
+// A new ID is generated unless the account already has one.
+// Returns the saved account with its ID filled in, without the password.
+func (db *MySQLDatabase) SaveAccountWithHash(ctx context.Context, account model.Account) (model.Account, error) {
+	if account.Username == "" {
+		return account, errors.New("username must not be empty")
+	}
+
+	if account.Password == "" {
+		return account, errors.New("password must not be empty")
+	}
+
+	hash := account.Password
+	account.Password = ""
+
+	res, err := db.ExecContext(ctx, `INSERT INTO account
+		(id, username, password, owner) VALUES (NULLIF(?, 0), ?, ?, ?)`,
+		account.ID, account.Username, hash, account.Owner)
+	if err != nil {
+		return account, mysqlSaveError(err, fmt.Sprintf("account %q", account.Username))
+	}
+
+	accountID, err := res.LastInsertId()
+	if err != nil {
+		return account, errors.WithStack(err)
+	}
+	account.ID = int(accountID)
+
+	return account, nil
+}
+
+// UpdateAccount updates the username and owner of account with matching ID.
+// The password is hashed and updated as well when it's not empty.
+func (db *MySQLDatabase) UpdateAccount(ctx context.Context, account model.Account) error {
+	if account.Username == "" {
+		return errors.New("username must not be empty")
+	}
+
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		// MySQL only reports the rows that actually changed,
+		// so the existence is checked separately.
+		var count int
+		err := tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM account WHERE id = ?`, account.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if count == 0 {
+			return errors.Wrapf(ErrNotFound, "account %d", account.ID)
+		}
+
+		args := []interface{}{account.Username, account.Owner}
+		query := `UPDATE account SET username = ?, owner = ?`
+
+		if account.Password != "" {
+			hash, err := hashPassword(account.Password)
+			if err != nil {
+				return err
+			}
+
+			query += `, password = ?`
+			args = append(args, hash)
+		}
+
+		query += ` WHERE id = ?`
+		args = append(args, account.ID)
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return mysqlSaveError(err, fmt.Sprintf("account %q", account.Username))
+		}
+
+		return nil
+	})
+}
+
+// DeleteAccounts removes all record with matching usernames
+func (db *MySQLDatabase) DeleteAccounts(ctx context.Context, usernames ...string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	var ids []int
+	err := db.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ids, err = deleteAccountBookmarks(ctx, tx, usernames)
+		if err != nil {
+			return err
+		}
+
+		if err := deleteAccountSavedSearches(ctx, tx, usernames); err != nil {
+			return err
+		}
+
+		query, args, err := sqlx.In(`DELETE FROM account WHERE username IN (?)`, usernames)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// GetSavedSearches fetch the saved searches of the account, ordered by name.
+func (db *MySQLDatabase) GetSavedSearches(ctx context.Context, accountID int) ([]model.SavedSearch, error) {
+	return getSavedSearches(ctx, db, accountID)
+}
+
+// GetSavedSearch fetch the saved search with matching ID that belongs to the account.
+func (db *MySQLDatabase) GetSavedSearch(ctx context.Context, accountID, id int) (model.SavedSearch, bool, error) {
+	return getSavedSearch(ctx, db, accountID, id)
+}
+
+// SaveSavedSearch creates new saved search, or updates the one with matching ID.
+func (db *MySQLDatabase) SaveSavedSearch(ctx context.Context, search model.SavedSearch) (model.SavedSearch, error) {
+	if err := validateSavedSearch(&search); err != nil {
+		return search, err
+	}
+
+	if search.ID != 0 {
+		return search, updateSavedSearch(ctx, db, search, mysqlSaveError)
+	}
+
+	res, err := db.ExecContext(ctx, `INSERT INTO saved_search
+		(account_id, name, query) VALUES (?, ?, ?)`,
+		search.AccountID, search.Name, search.Query)
+	if err != nil {
+		return search, mysqlSaveError(err, fmt.Sprintf("saved search %q", search.Name))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return search, errors.WithStack(err)
+	}
+	search.ID = int(id)
+
+	return search, nil
+}
+
+// DeleteSavedSearches removes the saved searches of the account with matching IDs.
+func (db *MySQLDatabase) DeleteSavedSearches(ctx context.Context, accountID int, ids ...int) error {
+	return deleteSavedSearches(ctx, db, accountID, ids)
+}
+
+// mysqlSaveError converts the error of saving a record, so the violation
+// of an unique key is reported as ErrAlreadyExists for the record.
+func mysqlSaveError(err error, record string) error {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return errors.Wrap(ErrAlreadyExists, record)
+	}
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// The MySQL tests need a running server, e.g. from a local container:
+//
+//	docker run --rm -p 3306:3306 -e MYSQL_ROOT_PASSWORD=shiori -e MYSQL_DATABASE=shiori mariadb
+//	SHIORI_TEST_MYSQL_URL="root:shiori@tcp(127.0.0.1:3306)/shiori" go test ./internal/database
+//
+// The database in SHIORI_TEST_MYSQL_URL is dropped and created again for every test.
+func mysqlTestDatabaseFactory(t *testing.T) DB {
+	ctx := context.TODO()
+	connString := os.Getenv("SHIORI_TEST_MYSQL_URL")
+
+	// Recreate the database with a connection that doesn't use it
+	cfg, err := mysqldriver.ParseDSN(connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbName := cfg.DBName
+	cfg.DBName = ""
+
+	server, err := sqlx.ConnectContext(ctx, "mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	for _, query := range []string{
+		"DROP DATABASE IF EXISTS `" + dbName + "`",
+		"CREATE DATABASE `" + dbName + "` CHARACTER SET utf8mb4",
+	} {
+		if _, err := server.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := OpenMySQLDatabase(ctx, connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestMySQLDatabase(t *testing.T) {
+	if os.Getenv("SHIORI_TEST_MYSQL_URL") == "" {
+		t.Skip("SHIORI_TEST_MYSQL_URL is not set")
+	}
+
+	testDatabase(t, mysqlTestDatabaseFactory)
+}
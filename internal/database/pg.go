@@ -0,0 +1,903 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// PGDatabase is implementation of Database interface
+// for connecting to PostgreSQL database.
+type PGDatabase struct {
+	dbbase
+}
+
+// OpenPGDatabase creates and opens connection to a PostgreSQL Database.
+func OpenPGDatabase(ctx context.Context, connString string) (pgDB *PGDatabase, err error) {
+	// open database
+	db, err := sqlx.ConnectContext(ctx, "postgres", connString)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(100)
+	db.SetConnMaxLifetime(time.Second)
+
+	pgDB = &PGDatabase{
+		dbbase: dbbase{DB: *db, revisionLimit: DefaultRevisionLimit},
+	}
+	return pgDB, nil
+}
+
+// migration returns the migration of PostgreSQL schema.
+func (db *PGDatabase) migration() (*migrate.Migrate, error) {
+	dbDrive, err := postgres.WithInstance(db.DB.DB, &postgres.Config{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return newMigration("migrations/postgres", "postgres", dbDrive)
+}
+
+// Migrate runs migrations for this database engine
+func (db *PGDatabase) Migrate() error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateUp(migration); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// fixMigratedData fixes the data after migrating from fromVersion, see migrationFixes.
+func (db *PGDatabase) fixMigratedData(migration *migrate.Migrate, fromVersion uint) error {
+	return fixMigratedData(&db.dbbase, migration, fromVersion, migrationFixes(pgInsertTag, pgMergeTagQuery))
+}
+
+// prepareRevert prepares the data for migrating down to toVersion, see migrationReverts.
+func (db *PGDatabase) prepareRevert(migration *migrate.Migrate, toVersion uint) error {
+	return prepareRevert(&db.dbbase, migration, toVersion, migrationReverts(pgMergeTagQuery))
+}
+
+// MigrateSteps applies the next n migrations, or reverts the last -n migrations.
+func (db *PGDatabase) MigrateSteps(n int) error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := db.prepareRevert(migration, stepsVersion(fromVersion, n)); err != nil {
+		return err
+	}
+
+	if err := migrateSteps(migration, n); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// MigrateTo migrates the schema up or down to the version.
+func (db *PGDatabase) MigrateTo(version uint) error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := db.prepareRevert(migration, version); err != nil {
+		return err
+	}
+
+	if err := migrateTo(migration, version); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// MigrationStatus reports the schema version and the available migrations.
+func (db *PGDatabase) MigrationStatus() (MigrationStatus, error) {
+	migration, err := db.migration()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	return migrationStatus(migration, "migrations/postgres")
+}
+
+// SaveBookmarks saves new or updated bookmarks to database.
+// When create is true the bookmarks are inserted, otherwise they are updated by ID.
+// Returns the saved bookmarks with their IDs filled in.
+func (db *PGDatabase) SaveBookmarks(ctx context.Context, create bool, bookmarks ...model.Bookmark) ([]model.Bookmark, error) {
+	result := []model.Bookmark{}
+
+	err := db.withTx(ctx, func(tx *sqlx.Tx) error {
+		// Prepare statement
+		// A new ID is generated unless the bookmark already has one
+		stmtInsertBook, err := tx.PreparexContext(ctx, `INSERT INTO bookmark
+			(id, account_id, url, title, excerpt, author, public, content, html, modified, deleted_at, canonical_url,
+			notes, reading_status, reading_progress)
+			VALUES(COALESCE(NULLIF($1, 0), NEXTVAL(PG_GET_SERIAL_SEQUENCE('bookmark', 'id'))),
+			$2, $3, $4, $5, $6, $7, $8, $9, $10, CAST(NULLIF($11, '') AS TIMESTAMP), $12, $13, $14, $15)
+			RETURNING id`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBook.Close()
+
+		stmtUpdateBook, err := tx.PreparexContext(ctx, `UPDATE bookmark SET
+			url = $1, title = $2, excerpt = $3, author = $4,
+			public = $5, content = $6, html = $7, modified = $8, canonical_url = $9, notes = $10,
+			reading_status = $11, reading_progress = $12
+			WHERE id = $13`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtUpdateBook.Close()
+
+		stmtGetTag, err := tx.PreparexContext(ctx, `SELECT id FROM tag WHERE account_id = $1 AND name = $2`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtGetTag.Close()
+
+		stmtInsertBookTag, err := tx.PreparexContext(ctx, `INSERT INTO bookmark_tag
+			(tag_id, bookmark_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBookTag.Close()
+
+		stmtDeleteBookTag, err := tx.PreparexContext(ctx, `DELETE FROM bookmark_tag
+			WHERE bookmark_id = $1 AND tag_id = $2`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtDeleteBookTag.Close()
+
+		// Prepare modified time
+		modifiedTime := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+		// Execute statements
+		for _, book := range bookmarks {
+			// Check URL and title
+			if book.URL == "" {
+				return errors.New("URL must not be empty")
+			}
+
+			if book.Title == "" {
+				return errors.New("title must not be empty")
+			}
+
+			// Set modified time
+			if book.Modified == "" {
+				book.Modified = modifiedTime
+			}
+
+			// Check reading state, new bookmark is unread
+			book.ReadingStatus, err = validateReadingState(book.ReadingStatus, book.ReadingProgress)
+			if err != nil {
+				return err
+			}
+
+			// The account of bookmark isn't changed by update
+			if !create {
+				book.AccountID, err = bookmarkAccountID(ctx, tx, book.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			// The same page must not be saved twice by the account
+			canonicalURL := CanonicalURL(book.URL)
+			if err := checkCanonicalURL(ctx, tx, book, canonicalURL); err != nil {
+				return err
+			}
+
+			// Create or update bookmark
+			if create {
+				keepID := book.ID != 0
+				err := stmtInsertBook.QueryRowContext(ctx, book.ID, book.AccountID,
+					book.URL, book.Title, book.Excerpt, book.Author,
+					book.Public, book.Content, book.HTML, book.Modified, book.DeletedAt, canonicalURL, book.Notes,
+					book.ReadingStatus, book.ReadingProgress).Scan(&book.ID)
+				if err != nil {
+					return pgSaveError(err, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				// The sequence doesn't know about the kept ID
+				if keepID {
+					if err := pgResetSequence(ctx, tx, "bookmark"); err != nil {
+						return err
+					}
+				}
+			} else {
+				// Keep the current state as revision before updating it
+				err = saveBookmarkRevision(ctx, tx, book.ID, db.revisionLimit, `SELECT title, excerpt, content, html
+					FROM bookmark WHERE id = ?`)
+				if err != nil {
+					return err
+				}
+
+				res, err := stmtUpdateBook.ExecContext(ctx,
+					book.URL, book.Title, book.Excerpt, book.Author,
+					book.Public, book.Content, book.HTML, book.Modified, canonicalURL, book.Notes,
+					book.ReadingStatus, book.ReadingProgress, book.ID)
+				if err != nil {
+					return pgSaveError(err, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				rows, err := res.RowsAffected()
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				if rows == 0 {
+					return errors.Wrapf(ErrNotFound, "bookmark %d", book.ID)
+				}
+			}
+			book.HasContent = book.Content != ""
+
+			// Index the notes together with the highlights
+			if err := saveAnnotations(ctx, tx, book.ID, annotationsQuery); err != nil {
+				return err
+			}
+
+			// Save bookmark tags
+			newTags := []model.Tag{}
+			for _, tag := range book.Tags {
+				// Normalize tag name
+				tag.Name = normalizeTagName(tag.Name)
+
+				// Tag is found by its name within the account of bookmark, its ID is
+				// only used without name and must belong to the account as well
+				if tag.Name != "" {
+					tag.ID = 0
+					err = stmtGetTag.GetContext(ctx, &tag.ID, book.AccountID, tag.Name)
+					if err != nil && err != sql.ErrNoRows {
+						return errors.WithStack(err)
+					}
+				} else if tag.ID != 0 {
+					if err := checkTagAccount(ctx, tx, tag.ID, book.AccountID); err != nil {
+						return err
+					}
+				}
+
+				// If it's deleted tag, delete and continue
+				if tag.Deleted {
+					if tag.ID != 0 {
+						_, err = stmtDeleteBookTag.ExecContext(ctx, book.ID, tag.ID)
+						if err != nil {
+							return errors.WithStack(err)
+						}
+					}
+					continue
+				}
+
+				// If tag doesn't exist in database, save it
+				if tag.ID == 0 {
+					if tag.Name == "" {
+						continue
+					}
+
+					// Create it with its missing parents
+					tag.ID, err = saveTag(ctx, tx, book.AccountID, tag.Name, pgInsertTag)
+					if err != nil {
+						return err
+					}
+				}
+
+				_, err = stmtInsertBookTag.ExecContext(ctx, tag.ID, book.ID)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+
+				newTags = append(newTags, tag)
+			}
+
+			book.Tags = newTags
+			result = append(result, book)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// pgSearchVector returns the text search vector of bookmark, with annotations
+// the notes and highlights are included.
+func pgSearchVector(annotations bool) string {
+	if annotations {
+		return `b.search_vector`
+	}
+
+	return `TO_TSVECTOR('simple', b.title || ' ' || b.excerpt || ' ' || b.content)`
+}
+
+// pgKeywordClause returns the condition for bookmarks that have the keyword
+// in their URL, title, excerpt, content or, with annotations, notes or highlights.
+func pgKeywordClause(keyword string, annotations bool) (string, []interface{}) {
+	query := `b.url ILIKE ? OR b.title ILIKE ? OR b.excerpt ILIKE ? OR
+		` + pgSearchVector(annotations) + ` @@ PLAINTO_TSQUERY('simple', ?)`
+
+	return query, []interface{}{
+		"%" + keyword + "%",
+		"%" + keyword + "%",
+		"%" + keyword + "%",
+		keyword}
+}
+
+// pgSearchDialect is the SQL of PostgreSQL for search queries.
+var pgSearchDialect = searchDialect{
+	keyword:    pgKeywordClause,
+	hasContent: `b.content <> ''`,
+	host: `SPLIT_PART(SPLIT_PART(SPLIT_PART(SPLIT_PART(
+		SUBSTR(b.url, STRPOS(b.url, '://') + 3), '/', 1), '?', 1), '#', 1), ':', 1)`,
+}
+
+// pgURLWithoutScheme is the URL after its scheme, see urlWithoutScheme.
+const pgURLWithoutScheme = `SUBSTRING(b.url FROM
+	CASE WHEN POSITION('://' IN b.url) > 0 THEN POSITION('://' IN b.url) + 3 ELSE 1 END)`
+
+// pgOrders is the sort order of bookmarks for each OrderMethod.
+var pgOrders = map[OrderMethod]orderSpec{
+	DefaultOrder:   {},
+	ByLastAdded:    {desc: true},
+	ByLastModified: {key: "b.modified", keyParam: "CAST(? AS TIMESTAMP)", desc: true},
+	ByTitle:        {key: "LOWER(b.title)", keyParam: "LOWER(?)"},
+	ByURL:          {key: "LOWER(" + pgURLWithoutScheme + ")", keyParam: "LOWER(?)"},
+	ByUnread:       {key: readingStatusRank},
+}
+
+// GetBookMarks fetch list of bookmarks based on submitted options.
+func (db *PGDatabase) GetBookMarks(ctx context.Context, opts GetBookmarksOptions) ([]model.Bookmark, error) {
+	order, cursor, err := orderAndCursor(pgOrders, &opts)
+	if err != nil {
+		return nil, err
+	}
+	keywords := opts.keywords()
+	orderByRelevance := opts.OrderMethod == ByRelevance && len(keywords) > 0
+
+	// Create initial query
+	columns := []string{
+		`b.id`,
+		`b.account_id`,
+		`b.url`,
+		`b.title`,
+		`b.excerpt`,
+		`b.author`,
+		`b.public`,
+		`TO_CHAR(b.modified, 'YYYY-MM-DD HH24:MI:SS') modified`,
+		`b.notes`,
+		`b.reading_status`,
+		`b.reading_progress`,
+		`b.content <> '' has_content`,
+		`COALESCE(TO_CHAR(b.deleted_at, 'YYYY-MM-DD HH24:MI:SS'), '') deleted_at`}
+
+	if opts.WithContent {
+		columns = append(columns,
+			`b.content`,
+			`b.html`)
+	}
+
+	query := `SELECT ` + strings.Join(columns, ",") + `
+		FROM bookmark b
+		WHERE TRUE`
+
+	// Add where clause
+	args := []interface{}{}
+
+	// Add where clause for the filters of options
+	filterQuery, filterArgs := bookmarksFilterClause(opts, pgSearchDialect)
+	query += filterQuery
+	args = append(args, filterArgs...)
+
+	// Add where clause for cursor
+	if cursor != nil {
+		cursorQuery, cursorArgs := order.where(*cursor)
+		query += cursorQuery
+		args = append(args, cursorArgs...)
+	}
+
+	// Add order clause
+	if orderByRelevance {
+		query += ` ORDER BY TS_RANK(` + pgSearchVector(!opts.WithoutAnnotations) + `,
+			PLAINTO_TSQUERY('simple', ?)) DESC, b.id DESC`
+		args = append(args, strings.Join(keywords, " "))
+	} else {
+		query += order.orderBy(cursor != nil && cursor.Backward)
+	}
+
+	if opts.Limit > 0 && cursor != nil {
+		query += ` LIMIT ?`
+		args = append(args, opts.Limit)
+	} else if opts.Limit > 0 && opts.Offset >= 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, opts.Limit, opts.Offset)
+	}
+
+	// Expand query, because some of the args might be an array
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	query = db.Rebind(query)
+
+	// Fetch bookmarks
+	bookmarks := []model.Bookmark{}
+	err = db.SelectContext(ctx, &bookmarks, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(bookmarks) == 0 {
+		return bookmarks, nil
+	}
+
+	if cursor != nil && cursor.Backward {
+		reverseBookmarks(bookmarks)
+	}
+
+	// Store bookmark index by its ID for further enrichment
+	bookmarkIDs := make([]int, 0, len(bookmarks))
+	bookmarkMap := make(map[int]int, len(bookmarks))
+	for i := range bookmarks {
+		bookmarks[i].Tags = []model.Tag{}
+		bookmarkIDs = append(bookmarkIDs, bookmarks[i].ID)
+		bookmarkMap[bookmarks[i].ID] = i
+	}
+
+	// Fetch tags for each bookmarks
+	tagsQuery, tagsArgs, err := sqlx.In(`SELECT bt.bookmark_id, t.id, t.name
+		FROM bookmark_tag bt
+		LEFT JOIN tag t ON bt.tag_id = t.id
+		WHERE bt.bookmark_id IN (?)
+		ORDER BY t.name`, bookmarkIDs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tagsQuery = db.Rebind(tagsQuery)
+
+	bookmarkTags := []struct {
+		BookmarkID int `db:"bookmark_id"`
+		model.Tag
+	}{}
+	err = db.SelectContext(ctx, &bookmarkTags, tagsQuery, tagsArgs...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, bt := range bookmarkTags {
+		if i, ok := bookmarkMap[bt.BookmarkID]; ok {
+			bookmarks[i].Tags = append(bookmarks[i].Tags, bt.Tag)
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// GetBookmarksCount returns the number of bookmarks that match opts.
+func (db *PGDatabase) GetBookmarksCount(ctx context.Context, opts GetBookmarksOptions) (int, error) {
+	filterQuery, filterArgs := bookmarksFilterClause(opts, pgSearchDialect)
+
+	// Expand query, because some of the args might be an array
+	query, args, err := sqlx.In(`SELECT COUNT(b.id) FROM bookmark b WHERE TRUE`+filterQuery, filterArgs...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	count := 0
+	err = db.GetContext(ctx, &count, db.Rebind(query), args...)
+	return count, errors.WithStack(err)
+}
+
+// GetDuplicateIDs returns the IDs of bookmarks of the same page, see DB.
+func (db *PGDatabase) GetDuplicateIDs(ctx context.Context) ([][]int, error) {
+	return getDuplicateIDs(ctx, db)
+}
+
+// DeleteBookmarks removes all record with matching ids from database.
+// Without ids all bookmarks are removed.
+func (db *PGDatabase) DeleteBookmarks(ctx context.Context, ids ...int) error {
+	err := db.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ids, err = deleteBookmarks(ctx, tx, ids)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// TrashBookmarks moves bookmarks with matching ids to trash.
+// Without ids all bookmarks are moved.
+func (db *PGDatabase) TrashBookmarks(ctx context.Context, ids ...int) error {
+	deletedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	return setBookmarksDeletedAt(ctx, db, ids, deletedAt)
+}
+
+// RestoreBookmarks restores bookmarks with matching ids from trash.
+// Without ids all bookmarks in trash are restored.
+func (db *PGDatabase) RestoreBookmarks(ctx context.Context, ids ...int) error {
+	return setBookmarksDeletedAt(ctx, db, ids, nil)
+}
+
+// PurgeBookmarks permanently removes the bookmarks that were moved to trash
+// before olderThan. Returns the ids of removed bookmarks.
+func (db *PGDatabase) PurgeBookmarks(ctx context.Context, olderThan time.Time) (ids []int, err error) {
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		ids, err = purgeBookmarks(ctx, tx, olderThan)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, db.deleteBookmarkFiles(ids)
+}
+
+// GetBookmarkRevisions fetch the revisions of a bookmark, newest first.
+func (db *PGDatabase) GetBookmarkRevisions(ctx context.Context, bookmarkID int) ([]model.BookmarkRevision, error) {
+	return getBookmarkRevisions(ctx, db, bookmarkID, `TO_CHAR(created, 'YYYY-MM-DD HH24:MI:SS')`)
+}
+
+// GetBookmarkRevision fetch a revision including its content.
+func (db *PGDatabase) GetBookmarkRevision(ctx context.Context, id int) (model.BookmarkRevision, error) {
+	return getBookmarkRevision(ctx, db, id, `TO_CHAR(created, 'YYYY-MM-DD HH24:MI:SS')`)
+}
+
+// RollbackBookmark restores the bookmark to the state of the revision.
+func (db *PGDatabase) RollbackBookmark(ctx context.Context, revisionID int) (model.Bookmark, error) {
+	return rollbackBookmark(ctx, db, revisionID)
+}
+
+// SaveBookmarkNotes replaces the Markdown notes of bookmark.
+func (db *PGDatabase) SaveBookmarkNotes(ctx context.Context, bookmarkID int, notes string) error {
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return saveBookmarkNotes(ctx, tx, bookmarkID, notes, annotationsQuery)
+	})
+}
+
+// GetHighlights fetch the highlights of bookmark, ordered by their position in the content.
+func (db *PGDatabase) GetHighlights(ctx context.Context, bookmarkID int) ([]model.Highlight, error) {
+	return getHighlights(ctx, db, bookmarkID, `TO_CHAR(created, 'YYYY-MM-DD HH24:MI:SS')`)
+}
+
+// GetHighlight fetch a single highlight with matching ID.
+func (db *PGDatabase) GetHighlight(ctx context.Context, id int) (model.Highlight, error) {
+	return getHighlight(ctx, db, id, `TO_CHAR(created, 'YYYY-MM-DD HH24:MI:SS')`)
+}
+
+// SaveHighlight creates new highlight of the bookmark, or updates the one with matching ID.
+func (db *PGDatabase) SaveHighlight(ctx context.Context, highlight model.Highlight) (result model.Highlight, err error) {
+	insert := func(ctx context.Context, tx *sqlx.Tx, highlight model.Highlight) (int, error) {
+		var id int
+		err := tx.QueryRowContext(ctx, `INSERT INTO highlight
+			(bookmark_id, created, quote, prefix, suffix, start_offset, end_offset, comment)
+			VALUES ($1, CAST($2 AS TIMESTAMP), $3, $4, $5, $6, $7, $8)
+			RETURNING id`,
+			highlight.BookmarkID, highlight.Created, highlight.Quote, highlight.Prefix,
+			highlight.Suffix, highlight.StartOffset, highlight.EndOffset, highlight.Comment).Scan(&id)
+		return id, errors.WithStack(err)
+	}
+
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err = saveHighlight(ctx, tx, highlight, `TO_CHAR(created, 'YYYY-MM-DD HH24:MI:SS')`, annotationsQuery, insert)
+		return err
+	})
+
+	return result, err
+}
+
+// DeleteHighlights removes the highlights with matching IDs.
+func (db *PGDatabase) DeleteHighlights(ctx context.Context, ids ...int) error {
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return deleteHighlights(ctx, tx, ids, annotationsQuery)
+	})
+}
+
+// SaveReadingState updates the reading status and progress of bookmark.
+func (db *PGDatabase) SaveReadingState(ctx context.Context, bookmarkID int, status string, progress int) error {
+	return saveReadingState(ctx, db, bookmarkID, status, progress)
+}
+
+// WithTx runs fn with a database whose changes are made in one transaction.
+func (db *PGDatabase) WithTx(ctx context.Context, fn func(tx DB) error) error {
+	return db.runTx(ctx, func(tx dbbase) error {
+		return fn(&PGDatabase{dbbase: tx})
+	})
+}
+
+// GetTags fetch list of tags of the account and the number of their bookmarks.
+func (db *PGDatabase) GetTags(ctx context.Context, accountID int) ([]model.Tag, error) {
+	return getTags(ctx, db, accountID)
+}
+
+// pgInsertTag inserts a tag and returns its ID using RETURNING clause.
+func pgInsertTag(ctx context.Context, tx *sqlx.Tx, accountID int, name string, parentID sql.NullInt64) (int, error) {
+	var id int
+	err := tx.GetContext(ctx, &id, `INSERT INTO tag (account_id, name, parent_id)
+		VALUES ($1, $2, $3) RETURNING id`, accountID, name, parentID)
+	return id, errors.WithStack(err)
+}
+
+// pgMergeTagQuery copies the bookmarks of a tag to the tag it's merged into.
+const pgMergeTagQuery = `INSERT INTO bookmark_tag (tag_id, bookmark_id)
+	SELECT ?, bookmark_id FROM bookmark_tag WHERE tag_id = ?
+	ON CONFLICT DO NOTHING`
+
+// RenameTag changes the name of a tag together with its subtree,
+// or merges it into the tag that already has the new name.
+func (db *PGDatabase) RenameTag(ctx context.Context, id int, newName string) (tag model.Tag, err error) {
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		tag, err = renameTag(ctx, tx, id, newName, pgMergeTagQuery, pgInsertTag)
+		return err
+	})
+
+	return tag, err
+}
+
+// GetAccount fetch account with matching username.
+// Returns the account and boolean whether it's exist or not.
+func (db *PGDatabase) GetAccount(ctx context.Context, username string) (model.Account, bool, error) {
+	account := model.Account{}
+	err := db.GetContext(ctx, &account, `SELECT
+		id, username, owner FROM account WHERE username = $1`,
+		username)
+	if err != nil && err != sql.ErrNoRows {
+		return account, false, errors.WithStack(err)
+	}
+
+	return account, account.ID != 0, nil
+}
+
+// GetAccountWithPassword fetch account with matching username, including its password hash.
+// Returns the account and boolean whether it's exist or not.
+func (db *PGDatabase) GetAccountWithPassword(ctx context.Context, username string) (model.Account, bool, error) {
+	account := model.Account{}
+	err := db.GetContext(ctx, &account, `SELECT
+		id, username, password, owner FROM account WHERE username = $1`,
+		username)
+	if err != nil && err != sql.ErrNoRows {
+		return account, false, errors.WithStack(err)
+	}
+
+	return account, account.ID != 0, nil
+}
+
+// GetAccounts fetch list of account (without its password) based on submitted options
+func (db *PGDatabase) GetAccounts(ctx context.Context, opts GetAccountsOptions) ([]model.Account, error) {
+	// Create query
+	args := []interface{}{}
+	query := `SELECT id, username, owner FROM account WHERE TRUE`
+
+	if opts.Keyword != "" {
+		query += " AND username ILIKE ?"
+		args = append(args, "%"+opts.Keyword+"%")
+	}
+
+	if opts.Owner {
+		query += " AND owner = TRUE"
+	}
+	query += " ORDER BY username"
+	query = db.Rebind(query)
+
+	// Fetch list account
+	accounts := []model.Account{}
+	err := db.SelectContext(ctx, &accounts, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	return accounts, nil
+}
+
+// SaveAccount creates new account, its password is hashed with bcrypt.
+// Returns the saved account with its ID filled in, without the password.
+func (db *PGDatabase) SaveAccount(ctx context.Context, account model.Account) (model.Account, error) {
+	hash, err := hashPassword(account.Password)
+	if err != nil {
+		return account, err
+	}
+
+	account.ID = 0
+	account.Password = hash
+	return db.SaveAccountWithHash(ctx, account)
+}
+
+// SaveAccountWithHash creates new account whose password is already hashed with bcrypt.
+// A new ID is generated unless the account already has one.
+// Returns the saved account with its ID filled in, without the password.
+func (db *PGDatabase) SaveAccountWithHash(ctx context.Context, account model.Account) (model.Account, error) {
+	if account.Username == "" {
+		return account, errors.New("username must not be empty")
+	}
+
+	if account.Password == "" {
+		return account, errors.New("password must not be empty")
+	}
+
+	hash := account.Password
+	account.Password = ""
+
+	err := db.withTx(ctx, func(tx *sqlx.Tx) error {
+		keepID := account.ID != 0
+		err := tx.QueryRowContext(ctx, `INSERT INTO account
+			(id, username, password, owner)
+			VALUES (COALESCE(NULLIF($1, 0), NEXTVAL(PG_GET_SERIAL_SEQUENCE('account', 'id'))), $2, $3, $4)
+			RETURNING id`,
+			account.ID, account.Username, hash, account.Owner).Scan(&account.ID)
+		if err != nil {
+			return pgSaveError(err, fmt.Sprintf("account %q", account.Username))
+		}
+
+		// The sequence doesn't know about the kept ID
+		if keepID {
+			return pgResetSequence(ctx, tx, "account")
+		}
+		return nil
+	})
+
+	return account, err
+}
+
+// UpdateAccount updates the username and owner of account with matching ID.
+// The password is hashed and updated as well when it's not empty.
+func (db *PGDatabase) UpdateAccount(ctx context.Context, account model.Account) error {
+	if account.Username == "" {
+		return errors.New("username must not be empty")
+	}
+
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		args := []interface{}{account.Username, account.Owner}
+		query := `UPDATE account SET username = ?, owner = ?`
+
+		if account.Password != "" {
+			hash, err := hashPassword(account.Password)
+			if err != nil {
+				return err
+			}
+
+			query += `, password = ?`
+			args = append(args, hash)
+		}
+
+		query += ` WHERE id = ?`
+		args = append(args, account.ID)
+		query = tx.Rebind(query)
+
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return pgSaveError(err, fmt.Sprintf("account %q", account.Username))
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if rows == 0 {
+			return errors.Wrapf(ErrNotFound, "account %d", account.ID)
+		}
+
+		return nil
+	})
+}
+
+// DeleteAccounts removes all record with matching usernames
+func (db *PGDatabase) DeleteAccounts(ctx context.Context, usernames ...string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	var ids []int
+	err := db.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ids, err = deleteAccountBookmarks(ctx, tx, usernames)
+		if err != nil {
+			return err
+		}
+
+		if err := deleteAccountSavedSearches(ctx, tx, usernames); err != nil {
+			return err
+		}
+
+		query, args, err := sqlx.In(`DELETE FROM account WHERE username IN (?)`, usernames)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// GetSavedSearches fetch the saved searches of the account, ordered by name.
+func (db *PGDatabase) GetSavedSearches(ctx context.Context, accountID int) ([]model.SavedSearch, error) {
+	return getSavedSearches(ctx, db, accountID)
+}
+
+// GetSavedSearch fetch the saved search with matching ID that belongs to the account.
+func (db *PGDatabase) GetSavedSearch(ctx context.Context, accountID, id int) (model.SavedSearch, bool, error) {
+	return getSavedSearch(ctx, db, accountID, id)
+}
+
+// SaveSavedSearch creates new saved search, or updates the one with matching ID.
+func (db *PGDatabase) SaveSavedSearch(ctx context.Context, search model.SavedSearch) (model.SavedSearch, error) {
+	if err := validateSavedSearch(&search); err != nil {
+		return search, err
+	}
+
+	if search.ID != 0 {
+		return search, updateSavedSearch(ctx, db, search, pgSaveError)
+	}
+
+	err := db.QueryRowContext(ctx, `INSERT INTO saved_search
+		(account_id, name, query) VALUES ($1, $2, $3)
+		RETURNING id`,
+		search.AccountID, search.Name, search.Query).Scan(&search.ID)
+	if err != nil {
+		return search, pgSaveError(err, fmt.Sprintf("saved search %q", search.Name))
+	}
+
+	return search, nil
+}
+
+// DeleteSavedSearches removes the saved searches of the account with matching IDs.
+func (db *PGDatabase) DeleteSavedSearches(ctx context.Context, accountID int, ids ...int) error {
+	return deleteSavedSearches(ctx, db, accountID, ids)
+}
+
+// pgSaveError converts the error of saving a record, so the violation
+// of an unique constraint is reported as ErrAlreadyExists for the record.
+func pgSaveError(err error, record string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errors.Wrap(ErrAlreadyExists, record)
+	}
+
+	return errors.WithStack(err)
+}
+
+// pgResetSequence moves the ID sequence of the table past its largest ID,
+// so the next generated ID doesn't collide with an ID that was set explicitly.
+func pgResetSequence(ctx context.Context, tx *sqlx.Tx, table string) error {
+	_, err := tx.ExecContext(ctx, `SELECT SETVAL(PG_GET_SERIAL_SEQUENCE($1, 'id'),
+		(SELECT COALESCE(MAX(id), 1) FROM `+table+`))`, table)
+	return errors.WithStack(err)
+}
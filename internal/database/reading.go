@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+// readingStatusRank is the expression that orders the reading status of bookmark
+// as unread, in progress, then read. It's a string to be used as cursor key.
+const readingStatusRank = `CASE b.reading_status WHEN 'unread' THEN '0' WHEN 'in_progress' THEN '1' ELSE '2' END`
+
+// statusRank returns the rank of reading status that matches readingStatusRank.
+func statusRank(status string) string {
+	switch status {
+	case model.StatusUnread:
+		return "0"
+	case model.StatusInProgress:
+		return "1"
+	default:
+		return "2"
+	}
+}
+
+// validateReadingState checks that status is a known reading status and progress is
+// a percentage. Empty status is treated as unread.
+func validateReadingState(status string, progress int) (string, error) {
+	switch status {
+	case "":
+		status = model.StatusUnread
+	case model.StatusUnread, model.StatusInProgress, model.StatusRead:
+	default:
+		return status, errors.Errorf("invalid reading status %q", status)
+	}
+
+	if progress < 0 || progress > 100 {
+		return status, errors.Errorf("invalid reading progress %d", progress)
+	}
+
+	return status, nil
+}
+
+// saveReadingState updates the reading status and progress of bookmark.
+// It isn't an edit of bookmark, so neither modified time nor revision is changed.
+func saveReadingState(ctx context.Context, db sqlx.ExtContext, bookmarkID int, status string, progress int) error {
+	status, err := validateReadingState(status, progress)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, db.Rebind(`UPDATE bookmark
+		SET reading_status = ?, reading_progress = ?
+		WHERE id = ?`), status, progress, bookmarkID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// MySQL doesn't count the rows that aren't changed, so check whether it exists
+	if rows == 0 {
+		var nBookmarks int
+		err := sqlx.GetContext(ctx, db, &nBookmarks, db.Rebind(`SELECT COUNT(id) FROM bookmark WHERE id = ?`), bookmarkID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if nBookmarks == 0 {
+			return errors.Wrapf(ErrNotFound, "bookmark %d", bookmarkID)
+		}
+	}
+
+	return nil
+}
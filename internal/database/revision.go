@@ -0,0 +1,397 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+)
+
+// DefaultRevisionLimit is the number of revisions kept for each bookmark by default.
+const DefaultRevisionLimit = 20
+
+// revisionRow is bookmark_revision row, the tag names are stored one per line.
+type revisionRow struct {
+	model.BookmarkRevision
+	TagNames string `db:"tags"`
+}
+
+func (row revisionRow) revision() model.BookmarkRevision {
+	revision := row.BookmarkRevision
+	revision.Tags = []string{}
+	if row.TagNames != "" {
+		revision.Tags = strings.Split(row.TagNames, "\n")
+	}
+	return revision
+}
+
+// saveBookmarkRevision records the current state of the bookmark before it's updated,
+// then removes its oldest revisions so at most limit revisions are kept.
+// snapshotQuery selects title, excerpt, content and html of the bookmark by its ID.
+func saveBookmarkRevision(ctx context.Context, tx *sqlx.Tx, bookmarkID, limit int, snapshotQuery string) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	row := revisionRow{}
+	err := tx.GetContext(ctx, &row, tx.Rebind(snapshotQuery), bookmarkID)
+	if err == sql.ErrNoRows {
+		// Nothing to record, the update will report the missing bookmark
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tags := []string{}
+	err = tx.SelectContext(ctx, &tags, tx.Rebind(`SELECT t.name
+		FROM bookmark_tag bt
+		LEFT JOIN tag t ON bt.tag_id = t.id
+		WHERE bt.bookmark_id = ?
+		ORDER BY t.name`), bookmarkID)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.WithStack(err)
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(`INSERT INTO bookmark_revision
+		(bookmark_id, created, title, excerpt, tags, content, html)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		bookmarkID, time.Now().UTC().Format("2006-01-02 15:04:05"),
+		row.Title, row.Excerpt, strings.Join(tags, "\n"), row.Content, row.HTML)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Remove the revisions beyond the limit
+	var lastID int
+	err = tx.GetContext(ctx, &lastID, tx.Rebind(`SELECT id FROM bookmark_revision
+		WHERE bookmark_id = ?
+		ORDER BY id DESC
+		LIMIT 1 OFFSET ?`), bookmarkID, limit)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(`DELETE FROM bookmark_revision
+		WHERE bookmark_id = ? AND id <= ?`), bookmarkID, lastID)
+	return errors.WithStack(err)
+}
+
+// getBookmarkRevisions fetch the revisions of a bookmark without their content, newest first.
+// createdColumn is the expression that selects created time as "2006-01-02 15:04:05".
+func getBookmarkRevisions(ctx context.Context, db sqlx.ExtContext, bookmarkID int, createdColumn string) ([]model.BookmarkRevision, error) {
+	rows := []revisionRow{}
+	err := sqlx.SelectContext(ctx, db, &rows, db.Rebind(`SELECT id, bookmark_id,
+		`+createdColumn+` created, title, excerpt, tags
+		FROM bookmark_revision
+		WHERE bookmark_id = ?
+		ORDER BY id DESC`), bookmarkID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	revisions := make([]model.BookmarkRevision, len(rows))
+	for i, row := range rows {
+		revisions[i] = row.revision()
+	}
+
+	return revisions, nil
+}
+
+// getBookmarkRevision fetch a revision with its content.
+// createdColumn is the expression that selects created time as "2006-01-02 15:04:05".
+func getBookmarkRevision(ctx context.Context, db sqlx.ExtContext, id int, createdColumn string) (model.BookmarkRevision, error) {
+	row := revisionRow{}
+	err := sqlx.GetContext(ctx, db, &row, db.Rebind(`SELECT id, bookmark_id,
+		`+createdColumn+` created, title, excerpt, tags, content, html
+		FROM bookmark_revision
+		WHERE id = ?`), id)
+	if err == sql.ErrNoRows {
+		return model.BookmarkRevision{}, errors.Wrapf(ErrNotFound, "revision %d", id)
+	}
+	if err != nil {
+		return model.BookmarkRevision{}, errors.WithStack(err)
+	}
+
+	return row.revision(), nil
+}
+
+// getBookmark fetch a single bookmark with its content.
+func getBookmark(ctx context.Context, db DB, id int) (model.Bookmark, error) {
+	bookmarks, err := db.GetBookMarks(ctx, GetBookmarksOptions{
+		IDs:         []int{id},
+		WithContent: true,
+	})
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+	if len(bookmarks) == 0 {
+		return model.Bookmark{}, errors.Wrapf(ErrNotFound, "bookmark %d", id)
+	}
+
+	return bookmarks[0], nil
+}
+
+// rollbackBookmark restores title, excerpt, tags and content of the bookmark from
+// the revision. It's saved as a normal update, so the replaced state is recorded
+// as a new revision and the rollback can be undone.
+func rollbackBookmark(ctx context.Context, db DB, revisionID int) (model.Bookmark, error) {
+	var saved []model.Bookmark
+
+	// The bookmark must not change between reading and saving it
+	err := db.WithTx(ctx, func(tx DB) error {
+		revision, err := tx.GetBookmarkRevision(ctx, revisionID)
+		if err != nil {
+			return err
+		}
+
+		book, err := getBookmark(ctx, tx, revision.BookmarkID)
+		if err != nil {
+			return err
+		}
+
+		book.Title = revision.Title
+		book.Excerpt = revision.Excerpt
+		book.Content = revision.Content
+		book.HTML = revision.HTML
+		book.Modified = ""
+
+		// Remove the tags that the revision doesn't have, then add the missing ones
+		revisionTags := map[string]bool{}
+		for _, name := range revision.Tags {
+			revisionTags[name] = true
+		}
+
+		for i, tag := range book.Tags {
+			if revisionTags[tag.Name] {
+				delete(revisionTags, tag.Name)
+			} else {
+				book.Tags[i].Deleted = true
+			}
+		}
+
+		for _, name := range revision.Tags {
+			if revisionTags[name] {
+				book.Tags = append(book.Tags, model.Tag{Name: name})
+			}
+		}
+
+		saved, err = tx.SaveBookmarks(ctx, false, book)
+		return err
+	})
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+
+	return saved[0], nil
+}
+
+// NewBookmarkRevision returns the revision that represents the current state of the bookmark.
+func NewBookmarkRevision(book model.Bookmark) model.BookmarkRevision {
+	tags := make([]string, len(book.Tags))
+	for i, tag := range book.Tags {
+		tags[i] = tag.Name
+	}
+	sort.Strings(tags)
+
+	return model.BookmarkRevision{
+		BookmarkID: book.ID,
+		Created:    book.Modified,
+		Title:      book.Title,
+		Excerpt:    book.Excerpt,
+		Tags:       tags,
+		Content:    book.Content,
+		HTML:       book.HTML,
+	}
+}
+
+// DiffBookmarkRevisions compares two revisions of the same bookmark by their ID.
+// When toID is 0, the revision is compared with the current bookmark.
+func DiffBookmarkRevisions(ctx context.Context, db DB, fromID, toID int) ([]RevisionDiff, error) {
+	from, err := db.GetBookmarkRevision(ctx, fromID)
+	if err != nil {
+		return nil, err
+	}
+
+	var to model.BookmarkRevision
+	if toID == 0 {
+		book, err := getBookmark(ctx, db, from.BookmarkID)
+		if err != nil {
+			return nil, err
+		}
+		to = NewBookmarkRevision(book)
+	} else {
+		to, err = db.GetBookmarkRevision(ctx, toID)
+		if err != nil {
+			return nil, err
+		}
+		if to.BookmarkID != from.BookmarkID {
+			return nil, errors.Errorf("revision %d and %d belong to different bookmarks", fromID, toID)
+		}
+	}
+
+	return DiffRevisions(from, to), nil
+}
+
+// RevisionDiff is the changed lines of a bookmark field between two revisions.
+type RevisionDiff struct {
+	Field string     `json:"field"`
+	Lines []DiffLine `json:"lines"`
+}
+
+// DiffLine is a line of diff. Op is "+" for added line, "-" for removed line
+// and " " for unchanged line that is shown as context.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// diffContext is the number of unchanged lines shown around the changes.
+const diffContext = 2
+
+// maxDiffCells limits the size of LCS table. Longer texts are compared
+// as a whole, i.e. all old lines removed and all new lines added.
+const maxDiffCells = 1 << 20
+
+// DiffRevisions returns the changed fields between two revisions.
+// The unchanged fields are omitted.
+func DiffRevisions(from, to model.BookmarkRevision) []RevisionDiff {
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"title", from.Title, to.Title},
+		{"excerpt", from.Excerpt, to.Excerpt},
+		{"tags", strings.Join(from.Tags, "\n"), strings.Join(to.Tags, "\n")},
+		{"content", from.Content, to.Content},
+	}
+
+	diffs := []RevisionDiff{}
+	for _, field := range fields {
+		if field.from == field.to {
+			continue
+		}
+
+		diffs = append(diffs, RevisionDiff{
+			Field: field.name,
+			Lines: diffLines(splitLines(field.from), splitLines(field.to)),
+		})
+	}
+
+	return diffs
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines returns line diff of a and b, only keeping diffContext
+// unchanged lines around every change.
+func diffLines(a, b []string) []DiffLine {
+	// Skip common prefix and suffix, so LCS only runs on the changed part
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := []DiffLine{}
+	for _, text := range a[:prefix] {
+		lines = append(lines, DiffLine{Op: " ", Text: text})
+	}
+
+	lines = append(lines, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, DiffLine{Op: " ", Text: text})
+	}
+
+	// Only keep context lines near the changes
+	keep := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Op == " " {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(lines) {
+				keep[j] = true
+			}
+		}
+	}
+
+	result := []DiffLine{}
+	for i, line := range lines {
+		if keep[i] {
+			result = append(result, line)
+		}
+	}
+
+	return result
+}
+
+// lcsDiff returns line diff of a and b using their longest common subsequence.
+func lcsDiff(a, b []string) []DiffLine {
+	lines := []DiffLine{}
+	if len(a)*len(b) > maxDiffCells {
+		for _, text := range a {
+			lines = append(lines, DiffLine{Op: "-", Text: text})
+		}
+		for _, text := range b {
+			lines = append(lines, DiffLine{Op: "+", Text: text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+)
+
+// validateSavedSearch trims the name of saved search, and checks that it has
+// a name and a valid query.
+func validateSavedSearch(search *model.SavedSearch) error {
+	search.Name = strings.TrimSpace(search.Name)
+	if search.Name == "" {
+		return errors.New("name of saved search must not be empty")
+	}
+
+	if _, err := ParseSearch(search.Query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getSavedSearches fetch the saved searches of the account, ordered by name.
+func getSavedSearches(ctx context.Context, db sqlx.ExtContext, accountID int) ([]model.SavedSearch, error) {
+	searches := []model.SavedSearch{}
+	err := sqlx.SelectContext(ctx, db, &searches, db.Rebind(`SELECT id, account_id, name, query
+		FROM saved_search
+		WHERE account_id = ?
+		ORDER BY LOWER(name), id`), accountID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	return searches, nil
+}
+
+// getSavedSearch fetch the saved search with matching ID that belongs to the account.
+func getSavedSearch(ctx context.Context, db sqlx.ExtContext, accountID, id int) (model.SavedSearch, bool, error) {
+	search := model.SavedSearch{}
+	err := sqlx.GetContext(ctx, db, &search, db.Rebind(`SELECT id, account_id, name, query
+		FROM saved_search
+		WHERE id = ? AND account_id = ?`), id, accountID)
+	if err == sql.ErrNoRows {
+		return search, false, nil
+	}
+	if err != nil {
+		return search, false, errors.WithStack(err)
+	}
+
+	return search, true, nil
+}
+
+// updateSavedSearch updates the saved search with matching ID and account.
+func updateSavedSearch(ctx context.Context, db sqlx.ExtContext, search model.SavedSearch, saveError func(err error, record string) error) error {
+	res, err := db.ExecContext(ctx, db.Rebind(`UPDATE saved_search
+		SET name = ?, query = ?
+		WHERE id = ? AND account_id = ?`),
+		search.Name, search.Query, search.ID, search.AccountID)
+	if err != nil {
+		return saveError(err, fmt.Sprintf("saved search %q", search.Name))
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// MySQL doesn't count the rows that aren't changed, so check whether it exists
+	if rows == 0 {
+		_, exist, err := getSavedSearch(ctx, db, search.AccountID, search.ID)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errors.Wrapf(ErrNotFound, "saved search %d", search.ID)
+		}
+	}
+
+	return nil
+}
+
+// deleteSavedSearches removes the saved searches of the account with matching IDs.
+func deleteSavedSearches(ctx context.Context, db sqlx.ExtContext, accountID int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(`DELETE FROM saved_search
+		WHERE account_id = ? AND id IN (?)`, accountID, ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = db.ExecContext(ctx, db.Rebind(query), args...)
+	return errors.WithStack(err)
+}
+
+// deleteAccountSavedSearches removes the saved searches of the accounts with matching usernames.
+func deleteAccountSavedSearches(ctx context.Context, db sqlx.ExtContext, usernames []string) error {
+	query, args, err := sqlx.In(`DELETE FROM saved_search
+		WHERE account_id IN (SELECT id FROM account WHERE username IN (?))`, usernames)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = db.ExecContext(ctx, db.Rebind(query), args...)
+	return errors.WithStack(err)
+}
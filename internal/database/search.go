@@ -0,0 +1,519 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	fp "path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+)
+
+// Fields of search terms. Keyword terms have no field.
+const (
+	SearchKeyword = ""
+	SearchTag     = "tag"
+	SearchSite    = "site"
+	SearchIs      = "is"
+	SearchHas     = "has"
+	SearchBefore  = "before"
+	SearchAfter   = "after"
+)
+
+// searchValues is the allowed values of the fields that have a fixed set of them.
+var searchValues = map[string][]string{
+	SearchIs:  {"public", "private"},
+	SearchHas: {"archive", "content"},
+}
+
+// SearchTerm is a single condition of a search query, e.g. -tag:go.
+type SearchTerm struct {
+	Field   string
+	Value   string
+	Negated bool
+}
+
+// SearchQuery is a parsed search query. A bookmark matches the query when it
+// matches every group, and it matches a group when it matches any of its terms.
+// The zero value matches every bookmark.
+type SearchQuery struct {
+	Groups [][]SearchTerm
+}
+
+// SyntaxError is returned by ParseSearch for malformed queries.
+type SyntaxError struct {
+	// Pos is the position of the problem in the query, counted in characters from 0.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos+1)
+}
+
+// ParseSearch parses the search query. The query is made of terms separated by spaces:
+//
+//	word or "quoted phrase"  bookmarks with the keyword in URL, title, excerpt or content
+//	tag:name                 bookmarks with the tag or one of its descendants, tag:* for any tag
+//	site:example.com         bookmarks of the host and its subdomains
+//	is:public, is:private    public or private bookmarks
+//	has:archive, has:content bookmarks with archive or readable content
+//	before:2006-01-02        bookmarks modified before the day
+//	after:2006-01-02         bookmarks modified after the day
+//
+// Every term must match, unless terms are joined with OR. A term is negated
+// by a leading -, e.g. -tag:old. Values with spaces can be quoted, e.g. tag:"web dev".
+func ParseSearch(query string) (SearchQuery, error) {
+	p := searchParser{query: []rune(query)}
+	return p.parse()
+}
+
+// Keywords returns the keywords that bookmarks must or may have, excluding the negated ones.
+func (q SearchQuery) Keywords() []string {
+	keywords := []string{}
+	for _, group := range q.Groups {
+		for _, term := range group {
+			if term.Field == SearchKeyword && !term.Negated {
+				keywords = append(keywords, term.Value)
+			}
+		}
+	}
+
+	return keywords
+}
+
+// NeedsArchives reports whether the query has has:archive, which needs
+// GetBookmarksOptions.ArchiveIDs to be set.
+func (q SearchQuery) NeedsArchives() bool {
+	for _, group := range q.Groups {
+		for _, term := range group {
+			if term.Field == SearchHas && term.Value == "archive" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ArchiveIDs returns the IDs of bookmarks that have an archive in the data dir.
+// Archives are files, so the database can't tell which bookmarks have one.
+func ArchiveIDs(dataDir string) ([]int, error) {
+	entries, err := os.ReadDir(fp.Join(dataDir, "archive"))
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, entry := range entries {
+		if id, err := strconv.Atoi(entry.Name()); err == nil && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+// searchParser parses a search query one term at a time.
+type searchParser struct {
+	query []rune
+	pos   int
+}
+
+func (p *searchParser) parse() (SearchQuery, error) {
+	q := SearchQuery{Groups: [][]SearchTerm{}}
+
+	// OR joins the next term to the group of the previous one
+	orPos := -1
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			break
+		}
+
+		if p.atOr() {
+			if len(q.Groups) == 0 || orPos >= 0 {
+				return q, &SyntaxError{Pos: p.pos, Msg: "OR must be between two terms"}
+			}
+			orPos = p.pos
+			p.pos += 2
+			continue
+		}
+
+		term, err := p.term()
+		if err != nil {
+			return q, err
+		}
+
+		if orPos >= 0 {
+			last := len(q.Groups) - 1
+			q.Groups[last] = append(q.Groups[last], term)
+			orPos = -1
+		} else {
+			q.Groups = append(q.Groups, []SearchTerm{term})
+		}
+	}
+
+	if orPos >= 0 {
+		return q, &SyntaxError{Pos: orPos, Msg: "OR must be between two terms"}
+	}
+
+	return q, nil
+}
+
+// term parses a term starting at the current position.
+func (p *searchParser) term() (SearchTerm, error) {
+	term := SearchTerm{}
+	start := p.pos
+
+	if p.peek() == '-' {
+		term.Negated = true
+		p.pos++
+		if p.eof() || unicode.IsSpace(p.peek()) {
+			return term, &SyntaxError{Pos: start, Msg: "- must be followed by a term"}
+		}
+	}
+
+	// The field is the letters before colon, as long as it's not an URL
+	fieldStart := p.pos
+	end := p.pos
+	for end < len(p.query) && unicode.IsLetter(p.query[end]) {
+		end++
+	}
+
+	if end > fieldStart && end < len(p.query) && p.query[end] == ':' &&
+		!strings.HasPrefix(string(p.query[end+1:]), "//") {
+		field := strings.ToLower(string(p.query[fieldStart:end]))
+		switch field {
+		case SearchTag, SearchSite, SearchIs, SearchHas, SearchBefore, SearchAfter:
+		default:
+			return term, &SyntaxError{
+				Pos: fieldStart,
+				Msg: fmt.Sprintf("unknown search field %q, use quotes to search for the text", field),
+			}
+		}
+
+		term.Field = field
+		p.pos = end + 1
+	}
+
+	valueStart := p.pos
+	value, err := p.value()
+	if err != nil {
+		return term, err
+	}
+
+	if value == "" {
+		return term, &SyntaxError{Pos: valueStart, Msg: fmt.Sprintf("%s: needs a value", term.Field)}
+	}
+
+	term.Value, err = searchValue(term.Field, value)
+	if err != nil {
+		return term, &SyntaxError{Pos: valueStart, Msg: err.Error()}
+	}
+
+	// is:private is the same as -is:public
+	if term.Field == SearchIs && term.Value == "private" {
+		term.Value = "public"
+		term.Negated = !term.Negated
+	}
+
+	return term, nil
+}
+
+// value parses a word, or a phrase in quotes.
+func (p *searchParser) value() (string, error) {
+	start := p.pos
+	if !p.eof() && p.peek() == '"' {
+		end := start + 1
+		for end < len(p.query) && p.query[end] != '"' {
+			end++
+		}
+		if end == len(p.query) {
+			return "", &SyntaxError{Pos: start, Msg: "missing closing quote"}
+		}
+
+		p.pos = end + 1
+		if !p.eof() && !unicode.IsSpace(p.peek()) {
+			return "", &SyntaxError{Pos: p.pos, Msg: "missing space after closing quote"}
+		}
+
+		return strings.TrimSpace(string(p.query[start+1 : end])), nil
+	}
+
+	for !p.eof() && !unicode.IsSpace(p.peek()) {
+		if p.peek() == '"' {
+			return "", &SyntaxError{Pos: p.pos, Msg: "quotes must enclose the whole term"}
+		}
+		p.pos++
+	}
+
+	return string(p.query[start:p.pos]), nil
+}
+
+// atOr checks whether the current word is OR.
+func (p *searchParser) atOr() bool {
+	end := p.pos + 2
+	return end <= len(p.query) && string(p.query[p.pos:end]) == "OR" &&
+		(end == len(p.query) || unicode.IsSpace(p.query[end]))
+}
+
+func (p *searchParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *searchParser) eof() bool {
+	return p.pos >= len(p.query)
+}
+
+func (p *searchParser) peek() rune {
+	return p.query[p.pos]
+}
+
+// searchValue validates the value of a term and returns it in the form used for searching.
+func searchValue(field, value string) (string, error) {
+	switch field {
+	case SearchTag:
+		if value == "*" {
+			return value, nil
+		}
+		if name := normalizeTagName(value); name != "" {
+			return name, nil
+		}
+		return "", fmt.Errorf("%q is not a valid tag", value)
+
+	case SearchSite:
+		host := strings.ToLower(value)
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		if i := strings.IndexAny(host, "/?#"); i >= 0 {
+			host = host[:i]
+		}
+		host = strings.Trim(host, ".")
+		if host == "" {
+			return "", fmt.Errorf("%q is not a valid site", value)
+		}
+		return host, nil
+
+	case SearchIs, SearchHas:
+		value = strings.ToLower(value)
+		for _, allowed := range searchValues[field] {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("%s:%s is not supported, use one of %s",
+			field, value, strings.Join(searchValues[field], ", "))
+
+	case SearchBefore, SearchAfter:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return "", fmt.Errorf("%q is not a valid date, use YYYY-MM-DD", value)
+		}
+		return value, nil
+	}
+
+	return value, nil
+}
+
+// searchDate returns the modified time that before: and after: compare with.
+// after: starts at the next day, so the day itself is excluded.
+func searchDate(term SearchTerm) string {
+	date, _ := time.Parse("2006-01-02", term.Value)
+	if term.Field == SearchAfter {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date.Format("2006-01-02")
+}
+
+// searchDialect is the SQL of a database engine that search terms depend on.
+type searchDialect struct {
+	// keyword returns the condition for bookmarks that have the keyword,
+	// annotations is whether their notes and highlights are searched as well.
+	keyword func(keyword string, annotations bool) (string, []interface{})
+	// hasContent is the condition for bookmarks that have readable content.
+	hasContent string
+	// host is the expression of the host in bookmark URL.
+	host string
+}
+
+// searchClause returns where clause for bookmarks that match the search query.
+// annotations is whether the keywords are searched in notes and highlights as well.
+func searchClause(q SearchQuery, archiveIDs []int, annotations bool, dialect searchDialect) (string, []interface{}) {
+	query := ""
+	args := []interface{}{}
+
+	for _, group := range q.Groups {
+		conditions := make([]string, len(group))
+		for i, term := range group {
+			condition, termArgs := searchTermClause(term, archiveIDs, annotations, dialect)
+			if term.Negated {
+				condition = `NOT ` + condition
+			}
+
+			conditions[i] = condition
+			args = append(args, termArgs...)
+		}
+
+		query += ` AND (` + strings.Join(conditions, ` OR `) + `)`
+	}
+
+	return query, args
+}
+
+// searchTermClause returns the condition for bookmarks that match the term, in parentheses.
+func searchTermClause(term SearchTerm, archiveIDs []int, annotations bool, dialect searchDialect) (string, []interface{}) {
+	switch term.Field {
+	case SearchTag:
+		if term.Value == "*" {
+			return `(b.id IN (SELECT bookmark_id FROM bookmark_tag))`, nil
+		}
+
+		return `(b.id IN (
+			SELECT bt.bookmark_id
+			FROM bookmark_tag bt
+			LEFT JOIN tag t ON bt.tag_id = t.id
+			WHERE t.name = ? OR t.name LIKE ? ESCAPE '!'))`,
+			[]interface{}{term.Value, tagDescendantsPattern(term.Value)}
+
+	case SearchSite:
+		return `(LOWER(` + dialect.host + `) = ? OR LOWER(` + dialect.host + `) LIKE ? ESCAPE '!')`,
+			[]interface{}{term.Value, "%." + likeEscaper.Replace(term.Value)}
+
+	case SearchIs:
+		return `(b.public = 1)`, nil
+
+	case SearchHas:
+		if term.Value == "content" {
+			return `(` + dialect.hasContent + `)`, nil
+		}
+		if len(archiveIDs) == 0 {
+			return `(1 = 0)`, nil
+		}
+		return `(b.id IN (?))`, []interface{}{archiveIDs}
+
+	case SearchBefore:
+		return `(b.modified < ?)`, []interface{}{searchDate(term)}
+
+	case SearchAfter:
+		return `(b.modified >= ?)`, []interface{}{searchDate(term)}
+	}
+
+	query, args := dialect.keyword(term.Value, annotations)
+	return `(` + query + `)`, args
+}
+
+// memoryMatchSearch checks whether the bookmark matches the search query.
+// annotations is the text of its notes and highlights, tagNames is the names of its tags,
+// and archives is the set of bookmarks with archive.
+func memoryMatchSearch(q SearchQuery, book model.Bookmark, annotations string, tagNames []string, archives map[int]bool) bool {
+	for _, group := range q.Groups {
+		matched := false
+		for _, term := range group {
+			if memoryMatchTerm(term, book, annotations, tagNames, archives) != term.Negated {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func memoryMatchTerm(term SearchTerm, book model.Bookmark, annotations string, tagNames []string, archives map[int]bool) bool {
+	switch term.Field {
+	case SearchTag:
+		if term.Value == "*" {
+			return len(tagNames) > 0
+		}
+		return memoryHasAnyTag(tagNames, []string{term.Value})
+
+	case SearchSite:
+		u, err := url.Parse(book.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		return host == term.Value || strings.HasSuffix(host, "."+term.Value)
+
+	case SearchIs:
+		return book.Public == 1
+
+	case SearchHas:
+		if term.Value == "content" {
+			return book.Content != ""
+		}
+		return archives[book.ID]
+
+	case SearchBefore:
+		return book.Modified < searchDate(term)
+
+	case SearchAfter:
+		return book.Modified >= searchDate(term)
+	}
+
+	keyword := strings.ToLower(term.Value)
+	for _, text := range []string{book.URL, book.Title, book.Excerpt} {
+		if strings.Contains(strings.ToLower(text), keyword) {
+			return true
+		}
+	}
+
+	// Content and annotations are matched by words, the same as the full text index
+	for _, text := range []string{book.Content, annotations} {
+		if memoryMatchWords(text, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// memoryWords splits the text into lower cased words of letters and digits,
+// like the unicode61 tokenizer of SQLite full text search.
+func memoryWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// memoryMatchWords checks whether the words of phrase appear one after another in the text.
+func memoryMatchWords(text, phrase string) bool {
+	words := memoryWords(phrase)
+	if len(words) == 0 {
+		return false
+	}
+
+	textWords := memoryWords(text)
+	for i := 0; i+len(words) <= len(textWords); i++ {
+		matched := true
+		for j, word := range words {
+			if textWords[i+j] != word {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := map[string][][]SearchTerm{
+		"":        {},
+		"  go  ":  {{{Value: "go"}}},
+		"go rust": {{{Value: "go"}}, {{Value: "rust"}}},
+		"go OR rust": {
+			{{Value: "go"}, {Value: "rust"}},
+		},
+		"a b OR c OR d e": {
+			{{Value: "a"}},
+			{{Value: "b"}, {Value: "c"}, {Value: "d"}},
+			{{Value: "e"}},
+		},
+		"go or rust": {{{Value: "go"}}, {{Value: "or"}}, {{Value: "rust"}}},
+		`"hello  world" -"old news"`: {
+			{{Value: "hello  world"}},
+			{{Value: "old news", Negated: true}},
+		},
+		"tag:Web/Go -tag:old tag:*": {
+			{{Field: SearchTag, Value: "web/go"}},
+			{{Field: SearchTag, Value: "old", Negated: true}},
+			{{Field: SearchTag, Value: "*"}},
+		},
+		`TAG:"web dev"`: {{{Field: SearchTag, Value: "web dev"}}},
+		"site:https://WWW.Example.com/path site:go.dev": {
+			{{Field: SearchSite, Value: "www.example.com"}},
+			{{Field: SearchSite, Value: "go.dev"}},
+		},
+		"is:public -is:private is:Private": {
+			{{Field: SearchIs, Value: "public"}},
+			{{Field: SearchIs, Value: "public"}},
+			{{Field: SearchIs, Value: "public", Negated: true}},
+		},
+		"has:archive OR has:content": {
+			{{Field: SearchHas, Value: "archive"}, {Field: SearchHas, Value: "content"}},
+		},
+		"after:2020-01-02 before:2021-12-31": {
+			{{Field: SearchAfter, Value: "2020-01-02"}},
+			{{Field: SearchBefore, Value: "2021-12-31"}},
+		},
+		"https://go.dev a-b 10:30": {
+			{{Value: "https://go.dev"}},
+			{{Value: "a-b"}},
+			{{Value: "10:30"}},
+		},
+		"ORACLE": {{{Value: "ORACLE"}}},
+	}
+
+	for query, expected := range tests {
+		search, err := ParseSearch(query)
+		if err != nil {
+			t.Errorf("%q: %v", query, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(search.Groups, expected) {
+			t.Errorf("%q: expected %v, got %v", query, expected, search.Groups)
+		}
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	tests := map[string]int{
+		"OR go":             0,
+		"go OR":             3,
+		"go OR OR rust":     6,
+		"go -":              3,
+		`go "rust`:          3,
+		`"go"rust`:          4,
+		`go"rust"`:          2,
+		"foo:bar":           0,
+		"-foo:bar":          1,
+		"tag:":              4,
+		`tag:""`:            4,
+		"tag:/":             4,
+		"is:secret":         3,
+		"has:thumb":         4,
+		"before:2020-13-01": 7,
+		"after:yesterday":   6,
+		"日本 tag:":           7,
+	}
+
+	for query, pos := range tests {
+		_, err := ParseSearch(query)
+
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: expected syntax error, got %v", query, err)
+			continue
+		}
+
+		if syntaxErr.Pos != pos {
+			t.Errorf("%q: expected error at %d, got %d: %v", query, pos, syntaxErr.Pos, err)
+		}
+	}
+}
+
+func TestSearchKeywords(t *testing.T) {
+	search, err := ParseSearch(`go -rust "web dev" OR tag:web`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keywords := search.Keywords(); !reflect.DeepEqual(keywords, []string{"go", "web dev"}) {
+		t.Errorf("unexpected keywords %v", keywords)
+	}
+
+	if search.NeedsArchives() {
+		t.Error("search doesn't need archives")
+	}
+
+	search, _ = ParseSearch("-has:archive")
+	if !search.NeedsArchives() {
+		t.Error("search needs archives")
+	}
+}
+
+func TestArchiveIDs(t *testing.T) {
+	dataDir := t.TempDir()
+
+	ids, err := ArchiveIDs(dataDir)
+	if err != nil || len(ids) != 0 {
+		t.Errorf("unexpected archives without archive dir %v %v", ids, err)
+	}
+
+	for _, name := range []string{"12", "3", "tmp"} {
+		if err := os.MkdirAll(fp.Join(dataDir, "archive"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp.Join(dataDir, "archive", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err = ArchiveIDs(dataDir)
+	if err != nil || !reflect.DeepEqual(ids, []int{3, 12}) {
+		t.Errorf("unexpected archives %v %v", ids, err)
+	}
+}
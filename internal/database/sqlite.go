@@ -3,12 +3,14 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite"
-	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jmoiron/sqlx"
 	"github.com/new-aspect/shiori-practice/internal/model"
 	"github.com/pkg/errors"
+	"strings"
+	"time"
 )
 
 type SQLiteDatabase struct {
@@ -23,55 +25,745 @@ func OpenSQLiteDatabase(ctx context.Context, databasePath string) (sqliteDB *SQL
 		return nil, err
 	}
 	sqliteDB = &SQLiteDatabase{
-		dbbase: dbbase{*db},
+		dbbase: dbbase{DB: *db, revisionLimit: DefaultRevisionLimit},
 	}
 	return sqliteDB, nil
 }
 
+// migration returns the migration of SQLite schema.
+func (db *SQLiteDatabase) migration() (*migrate.Migrate, error) {
+	dbDrive, err := sqlite.WithInstance(db.DB.DB, &sqlite.Config{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return newMigration("migrations/sqlite", "sqlite", dbDrive)
+}
+
 // Migrate runs migrations for this database engine
 func (db *SQLiteDatabase) Migrate() error {
-	sourceDrive, err := iofs.New(migrations, "migrations/sqlite")
+	migration, err := db.migration()
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 
-	dbDrive, err := sqlite.WithInstance(db.DB.DB, &sqlite.Config{})
+	fromVersion, err := migrationVersion(migration)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
+	}
+
+	if err := migrateUp(migration); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// fixMigratedData fixes the data after migrating from fromVersion, see migrationFixes.
+func (db *SQLiteDatabase) fixMigratedData(migration *migrate.Migrate, fromVersion uint) error {
+	return fixMigratedData(&db.dbbase, migration, fromVersion, migrationFixes(insertTag, sqliteMergeTagQuery))
+}
+
+// prepareRevert prepares the data for migrating down to toVersion, see migrationReverts.
+func (db *SQLiteDatabase) prepareRevert(migration *migrate.Migrate, toVersion uint) error {
+	return prepareRevert(&db.dbbase, migration, toVersion, migrationReverts(sqliteMergeTagQuery))
+}
+
+// MigrateSteps applies the next n migrations, or reverts the last -n migrations.
+func (db *SQLiteDatabase) MigrateSteps(n int) error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
 	}
 
-	migration, err := migrate.NewWithInstance(
-		"iofs",
-		sourceDrive,
-		"sqlite",
-		dbDrive,
-	)
+	fromVersion, err := migrationVersion(migration)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	if err := migration.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return errors.WithStack(err)
+
+	if err := db.prepareRevert(migration, stepsVersion(fromVersion, n)); err != nil {
+		return err
+	}
+
+	if err := migrateSteps(migration, n); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// MigrateTo migrates the schema up or down to the version.
+func (db *SQLiteDatabase) MigrateTo(version uint) error {
+	migration, err := db.migration()
+	if err != nil {
+		return err
+	}
+
+	fromVersion, err := migrationVersion(migration)
+	if err != nil {
+		return err
+	}
+
+	if err := db.prepareRevert(migration, version); err != nil {
+		return err
+	}
+
+	if err := migrateTo(migration, version); err != nil {
+		return err
+	}
+
+	return db.fixMigratedData(migration, fromVersion)
+}
+
+// MigrationStatus reports the schema version and the available migrations.
+func (db *SQLiteDatabase) MigrationStatus() (MigrationStatus, error) {
+	migration, err := db.migration()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	return migrationStatus(migration, "migrations/sqlite")
+}
+
+// Snapshot writes a consistent copy of the database to path using VACUUM INTO.
+// It's safe while the database is in use, e.g. by a running server.
+// The file in path must not exist yet.
+func (db *SQLiteDatabase) Snapshot(ctx context.Context, path string) error {
+	_, err := db.ExecContext(ctx, `VACUUM INTO ?`, path)
+	return errors.WithStack(err)
+}
+
+// SaveBookmarks saves new or updated bookmarks to database.
+// When create is true the bookmarks are inserted, otherwise they are updated by ID.
+// Returns the saved bookmarks with their IDs filled in.
+func (db *SQLiteDatabase) SaveBookmarks(ctx context.Context, create bool, bookmarks ...model.Bookmark) ([]model.Bookmark, error) {
+	result := []model.Bookmark{}
+
+	err := db.withTx(ctx, func(tx *sqlx.Tx) error {
+		// Prepare statement
+		// A new ID is generated unless the bookmark already has one
+		stmtInsertBook, err := tx.PreparexContext(ctx, `INSERT INTO bookmark
+			(id, account_id, url, title, excerpt, author, public, modified, deleted_at, canonical_url, notes,
+			reading_status, reading_progress)
+			VALUES(NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBook.Close()
+
+		stmtUpdateBook, err := tx.PreparexContext(ctx, `UPDATE bookmark SET
+			url = ?, title = ?, excerpt = ?, author = ?,
+			public = ?, modified = ?, canonical_url = ?, notes = ?,
+			reading_status = ?, reading_progress = ?
+			WHERE id = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtUpdateBook.Close()
+
+		stmtInsertBookContent, err := tx.PreparexContext(ctx, `INSERT INTO bookmark_content
+			(docid, title, content, html)
+			VALUES(?, ?, ?, ?)`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBookContent.Close()
+
+		// bookmark_content is a virtual table, so it can't be upserted.
+		// Try to update it first and insert when nothing changed.
+		stmtUpdateBookContent, err := tx.PreparexContext(ctx, `UPDATE bookmark_content SET
+			title = ?, content = ?, html = ?
+			WHERE docid = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtUpdateBookContent.Close()
+
+		stmtGetTag, err := tx.PreparexContext(ctx, `SELECT id FROM tag WHERE account_id = ? AND name = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtGetTag.Close()
+
+		stmtInsertBookTag, err := tx.PreparexContext(ctx, `INSERT OR IGNORE INTO bookmark_tag
+			(tag_id, bookmark_id) VALUES (?, ?)`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtInsertBookTag.Close()
+
+		stmtDeleteBookTag, err := tx.PreparexContext(ctx, `DELETE FROM bookmark_tag
+			WHERE bookmark_id = ? AND tag_id = ?`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer stmtDeleteBookTag.Close()
+
+		// Prepare modified time
+		modifiedTime := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+		// Execute statements
+		for _, book := range bookmarks {
+			// Check URL and title
+			if book.URL == "" {
+				return errors.New("URL must not be empty")
+			}
+
+			if book.Title == "" {
+				return errors.New("title must not be empty")
+			}
+
+			// Set modified time
+			if book.Modified == "" {
+				book.Modified = modifiedTime
+			}
+
+			// Check reading state, new bookmark is unread
+			book.ReadingStatus, err = validateReadingState(book.ReadingStatus, book.ReadingProgress)
+			if err != nil {
+				return err
+			}
+
+			// The account of bookmark isn't changed by update
+			if !create {
+				book.AccountID, err = bookmarkAccountID(ctx, tx, book.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			// The same page must not be saved twice by the account
+			canonicalURL := CanonicalURL(book.URL)
+			if err := checkCanonicalURL(ctx, tx, book, canonicalURL); err != nil {
+				return err
+			}
+
+			// Create or update bookmark
+			if create {
+				res, err := stmtInsertBook.ExecContext(ctx, book.ID, book.AccountID,
+					book.URL, book.Title, book.Excerpt, book.Author,
+					book.Public, book.Modified, book.DeletedAt, canonicalURL, book.Notes,
+					book.ReadingStatus, book.ReadingProgress)
+				if err != nil {
+					return sqliteSaveError(err, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				bookID, err := res.LastInsertId()
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				book.ID = int(bookID)
+			} else {
+				// Keep the current state as revision before updating it
+				err = saveBookmarkRevision(ctx, tx, book.ID, db.revisionLimit, `SELECT b.title, b.excerpt,
+					COALESCE(bc.content, '') content, COALESCE(bc.html, '') html
+					FROM bookmark b
+					LEFT JOIN bookmark_content bc ON bc.docid = b.id
+					WHERE b.id = ?`)
+				if err != nil {
+					return err
+				}
+
+				res, err := stmtUpdateBook.ExecContext(ctx,
+					book.URL, book.Title, book.Excerpt, book.Author,
+					book.Public, book.Modified, canonicalURL, book.Notes,
+					book.ReadingStatus, book.ReadingProgress, book.ID)
+				if err != nil {
+					return sqliteSaveError(err, fmt.Sprintf("bookmark with url %q", book.URL))
+				}
+
+				rows, err := res.RowsAffected()
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				if rows == 0 {
+					return errors.Wrapf(ErrNotFound, "bookmark %d", book.ID)
+				}
+			}
+
+			// Save bookmark content
+			res, err := stmtUpdateBookContent.ExecContext(ctx,
+				book.Title, book.Content, book.HTML, book.ID)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if rows == 0 {
+				_, err = stmtInsertBookContent.ExecContext(ctx,
+					book.ID, book.Title, book.Content, book.HTML)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			book.HasContent = book.Content != ""
+
+			// Index the notes together with the highlights
+			if err := saveAnnotations(ctx, tx, book.ID, sqliteAnnotationsQuery); err != nil {
+				return err
+			}
+
+			// Save bookmark tags
+			newTags := []model.Tag{}
+			for _, tag := range book.Tags {
+				// Normalize tag name
+				tag.Name = normalizeTagName(tag.Name)
+
+				// Tag is found by its name within the account of bookmark, its ID is
+				// only used without name and must belong to the account as well
+				if tag.Name != "" {
+					tag.ID = 0
+					err = stmtGetTag.GetContext(ctx, &tag.ID, book.AccountID, tag.Name)
+					if err != nil && err != sql.ErrNoRows {
+						return errors.WithStack(err)
+					}
+				} else if tag.ID != 0 {
+					if err := checkTagAccount(ctx, tx, tag.ID, book.AccountID); err != nil {
+						return err
+					}
+				}
+
+				// If it's deleted tag, delete and continue
+				if tag.Deleted {
+					if tag.ID != 0 {
+						_, err = stmtDeleteBookTag.ExecContext(ctx, book.ID, tag.ID)
+						if err != nil {
+							return errors.WithStack(err)
+						}
+					}
+					continue
+				}
+
+				// If tag doesn't exist in database, save it
+				if tag.ID == 0 {
+					if tag.Name == "" {
+						continue
+					}
+
+					// Create it with its missing parents
+					tag.ID, err = saveTag(ctx, tx, book.AccountID, tag.Name, insertTag)
+					if err != nil {
+						return err
+					}
+				}
+
+				_, err = stmtInsertBookTag.ExecContext(ctx, tag.ID, book.ID)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+
+				newTags = append(newTags, tag)
+			}
+
+			book.Tags = newTags
+			result = append(result, book)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// sqliteAnnotationsQuery updates the searched text of notes and highlights of bookmark,
+// it's stored in the full text index.
+const sqliteAnnotationsQuery = `UPDATE bookmark_content SET annotations = ? WHERE docid = ?`
+
+// sqliteMatchQuery quotes each keyword as a FTS5 phrase restricted to title,
+// content and, with annotations, the annotations, so the characters in it aren't
+// parsed as FTS5 syntax. Several keywords are joined with OR.
+func sqliteMatchQuery(annotations bool, keywords ...string) string {
+	phrases := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		phrases[i] = `"` + strings.ReplaceAll(keyword, `"`, `""`) + `"`
+	}
+
+	columns := `{title content}`
+	if annotations {
+		columns = `{title content annotations}`
+	}
+
+	if len(phrases) == 1 {
+		return columns + ` : ` + phrases[0]
+	}
+
+	return columns + ` : (` + strings.Join(phrases, " OR ") + `)`
+}
+
+// sqliteKeywordClause returns the condition for bookmarks that have the keyword
+// in their URL, title, excerpt, content or, with annotations, notes or highlights.
+func sqliteKeywordClause(keyword string, annotations bool) (string, []interface{}) {
+	query := `b.url LIKE ? OR b.title LIKE ? OR b.excerpt LIKE ? OR b.id IN (
+		SELECT docid id
+		FROM bookmark_content
+		WHERE bookmark_content MATCH ?)`
+
+	return query, []interface{}{
+		"%" + keyword + "%",
+		"%" + keyword + "%",
+		"%" + keyword + "%",
+		sqliteMatchQuery(annotations, keyword)}
+}
+
+// sqliteURLRest is the URL after its scheme, where the characters that may end
+// the host are replaced with slash, so the host ends at the first slash.
+const sqliteURLRest = `(REPLACE(REPLACE(REPLACE(SUBSTR(b.url, INSTR(b.url, '://') + 3),
+	'?', '/'), '#', '/'), ':', '/') || '/')`
+
+// sqliteSearchDialect is the SQL of SQLite for search queries.
+var sqliteSearchDialect = searchDialect{
+	keyword:    sqliteKeywordClause,
+	hasContent: `b.id IN (SELECT docid FROM bookmark_content WHERE content <> '')`,
+	host:       `SUBSTR(` + sqliteURLRest + `, 1, INSTR(` + sqliteURLRest + `, '/') - 1)`,
+}
+
+// sqliteSaveError converts the error of saving a record, so the violation
+// of an unique constraint is reported as ErrAlreadyExists for the record.
+func sqliteSaveError(err error, record string) error {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return errors.Wrap(ErrAlreadyExists, record)
+	}
+
+	return errors.WithStack(err)
+}
+
+// sqliteURLWithoutScheme is the URL after its scheme, see urlWithoutScheme.
+const sqliteURLWithoutScheme = `SUBSTR(b.url,
+	CASE WHEN INSTR(b.url, '://') > 0 THEN INSTR(b.url, '://') + 3 ELSE 1 END)`
+
+// sqliteOrders is the sort order of bookmarks for each OrderMethod.
+var sqliteOrders = map[OrderMethod]orderSpec{
+	DefaultOrder:   {},
+	ByLastAdded:    {desc: true},
+	ByLastModified: {key: "b.modified", desc: true},
+	ByTitle:        {key: "b.title COLLATE NOCASE"},
+	ByURL:          {key: sqliteURLWithoutScheme + " COLLATE NOCASE"},
+	ByUnread:       {key: readingStatusRank},
+}
+
+// GetBookMarks fetch list of bookmarks based on submitted options.
+func (db *SQLiteDatabase) GetBookMarks(ctx context.Context, opts GetBookmarksOptions) ([]model.Bookmark, error) {
+	order, cursor, err := orderAndCursor(sqliteOrders, &opts)
+	if err != nil {
+		return nil, err
+	}
+	keywords := opts.keywords()
+	orderByRelevance := opts.OrderMethod == ByRelevance && len(keywords) > 0
+
+	// Create initial query
+	columns := []string{
+		`b.id`,
+		`b.account_id`,
+		`b.url`,
+		`b.title`,
+		`b.excerpt`,
+		`b.author`,
+		`b.public`,
+		`b.modified`,
+		`b.notes`,
+		`b.reading_status`,
+		`b.reading_progress`,
+		`b.id IN (SELECT docid FROM bookmark_content WHERE content <> '') has_content`,
+		`COALESCE(b.deleted_at, '') deleted_at`}
+
+	query := `SELECT ` + strings.Join(columns, ",") + `
+		FROM bookmark b`
+
+	args := []interface{}{}
+
+	// To order by relevance, join the rank of the matching content.
+	// bm25 gives better matches a lower score.
+	if orderByRelevance {
+		query += ` LEFT JOIN (
+			SELECT docid, bm25(bookmark_content) rank
+			FROM bookmark_content
+			WHERE bookmark_content MATCH ?) bc ON bc.docid = b.id`
+		args = append(args, sqliteMatchQuery(!opts.WithoutAnnotations, keywords...))
+	}
+
+	// Add where clause
+	query += ` WHERE 1`
+
+	// Add where clause for the filters of options
+	filterQuery, filterArgs := bookmarksFilterClause(opts, sqliteSearchDialect)
+	query += filterQuery
+	args = append(args, filterArgs...)
+
+	// Add where clause for cursor
+	if cursor != nil {
+		cursorQuery, cursorArgs := order.where(*cursor)
+		query += cursorQuery
+		args = append(args, cursorArgs...)
+	}
+
+	// Add order clause
+	if orderByRelevance {
+		query += ` ORDER BY bc.rank IS NULL, bc.rank, b.id DESC`
+	} else {
+		query += order.orderBy(cursor != nil && cursor.Backward)
+	}
+
+	if opts.Limit > 0 && cursor != nil {
+		query += ` LIMIT ?`
+		args = append(args, opts.Limit)
+	} else if opts.Limit > 0 && opts.Offset >= 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, opts.Limit, opts.Offset)
+	}
+
+	// Expand query, because some of the args might be an array
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Fetch bookmarks
+	bookmarks := []model.Bookmark{}
+	err = db.SelectContext(ctx, &bookmarks, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(bookmarks) == 0 {
+		return bookmarks, nil
+	}
+
+	if cursor != nil && cursor.Backward {
+		reverseBookmarks(bookmarks)
+	}
+
+	// Store bookmark index by its ID for further enrichment
+	bookmarkIDs := make([]int, 0, len(bookmarks))
+	bookmarkMap := make(map[int]int, len(bookmarks))
+	for i := range bookmarks {
+		bookmarks[i].Tags = []model.Tag{}
+		bookmarkIDs = append(bookmarkIDs, bookmarks[i].ID)
+		bookmarkMap[bookmarks[i].ID] = i
+	}
+
+	// If content needed, fetch it separately.
+	// It's faster than join with the virtual content table.
+	if opts.WithContent {
+		contentQuery, contentArgs, err := sqlx.In(`SELECT docid id, content, html
+			FROM bookmark_content
+			WHERE docid IN (?)`, bookmarkIDs)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		contents := []model.Bookmark{}
+		err = db.SelectContext(ctx, &contents, contentQuery, contentArgs...)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, content := range contents {
+			if i, ok := bookmarkMap[content.ID]; ok {
+				bookmarks[i].Content = content.Content
+				bookmarks[i].HTML = content.HTML
+			}
+		}
+	}
+
+	// Fetch tags for each bookmarks
+	tagsQuery, tagsArgs, err := sqlx.In(`SELECT bt.bookmark_id, t.id, t.name
+		FROM bookmark_tag bt
+		LEFT JOIN tag t ON bt.tag_id = t.id
+		WHERE bt.bookmark_id IN (?)
+		ORDER BY t.name`, bookmarkIDs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bookmarkTags := []struct {
+		BookmarkID int `db:"bookmark_id"`
+		model.Tag
+	}{}
+	err = db.SelectContext(ctx, &bookmarkTags, tagsQuery, tagsArgs...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, bt := range bookmarkTags {
+		if i, ok := bookmarkMap[bt.BookmarkID]; ok {
+			bookmarks[i].Tags = append(bookmarks[i].Tags, bt.Tag)
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// GetBookmarksCount returns the number of bookmarks that match opts.
+func (db *SQLiteDatabase) GetBookmarksCount(ctx context.Context, opts GetBookmarksOptions) (int, error) {
+	filterQuery, filterArgs := bookmarksFilterClause(opts, sqliteSearchDialect)
+
+	// Expand query, because some of the args might be an array
+	query, args, err := sqlx.In(`SELECT COUNT(b.id) FROM bookmark b WHERE 1`+filterQuery, filterArgs...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	count := 0
+	err = db.GetContext(ctx, &count, db.Rebind(query), args...)
+	return count, errors.WithStack(err)
+}
+
+// GetDuplicateIDs returns the IDs of bookmarks of the same page, see DB.
+func (db *SQLiteDatabase) GetDuplicateIDs(ctx context.Context) ([][]int, error) {
+	return getDuplicateIDs(ctx, db)
+}
+
+// DeleteBookmarks removes all record with matching ids from database.
+// Without ids all bookmarks are removed.
+func (db *SQLiteDatabase) DeleteBookmarks(ctx context.Context, ids ...int) error {
+	err := db.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ids, err = deleteBookmarks(ctx, tx, ids, `DELETE FROM bookmark_content WHERE docid IN (?)`)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// TrashBookmarks moves bookmarks with matching ids to trash.
+// Without ids all bookmarks are moved.
+func (db *SQLiteDatabase) TrashBookmarks(ctx context.Context, ids ...int) error {
+	deletedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	return setBookmarksDeletedAt(ctx, db, ids, deletedAt)
+}
+
+// RestoreBookmarks restores bookmarks with matching ids from trash.
+// Without ids all bookmarks in trash are restored.
+func (db *SQLiteDatabase) RestoreBookmarks(ctx context.Context, ids ...int) error {
+	return setBookmarksDeletedAt(ctx, db, ids, nil)
+}
+
+// PurgeBookmarks permanently removes the bookmarks that were moved to trash
+// before olderThan. Returns the ids of removed bookmarks.
+func (db *SQLiteDatabase) PurgeBookmarks(ctx context.Context, olderThan time.Time) (ids []int, err error) {
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		ids, err = purgeBookmarks(ctx, tx, olderThan, `DELETE FROM bookmark_content WHERE docid IN (?)`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, db.deleteBookmarkFiles(ids)
+}
+
+// GetBookmarkRevisions fetch the revisions of a bookmark, newest first.
+func (db *SQLiteDatabase) GetBookmarkRevisions(ctx context.Context, bookmarkID int) ([]model.BookmarkRevision, error) {
+	return getBookmarkRevisions(ctx, db, bookmarkID, `created`)
+}
+
+// GetBookmarkRevision fetch a revision including its content.
+func (db *SQLiteDatabase) GetBookmarkRevision(ctx context.Context, id int) (model.BookmarkRevision, error) {
+	return getBookmarkRevision(ctx, db, id, `created`)
+}
+
+// RollbackBookmark restores the bookmark to the state of the revision.
+func (db *SQLiteDatabase) RollbackBookmark(ctx context.Context, revisionID int) (model.Bookmark, error) {
+	return rollbackBookmark(ctx, db, revisionID)
+}
+
+// SaveBookmarkNotes replaces the Markdown notes of bookmark.
+func (db *SQLiteDatabase) SaveBookmarkNotes(ctx context.Context, bookmarkID int, notes string) error {
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return saveBookmarkNotes(ctx, tx, bookmarkID, notes, sqliteAnnotationsQuery)
+	})
+}
+
+// GetHighlights fetch the highlights of bookmark, ordered by their position in the content.
+func (db *SQLiteDatabase) GetHighlights(ctx context.Context, bookmarkID int) ([]model.Highlight, error) {
+	return getHighlights(ctx, db, bookmarkID, `created`)
+}
+
+// GetHighlight fetch a single highlight with matching ID.
+func (db *SQLiteDatabase) GetHighlight(ctx context.Context, id int) (model.Highlight, error) {
+	return getHighlight(ctx, db, id, `created`)
+}
+
+// SaveHighlight creates new highlight of the bookmark, or updates the one with matching ID.
+func (db *SQLiteDatabase) SaveHighlight(ctx context.Context, highlight model.Highlight) (result model.Highlight, err error) {
+	insert := func(ctx context.Context, tx *sqlx.Tx, highlight model.Highlight) (int, error) {
+		res, err := tx.ExecContext(ctx, `INSERT INTO highlight
+			(bookmark_id, created, quote, prefix, suffix, start_offset, end_offset, comment)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			highlight.BookmarkID, highlight.Created, highlight.Quote, highlight.Prefix,
+			highlight.Suffix, highlight.StartOffset, highlight.EndOffset, highlight.Comment)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		id, err := res.LastInsertId()
+		return int(id), errors.WithStack(err)
 	}
 
-	return nil
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err = saveHighlight(ctx, tx, highlight, `created`, sqliteAnnotationsQuery, insert)
+		return err
+	})
+
+	return result, err
+}
+
+// DeleteHighlights removes the highlights with matching IDs.
+func (db *SQLiteDatabase) DeleteHighlights(ctx context.Context, ids ...int) error {
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return deleteHighlights(ctx, tx, ids, sqliteAnnotationsQuery)
+	})
 }
 
-func (*SQLiteDatabase) SaveBookmarks(ctx context.Context, create bool, bookmarks ...model.Bookmark) ([]model.Bookmark, error) {
-	return nil, nil
+// SaveReadingState updates the reading status and progress of bookmark.
+func (db *SQLiteDatabase) SaveReadingState(ctx context.Context, bookmarkID int, status string, progress int) error {
+	return saveReadingState(ctx, db, bookmarkID, status, progress)
 }
 
-func (*SQLiteDatabase) GetBookMarks(ctx context.Context, opts GetBookmarksOptions) ([]model.Bookmark, error) {
-	return nil, nil
+// WithTx runs fn with a database whose changes are made in one transaction.
+func (db *SQLiteDatabase) WithTx(ctx context.Context, fn func(tx DB) error) error {
+	return db.runTx(ctx, func(tx dbbase) error {
+		return fn(&SQLiteDatabase{dbbase: tx})
+	})
+}
+
+// GetTags fetch list of tags of the account and the number of their bookmarks.
+func (db *SQLiteDatabase) GetTags(ctx context.Context, accountID int) ([]model.Tag, error) {
+	return getTags(ctx, db, accountID)
+}
+
+// sqliteMergeTagQuery copies the bookmarks of a tag to the tag it's merged into.
+const sqliteMergeTagQuery = `INSERT OR IGNORE INTO bookmark_tag (tag_id, bookmark_id)
+	SELECT ?, bookmark_id FROM bookmark_tag WHERE tag_id = ?`
+
+// RenameTag changes the name of a tag together with its subtree,
+// or merges it into the tag that already has the new name.
+func (db *SQLiteDatabase) RenameTag(ctx context.Context, id int, newName string) (tag model.Tag, err error) {
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		tag, err = renameTag(ctx, tx, id, newName, sqliteMergeTagQuery, insertTag)
+		return err
+	})
+
+	return tag, err
 }
 
 // GetAccount fetch account with matching username.
 // Returns the account and boolean whether it's exist or not.
 func (db *SQLiteDatabase) GetAccount(ctx context.Context, username string) (model.Account, bool, error) {
 	account := model.Account{}
-	err := db.GetContext(ctx, &account, `SELECT 
-    	id, username, owner FROM account where username = ?`,
+	err := db.GetContext(ctx, &account, `SELECT
+		id, username, owner FROM account WHERE username = ?`,
 		username)
-	if err != nil {
+	if err != nil && err != sql.ErrNoRows {
 		//errors.WithStack(err) 是 Go 语言 errors 包中的一个函数，它的作用是将原始错误（err）包装为一个新的错误，该新错误包含了堆栈跟踪信息。
 		return account, false, errors.WithStack(err)
 	}
@@ -79,14 +771,28 @@ func (db *SQLiteDatabase) GetAccount(ctx context.Context, username string) (mode
 	return account, account.ID != 0, nil
 }
 
+// GetAccountWithPassword fetch account with matching username, including its password hash.
+// Returns the account and boolean whether it's exist or not.
+func (db *SQLiteDatabase) GetAccountWithPassword(ctx context.Context, username string) (model.Account, bool, error) {
+	account := model.Account{}
+	err := db.GetContext(ctx, &account, `SELECT
+		id, username, password, owner FROM account WHERE username = ?`,
+		username)
+	if err != nil && err != sql.ErrNoRows {
+		return account, false, errors.WithStack(err)
+	}
+
+	return account, account.ID != 0, nil
+}
+
 // GetAccounts fetch list of account (without its password) based on submitted options
 func (db *SQLiteDatabase) GetAccounts(ctx context.Context, opts GetAccountsOptions) ([]model.Account, error) {
 	// Create query
 	args := []interface{}{}
-	query := `SELECT id, username, owner FROM  account where 1`
+	query := `SELECT id, username, owner FROM account WHERE 1`
 
 	if opts.Keyword != "" {
-		query += "AND username LIKE ? "
+		query += " AND username LIKE ?"
 		args = append(args, "%"+opts.Keyword+"%")
 	}
 
@@ -96,7 +802,7 @@ func (db *SQLiteDatabase) GetAccounts(ctx context.Context, opts GetAccountsOptio
 	query += " ORDER BY username"
 
 	// Fetch list account
-	var accounts []model.Account
+	accounts := []model.Account{}
 	err := db.SelectContext(ctx, &accounts, query, args...)
 	if err != nil && err != sql.ErrNoRows {
 		// WithStack在WithStack被调用时用堆栈跟踪来注释err。
@@ -106,3 +812,161 @@ func (db *SQLiteDatabase) GetAccounts(ctx context.Context, opts GetAccountsOptio
 
 	return accounts, nil
 }
+
+// SaveAccount creates new account, its password is hashed with bcrypt.
+// Returns the saved account with its ID filled in, without the password.
+func (db *SQLiteDatabase) SaveAccount(ctx context.Context, account model.Account) (model.Account, error) {
+	hash, err := hashPassword(account.Password)
+	if err != nil {
+		return account, err
+	}
+
+	account.ID = 0
+	account.Password = hash
+	return db.SaveAccountWithHash(ctx, account)
+}
+
+// SaveAccountWithHash creates new account whose password is already hashed with bcrypt.
+// A new ID is generated unless the account already has one.
+// Returns the saved account with its ID filled in, without the password.
+func (db *SQLiteDatabase) SaveAccountWithHash(ctx context.Context, account model.Account) (model.Account, error) {
+	if account.Username == "" {
+		return account, errors.New("username must not be empty")
+	}
+
+	if account.Password == "" {
+		return account, errors.New("password must not be empty")
+	}
+
+	hash := account.Password
+	account.Password = ""
+
+	res, err := db.ExecContext(ctx, `INSERT INTO account
+		(id, username, password, owner) VALUES (NULLIF(?, 0), ?, ?, ?)`,
+		account.ID, account.Username, hash, account.Owner)
+	if err != nil {
+		return account, sqliteSaveError(err, fmt.Sprintf("account %q", account.Username))
+	}
+
+	accountID, err := res.LastInsertId()
+	if err != nil {
+		return account, errors.WithStack(err)
+	}
+	account.ID = int(accountID)
+
+	return account, nil
+}
+
+// UpdateAccount updates the username and owner of account with matching ID.
+// The password is hashed and updated as well when it's not empty.
+func (db *SQLiteDatabase) UpdateAccount(ctx context.Context, account model.Account) error {
+	if account.Username == "" {
+		return errors.New("username must not be empty")
+	}
+
+	return db.withTx(ctx, func(tx *sqlx.Tx) error {
+		args := []interface{}{account.Username, account.Owner}
+		query := `UPDATE account SET username = ?, owner = ?`
+
+		if account.Password != "" {
+			hash, err := hashPassword(account.Password)
+			if err != nil {
+				return err
+			}
+
+			query += `, password = ?`
+			args = append(args, hash)
+		}
+
+		query += ` WHERE id = ?`
+		args = append(args, account.ID)
+
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return sqliteSaveError(err, fmt.Sprintf("account %q", account.Username))
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if rows == 0 {
+			return errors.Wrapf(ErrNotFound, "account %d", account.ID)
+		}
+
+		return nil
+	})
+}
+
+// DeleteAccounts removes all record with matching usernames
+func (db *SQLiteDatabase) DeleteAccounts(ctx context.Context, usernames ...string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	var ids []int
+	err := db.withTx(ctx, func(tx *sqlx.Tx) (err error) {
+		ids, err = deleteAccountBookmarks(ctx, tx, usernames, `DELETE FROM bookmark_content WHERE docid IN (?)`)
+		if err != nil {
+			return err
+		}
+
+		if err := deleteAccountSavedSearches(ctx, tx, usernames); err != nil {
+			return err
+		}
+
+		query, args, err := sqlx.In(`DELETE FROM account WHERE username IN (?)`, usernames)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.deleteBookmarkFiles(ids)
+}
+
+// GetSavedSearches fetch the saved searches of the account, ordered by name.
+func (db *SQLiteDatabase) GetSavedSearches(ctx context.Context, accountID int) ([]model.SavedSearch, error) {
+	return getSavedSearches(ctx, db, accountID)
+}
+
+// GetSavedSearch fetch the saved search with matching ID that belongs to the account.
+func (db *SQLiteDatabase) GetSavedSearch(ctx context.Context, accountID, id int) (model.SavedSearch, bool, error) {
+	return getSavedSearch(ctx, db, accountID, id)
+}
+
+// SaveSavedSearch creates new saved search, or updates the one with matching ID.
+func (db *SQLiteDatabase) SaveSavedSearch(ctx context.Context, search model.SavedSearch) (model.SavedSearch, error) {
+	if err := validateSavedSearch(&search); err != nil {
+		return search, err
+	}
+
+	if search.ID != 0 {
+		return search, updateSavedSearch(ctx, db, search, sqliteSaveError)
+	}
+
+	res, err := db.ExecContext(ctx, `INSERT INTO saved_search
+		(account_id, name, query) VALUES (?, ?, ?)`,
+		search.AccountID, search.Name, search.Query)
+	if err != nil {
+		return search, sqliteSaveError(err, fmt.Sprintf("saved search %q", search.Name))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return search, errors.WithStack(err)
+	}
+	search.ID = int(id)
+
+	return search, nil
+}
+
+// DeleteSavedSearches removes the saved searches of the account with matching IDs.
+func (db *SQLiteDatabase) DeleteSavedSearches(ctx context.Context, accountID int, ids ...int) error {
+	return deleteSavedSearches(ctx, db, accountID, ids)
+}
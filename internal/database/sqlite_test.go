@@ -0,0 +1,465 @@
+package database
+
+import (
+	"context"
+	fp "path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+func sqliteTestDatabaseFactory(t *testing.T) DB {
+	db, err := OpenSQLiteDatabase(context.TODO(), fp.Join(t.TempDir(), "shiori.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSQLiteDatabase(t *testing.T) {
+	testDatabase(t, sqliteTestDatabaseFactory)
+}
+
+func TestSQLiteSnapshot(t *testing.T) {
+	ctx := context.TODO()
+	db := sqliteTestDatabaseFactory(t).(*SQLiteDatabase)
+
+	saved := saveTestBookmarks(t, db, model.Bookmark{
+		URL:     "https://github.com/go-shiori/shiori",
+		Title:   "shiori",
+		Content: "simple bookmark manager",
+	})
+
+	snapshotPath := fp.Join(t.TempDir(), "snapshot.db")
+	if err := db.Snapshot(ctx, snapshotPath); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := OpenSQLiteDatabase(ctx, snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	books, err := snapshot.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].ID != saved[0].ID {
+		t.Errorf("unexpected bookmarks in snapshot %+v", books)
+	}
+
+	// Existing file is never overwritten
+	if err := db.Snapshot(ctx, snapshotPath); err == nil {
+		t.Error("expected error for existing snapshot file")
+	}
+}
+
+func TestSQLiteFillCanonicalURLs(t *testing.T) {
+	ctx := context.TODO()
+	db, err := OpenSQLiteDatabase(ctx, fp.Join(t.TempDir(), "shiori.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Bookmark saved before canonical URLs are stored
+	if err := db.MigrateTo(5); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO bookmark (url, title, excerpt, author, public, modified)
+		VALUES ('http://www.example.com/a/?utm_source=feed', 'example', '', '', 0, '2020-01-01 00:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var canonicalURL string
+	if err := db.GetContext(ctx, &canonicalURL, `SELECT canonical_url FROM bookmark`); err != nil {
+		t.Fatal(err)
+	}
+	if canonicalURL != "https://example.com/a" {
+		t.Errorf("unexpected canonical URL %q", canonicalURL)
+	}
+
+	_, err = db.SaveBookmarks(ctx, true, model.Bookmark{URL: "https://example.com/a", Title: "example again"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+}
+
+func TestSQLiteMigrateStepsFixData(t *testing.T) {
+	ctx := context.TODO()
+	db, err := OpenSQLiteDatabase(ctx, fp.Join(t.TempDir(), "shiori.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.MigrateTo(5); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{
+		`INSERT INTO account (username, password, owner) VALUES ('shiori', 'secret', 1)`,
+		`INSERT INTO bookmark (url, title) VALUES ('http://www.example.com/a/', 'example')`,
+	} {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Canonical URL is filled as soon as it's stored
+	if err := db.MigrateSteps(1); err != nil {
+		t.Fatal(err)
+	}
+
+	var canonicalURL string
+	if err := db.GetContext(ctx, &canonicalURL, `SELECT canonical_url FROM bookmark`); err != nil {
+		t.Fatal(err)
+	}
+	if canonicalURL != "https://example.com/a" {
+		t.Errorf("unexpected canonical URL %q", canonicalURL)
+	}
+
+	// Bookmark is claimed as soon as it belongs to accounts
+	if err := db.MigrateTo(9); err != nil {
+		t.Fatal(err)
+	}
+
+	var accountID int
+	if err := db.GetContext(ctx, &accountID, `SELECT account_id FROM bookmark`); err != nil {
+		t.Fatal(err)
+	}
+	if accountID != 1 {
+		t.Errorf("bookmark isn't claimed by owner, account %d", accountID)
+	}
+
+	// Fixes of the migrations that were applied before don't run again
+	_, err = db.ExecContext(ctx, `UPDATE bookmark SET canonical_url = '', account_id = 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.GetContext(ctx, &canonicalURL, `SELECT canonical_url FROM bookmark`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.GetContext(ctx, &accountID, `SELECT account_id FROM bookmark`); err != nil {
+		t.Fatal(err)
+	}
+	if canonicalURL != "" || accountID != 0 {
+		t.Errorf("data is fixed again, canonical URL %q, account %d", canonicalURL, accountID)
+	}
+}
+
+func TestSQLiteDirtyMigrationStatus(t *testing.T) {
+	db := sqliteTestDatabaseFactory(t).(*SQLiteDatabase)
+
+	if _, err := db.ExecContext(context.TODO(), `UPDATE schema_migrations SET dirty = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := status.Migrations[len(status.Migrations)-1]
+	if !status.Dirty || last.Applied || !last.Failed || status.Pending() != 1 {
+		t.Errorf("dirty migration is reported as applied %+v", status)
+	}
+
+	for _, migration := range status.Migrations[:len(status.Migrations)-1] {
+		if !migration.Applied || migration.Failed {
+			t.Errorf("unexpected status of migration %+v", migration)
+		}
+	}
+}
+
+func TestSQLiteFindDuplicatesByStoredURL(t *testing.T) {
+	ctx := context.TODO()
+	db := sqliteTestDatabaseFactory(t).(*SQLiteDatabase)
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go"},
+		model.Bookmark{URL: "https://golang.org", Title: "golang"},
+	)
+
+	// Duplicates are grouped by the stored canonical URL, e.g. the one of a moved page
+	_, err := db.ExecContext(ctx, `UPDATE bookmark SET canonical_url = 'https://go.dev' WHERE id = ?`, saved[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dups, err := FindDuplicates(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 1 || dups[0].Keep.ID != saved[0].ID || !equalIDs(bookmarkIDs(dups[0].Others), bookmarkIDs(saved[1:])) {
+		t.Errorf("unexpected duplicates %+v", dups)
+	}
+}
+
+func TestSQLiteClaimOrphans(t *testing.T) {
+	ctx := context.TODO()
+	db, err := OpenSQLiteDatabase(ctx, fp.Join(t.TempDir(), "shiori.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Bookmarks and tags saved before they belong to accounts
+	if err := db.MigrateTo(8); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{
+		`INSERT INTO bookmark (id, url, title) VALUES (1, 'https://go.dev', 'go'), (2, 'https://example.com', 'example')`,
+		`INSERT INTO tag (id, name) VALUES (1, 'lang'), (2, 'news')`,
+		`INSERT INTO tag (id, name, parent_id) VALUES (3, 'lang/go', 1)`,
+		`INSERT INTO bookmark_tag (bookmark_id, tag_id) VALUES (1, 3), (2, 2)`,
+	} {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is claimed while there is no owner
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if books, _ := db.GetBookMarks(ctx, GetBookmarksOptions{AccountID: 1}); len(books) != 0 {
+		t.Fatalf("bookmarks shouldn't be claimed without owner %+v", books)
+	}
+
+	// The owner already has a tag and a page of the orphans
+	owner, err := db.SaveAccount(ctx, model.Account{Username: "shiori", Password: "secret", Owner: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveTestBookmarks(t, db, model.Bookmark{AccountID: owner.ID, URL: "http://www.example.com/?utm_source=feed", Title: "example",
+		Tags: []model.Tag{{Name: "lang"}}})
+
+	err = db.withTx(ctx, func(tx *sqlx.Tx) error {
+		return claimOrphans(ctx, tx, sqliteMergeTagQuery)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{AccountID: owner.ID, OrderMethod: DefaultOrder})
+	if err != nil || len(books) != 2 || books[0].ID != 1 || len(books[0].Tags) != 1 || books[0].Tags[0].Name != "lang/go" {
+		t.Errorf("unexpected claimed bookmarks %+v %v", books, err)
+	}
+
+	if books, _ := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: []int{2}}); len(books) != 1 || books[0].AccountID != 0 {
+		t.Errorf("page saved by the owner should stay without account %+v", books)
+	}
+
+	// Orphans are only claimed when migrating to the version where bookmarks belong to accounts
+	_, err = db.ExecContext(ctx, `INSERT INTO bookmark (url, title) VALUES ('https://www.rust-lang.org', 'rust')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var accountID int
+	if err := db.GetContext(ctx, &accountID, `SELECT account_id FROM bookmark WHERE url = 'https://www.rust-lang.org'`); err != nil || accountID != 0 {
+		t.Errorf("orphan shouldn't be claimed without migrating to version 9, account %d %v", accountID, err)
+	}
+
+	// The orphan tag is merged into the owner's tag with the same name
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, tag := range tags {
+		if tag.AccountID != owner.ID {
+			t.Errorf("tag %q isn't claimed", tag.Name)
+		}
+		names = append(names, tag.Name)
+	}
+	if strings.Join(names, ",") != "lang,lang/go,news" {
+		t.Errorf("unexpected claimed tags %v", names)
+	}
+}
+
+func TestSQLiteSaveBookmarks(t *testing.T) {
+	ctx := context.TODO()
+	db := sqliteTestDatabaseFactory(t).(*SQLiteDatabase)
+
+	saved := saveTestBookmarks(t, db, model.Bookmark{
+		URL:     "https://go.dev",
+		Title:   "go",
+		Content: "simple",
+		Tags:    []model.Tag{{Name: "lang"}, {Name: "dev"}},
+	})
+	book := saved[0]
+
+	getContent := func() string {
+		t.Helper()
+
+		var content string
+		err := db.GetContext(ctx, &content, `SELECT content FROM bookmark_content WHERE docid = ?`, book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+
+	// Inserted bookmark is indexed for full text search
+	if content := getContent(); content != "simple" {
+		t.Fatalf("unexpected indexed content %q", content)
+	}
+
+	// Updated content replaces the indexed one
+	book.Content = "secure"
+	book.Tags = []model.Tag{{Name: "lang"}, {Name: "dev", Deleted: true}}
+	if _, err := db.SaveBookmarks(ctx, false, book); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := getContent(); content != "secure" {
+		t.Fatalf("unexpected indexed content after update %q", content)
+	}
+
+	var nContents int
+	if err := db.GetContext(ctx, &nContents, `SELECT COUNT(*) FROM bookmark_content`); err != nil {
+		t.Fatal(err)
+	}
+	if nContents != 1 {
+		t.Fatalf("content is indexed %d times", nContents)
+	}
+
+	// Bookmark without indexed content gets it on update
+	if _, err := db.ExecContext(ctx, `DELETE FROM bookmark_content`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SaveBookmarks(ctx, false, book); err != nil {
+		t.Fatal(err)
+	}
+	if content := getContent(); content != "secure" {
+		t.Fatalf("unexpected indexed content after reindex %q", content)
+	}
+
+	// Deleted tag is unlinked, but the tag itself is kept
+	var linked, tags []string
+	err := db.SelectContext(ctx, &linked, `SELECT t.name FROM tag t
+		JOIN bookmark_tag bt ON bt.tag_id = t.id
+		WHERE bt.bookmark_id = ?`, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SelectContext(ctx, &tags, `SELECT name FROM tag ORDER BY name`); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(linked, ",") != "lang" || strings.Join(tags, ",") != "dev,lang" {
+		t.Errorf("unexpected tags: linked %v, saved %v", linked, tags)
+	}
+}
+
+func TestSQLiteGetBookmarks(t *testing.T) {
+	ctx := context.TODO()
+	db := sqliteTestDatabaseFactory(t)
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://go.dev", Title: "go", Content: "gopher", Tags: []model.Tag{{Name: "lang"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust", Tags: []model.Tag{{Name: "lang"}, {Name: "safe"}}},
+		model.Bookmark{URL: "https://example.com", Title: "example", Excerpt: "gopher"},
+	)
+	ids := bookmarkIDs(saved)
+
+	tests := []struct {
+		name     string
+		opts     GetBookmarksOptions
+		expected []int
+	}{
+		{"ids", GetBookmarksOptions{IDs: []int{ids[2], ids[0]}}, []int{ids[0], ids[2]}},
+		{"tag", GetBookmarksOptions{Tags: []string{"lang"}}, ids[:2]},
+		{"excluded tag", GetBookmarksOptions{Tags: []string{"lang"}, ExcludedTags: []string{"safe"}}, ids[:1]},
+		{"keyword in content or excerpt", GetBookmarksOptions{Keyword: "gopher"}, []int{ids[0], ids[2]}},
+		{"keyword and ids", GetBookmarksOptions{Keyword: "gopher", IDs: ids[1:]}, ids[2:]},
+	}
+
+	for _, test := range tests {
+		books, err := db.GetBookMarks(ctx, test.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := bookmarkIDs(books); !equalIDs(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+
+	// Content is only fetched when it's asked for
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{IDs: ids[:1], WithContent: true})
+	if err != nil || len(books) != 1 || books[0].Content != "gopher" || !books[0].HasContent {
+		t.Errorf("unexpected bookmark with content %+v %v", books, err)
+	}
+}
+
+func TestSQLiteOrderByRelevance(t *testing.T) {
+	ctx := context.TODO()
+	db := sqliteTestDatabaseFactory(t).(*SQLiteDatabase)
+
+	saved := saveTestBookmarks(t, db,
+		model.Bookmark{URL: "https://example.com", Title: "example", Content: "go is a language, one of many languages"},
+		model.Bookmark{URL: "https://go.dev", Title: "go", Content: "go go go"},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "rust"},
+	)
+	ids := bookmarkIDs(saved)
+
+	// The order is the same as bm25 of the full text index
+	expected := []int{}
+	err := db.SelectContext(ctx, &expected, `SELECT docid FROM bookmark_content
+		WHERE bookmark_content MATCH ?
+		ORDER BY bm25(bookmark_content)`, sqliteMatchQuery(true, "go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(expected, []int{ids[1], ids[0]}) {
+		t.Fatalf("unexpected bm25 order %v", expected)
+	}
+
+	books, err := db.GetBookMarks(ctx, GetBookmarksOptions{Keyword: "go", OrderMethod: ByRelevance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bookmarkIDs(books); !equalIDs(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Without keyword it's the same as ByLastAdded
+	books, err = db.GetBookMarks(ctx, GetBookmarksOptions{OrderMethod: ByRelevance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bookmarkIDs(books); !equalIDs(got, []int{ids[2], ids[1], ids[0]}) {
+		t.Errorf("unexpected order without keyword %v", got)
+	}
+}
@@ -0,0 +1,392 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/new-aspect/shiori-practice/internal/model"
+)
+
+// Tags are nested by their path, e.g. tag "lang/go" is the child of tag "lang".
+// The full path is stored as the tag name, and parent_id links it to its parent.
+// Like bookmarks, tags belong to an account and their names are unique for each account.
+const tagSeparator = "/"
+
+// tagInserter inserts a new tag of the account and returns its ID.
+type tagInserter func(ctx context.Context, tx *sqlx.Tx, accountID int, name string, parentID sql.NullInt64) (int, error)
+
+// normalizeTagName lower cases the tag name, collapses its whitespace
+// and removes the empty segments of its path.
+func normalizeTagName(name string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(strings.ToLower(name), tagSeparator) {
+		if segment = strings.Join(strings.Fields(segment), " "); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return strings.Join(segments, tagSeparator)
+}
+
+// tagParentName returns the path of the parent tag, or empty string for root tags.
+func tagParentName(name string) string {
+	if i := strings.LastIndex(name, tagSeparator); i >= 0 {
+		return normalizeTagName(name[:i])
+	}
+	return ""
+}
+
+// likeEscaper escapes the special characters of LIKE patterns used with ESCAPE '!'.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// tagDescendantsPattern returns LIKE pattern that matches all descendants of the tag.
+// It must be used with ESCAPE '!'.
+func tagDescendantsPattern(name string) string {
+	return likeEscaper.Replace(name) + tagSeparator + "%"
+}
+
+// tagFilterClause returns where clause for bookmarks that have every tag in tags
+// and none of excludedTags. A tag also matches bookmarks of its descendants.
+func tagFilterClause(tags, excludedTags []string) (string, []interface{}) {
+	query := ""
+	args := []interface{}{}
+
+	for _, tag := range tags {
+		query += ` AND b.id IN (
+			SELECT bt.bookmark_id
+			FROM bookmark_tag bt
+			LEFT JOIN tag t ON bt.tag_id = t.id
+			WHERE t.name = ? OR t.name LIKE ? ESCAPE '!')`
+		args = append(args, tag, tagDescendantsPattern(tag))
+	}
+
+	if len(excludedTags) > 0 {
+		conditions := make([]string, len(excludedTags))
+		for i, tag := range excludedTags {
+			conditions[i] = `t.name = ? OR t.name LIKE ? ESCAPE '!'`
+			args = append(args, tag, tagDescendantsPattern(tag))
+		}
+
+		query += ` AND b.id NOT IN (
+			SELECT DISTINCT bt.bookmark_id
+			FROM bookmark_tag bt
+			LEFT JOIN tag t ON bt.tag_id = t.id
+			WHERE ` + strings.Join(conditions, " OR ") + `)`
+	}
+
+	return query, args
+}
+
+// insertTag inserts a tag and returns its ID using LastInsertId.
+func insertTag(ctx context.Context, tx *sqlx.Tx, accountID int, name string, parentID sql.NullInt64) (int, error) {
+	res, err := tx.ExecContext(ctx, `INSERT INTO tag (account_id, name, parent_id) VALUES (?, ?, ?)`,
+		accountID, name, parentID)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return int(id), nil
+}
+
+// checkTagAccount returns ErrNotFound unless the tag exists and belongs to the account,
+// so bookmarks can't be linked to the tags of other accounts.
+func checkTagAccount(ctx context.Context, tx *sqlx.Tx, id, accountID int) error {
+	var tagAccountID int
+	err := tx.GetContext(ctx, &tagAccountID, tx.Rebind(`SELECT account_id FROM tag WHERE id = ?`), id)
+	if err == sql.ErrNoRows || (err == nil && tagAccountID != accountID) {
+		return errors.Wrapf(ErrNotFound, "tag %d", id)
+	}
+
+	return errors.WithStack(err)
+}
+
+// saveTag returns ID of the account's tag with the name. When it doesn't exist yet,
+// the tag is created together with its missing ancestors.
+func saveTag(ctx context.Context, tx *sqlx.Tx, accountID int, name string, insert tagInserter) (int, error) {
+	var id int
+	err := tx.GetContext(ctx, &id, tx.Rebind(`SELECT id FROM tag WHERE account_id = ? AND name = ?`), accountID, name)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, errors.WithStack(err)
+	}
+
+	parentID, err := saveTagParent(ctx, tx, accountID, name, insert)
+	if err != nil {
+		return 0, err
+	}
+
+	return insert(ctx, tx, accountID, name, parentID)
+}
+
+// saveTagParent returns ID of the parent of the tag, creating it when needed.
+// It's null for root tags.
+func saveTagParent(ctx context.Context, tx *sqlx.Tx, accountID int, name string, insert tagInserter) (sql.NullInt64, error) {
+	parentName := tagParentName(name)
+	if parentName == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	parentID, err := saveTag(ctx, tx, accountID, parentName, insert)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	return sql.NullInt64{Int64: int64(parentID), Valid: true}, nil
+}
+
+// linkTagParents links the tags with slash separated names that
+// don't have a parent yet, e.g. the ones saved before tags are nested.
+func linkTagParents(ctx context.Context, tx *sqlx.Tx, insert tagInserter) error {
+	tags := []model.Tag{}
+	err := tx.SelectContext(ctx, &tags, `SELECT id, account_id, name FROM tag
+		WHERE parent_id IS NULL AND name LIKE '%/%'
+		ORDER BY name`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, tag := range tags {
+		parentID, err := saveTagParent(ctx, tx, tag.AccountID, tag.Name, insert)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE tag SET parent_id = ? WHERE id = ?`), parentID, tag.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// removeUnusedTags removes tags that don't have any bookmarks nor children.
+// It's repeated until nothing removed, so unused parents are removed as well.
+func removeUnusedTags(ctx context.Context, tx *sqlx.Tx) error {
+	for {
+		res, err := tx.ExecContext(ctx, `DELETE FROM tag
+			WHERE id NOT IN (SELECT DISTINCT tag_id FROM bookmark_tag)
+			AND id NOT IN (SELECT parent_id FROM (
+				SELECT DISTINCT parent_id FROM tag WHERE parent_id IS NOT NULL) p)`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// getTags fetch list of tags of the account and the number of their bookmarks,
+// the bookmarks in trash aren't counted. Account 0 fetches the tags of every account.
+func getTags(ctx context.Context, db sqlx.ExtContext, accountID int) ([]model.Tag, error) {
+	query := `SELECT t.id, t.account_id, t.name,
+		COALESCE(t.parent_id, 0) parent_id, COUNT(b.id) n_bookmarks
+		FROM tag t
+		LEFT JOIN bookmark_tag bt ON bt.tag_id = t.id
+		LEFT JOIN bookmark b ON b.id = bt.bookmark_id AND b.deleted_at IS NULL`
+	args := []interface{}{}
+
+	if accountID != 0 {
+		query += ` WHERE t.account_id = ?`
+		args = append(args, accountID)
+	}
+
+	query += ` GROUP BY t.id, t.account_id, t.name, t.parent_id
+		ORDER BY t.name, t.account_id`
+
+	tags := []model.Tag{}
+	err := sqlx.SelectContext(ctx, db, &tags, db.Rebind(query), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	return tags, nil
+}
+
+// TagTree nests the tags under their parent. The tags whose parent
+// isn't in the list are returned as the roots.
+func TagTree(tags []model.Tag) []model.Tag {
+	exists := map[int]bool{}
+	for _, tag := range tags {
+		exists[tag.ID] = true
+	}
+
+	children := map[int][]model.Tag{}
+	for _, tag := range tags {
+		parentID := tag.ParentID
+		if !exists[parentID] {
+			parentID = 0
+		}
+		children[parentID] = append(children[parentID], tag)
+	}
+
+	var build func(parentID int) []model.Tag
+	build = func(parentID int) []model.Tag {
+		nodes := children[parentID]
+		for i := range nodes {
+			nodes[i].Children = build(nodes[i].ID)
+		}
+		return nodes
+	}
+
+	roots := build(0)
+	if roots == nil {
+		roots = []model.Tag{}
+	}
+
+	return roots
+}
+
+// CountTags returns the tags of the bookmarks with their number of bookmarks,
+// a bookmark is counted for the ancestors of its tags too. The tags are only
+// identified by their name and ordered by it, e.g. for the public bookmarks.
+func CountTags(bookmarks []model.Bookmark) []model.Tag {
+	counts := map[string]int{}
+	for _, book := range bookmarks {
+		names := map[string]bool{}
+		for _, tag := range book.Tags {
+			for name := tag.Name; name != ""; name = tagParentName(name) {
+				names[name] = true
+			}
+		}
+
+		for name := range names {
+			counts[name]++
+		}
+	}
+
+	tags := []model.Tag{}
+	for name, count := range counts {
+		tags = append(tags, model.Tag{Name: name, NBookmarks: count})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags
+}
+
+// renameTag changes the name of a tag and moves its whole subtree along,
+// e.g. renaming "lang" to "code" renames "lang/go" to "code/go".
+// A tag is merged into the tag of the same account that already has the new name. mergeQuery
+// copies bookmark_tag rows of the tag (second param) to the merge target
+// (first param), ignoring existing rows.
+func renameTag(ctx context.Context, tx *sqlx.Tx, id int, newName, mergeQuery string, insert tagInserter) (model.Tag, error) {
+	tag := model.Tag{ID: id, Name: normalizeTagName(newName)}
+	if tag.Name == "" {
+		return tag, errors.New("tag name must not be empty")
+	}
+
+	// Make sure the tag exists
+	old := model.Tag{}
+	err := tx.GetContext(ctx, &old, tx.Rebind(`SELECT account_id, name FROM tag WHERE id = ?`), id)
+	if err == sql.ErrNoRows {
+		return tag, errors.Wrapf(ErrNotFound, "tag %d", id)
+	}
+	if err != nil {
+		return tag, errors.WithStack(err)
+	}
+
+	oldName := old.Name
+	tag.AccountID = old.AccountID
+	if tag.Name == oldName {
+		return tag, nil
+	}
+	if strings.HasPrefix(tag.Name, oldName+tagSeparator) {
+		return tag, errors.Errorf("tag %q can't be moved into itself", oldName)
+	}
+
+	// Fetch the descendants before the tag is renamed
+	descendants := []model.Tag{}
+	err = tx.SelectContext(ctx, &descendants, tx.Rebind(`SELECT id, name FROM tag
+		WHERE account_id = ? AND name LIKE ? ESCAPE '!'`), tag.AccountID, tagDescendantsPattern(oldName))
+	if err != nil {
+		return tag, errors.WithStack(err)
+	}
+
+	// Parents must be renamed before their children
+	sort.Slice(descendants, func(i, j int) bool {
+		return strings.Count(descendants[i].Name, tagSeparator) < strings.Count(descendants[j].Name, tagSeparator)
+	})
+
+	tag.ID, err = renameTagNode(ctx, tx, tag.AccountID, id, tag.Name, mergeQuery, insert)
+	if err != nil {
+		return tag, err
+	}
+
+	for _, descendant := range descendants {
+		name := tag.Name + descendant.Name[len(oldName):]
+		if _, err := renameTagNode(ctx, tx, tag.AccountID, descendant.ID, name, mergeQuery, insert); err != nil {
+			return tag, err
+		}
+	}
+
+	return tag, nil
+}
+
+// renameTagNode renames a single tag of the account and links it to the parent of its new path.
+// It returns ID of the tag that it is merged into, or its own ID.
+func renameTagNode(ctx context.Context, tx *sqlx.Tx, accountID, id int, name, mergeQuery string, insert tagInserter) (int, error) {
+	// Check if there is another tag with the new name
+	var targetID int
+	err := tx.GetContext(ctx, &targetID, tx.Rebind(`SELECT id FROM tag WHERE account_id = ? AND name = ?`), accountID, name)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, errors.WithStack(err)
+	}
+
+	// Just rename it when the name is free
+	if targetID == 0 || targetID == id {
+		parentID, err := saveTagParent(ctx, tx, accountID, name, insert)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE tag SET name = ?, parent_id = ? WHERE id = ?`),
+			name, parentID, id)
+		return id, errors.WithStack(err)
+	}
+
+	// Otherwise move its bookmarks and children to the existing tag and remove it
+	return targetID, mergeTag(ctx, tx, id, targetID, mergeQuery)
+}
+
+// mergeTag moves the bookmarks and children of the tag to the target tag, then removes it.
+// mergeQuery is the same as renameTag.
+func mergeTag(ctx context.Context, tx *sqlx.Tx, id, targetID int, mergeQuery string) error {
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{mergeQuery, []interface{}{targetID, id}},
+		{`DELETE FROM bookmark_tag WHERE tag_id = ?`, []interface{}{id}},
+		{`UPDATE tag SET parent_id = ? WHERE parent_id = ?`, []interface{}{targetID, id}},
+		{`DELETE FROM tag WHERE id = ?`, []interface{}{id}},
+	}
+
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, tx.Rebind(q.query), q.args...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -3,27 +3,74 @@ package model
 // Tag is the tag for a bookmark
 type Tag struct {
 	ID         int    `db:"id"          json:"id"`
+	AccountID  int    `db:"account_id"  json:"accountId,omitempty"`
 	Name       string `db:"name"        json:"name"`
+	ParentID   int    `db:"parent_id"   json:"parentId,omitempty"`
 	NBookmarks int    `db:"n_bookmarks" json:"nBookmarks,omitempty"`
+	Children   []Tag  `db:"-"           json:"children,omitempty"`
 	Deleted    bool   `json:"-"`
 }
 
-// Bookmark is the record for an URL
+// Reading status of bookmark. The reading progress of bookmark is
+// the percentage of its content that was read.
+const (
+	StatusUnread     = "unread"
+	StatusInProgress = "in_progress"
+	StatusRead       = "read"
+)
+
+// Bookmark is the record for an URL. Bookmarks and their tags belong to
+// the account with AccountID, 0 is a bookmark without account.
 type Bookmark struct {
-	ID            int    `db:"id"            json:"id"`
-	URL           string `db:"url"           json:"url"`
-	Title         string `db:"title"         json:"title"`
-	Excerpt       string `db:"excerpt"       json:"excerpt"`
-	Author        string `db:"author"        json:"author"`
-	Public        int    `db:"public"        json:"public"`
-	Modified      string `db:"modified"      json:"modified"`
-	Content       string `db:"content"       json:"-"`
-	HTML          string `db:"html"          json:"html,omitempty"`
-	ImageURL      string `db:"image_url"     json:"imageURL"`
-	HasContent    bool   `db:"has_content"   json:"hasContent"`
-	HasArchive    bool   `json:"hasArchive"`
-	Tags          []Tag  `json:"tags"`
-	CreateArchive bool   `json:"createArchive"`
+	ID              int    `db:"id"               json:"id"`
+	AccountID       int    `db:"account_id"       json:"accountId"`
+	URL             string `db:"url"              json:"url"`
+	Title           string `db:"title"            json:"title"`
+	Excerpt         string `db:"excerpt"          json:"excerpt"`
+	Author          string `db:"author"           json:"author"`
+	Public          int    `db:"public"           json:"public"`
+	Modified        string `db:"modified"         json:"modified"`
+	DeletedAt       string `db:"deleted_at"       json:"deletedAt,omitempty"`
+	Content         string `db:"content"          json:"-"`
+	HTML            string `db:"html"             json:"html,omitempty"`
+	ImageURL        string `db:"image_url"        json:"imageURL"`
+	HasContent      bool   `db:"has_content"      json:"hasContent"`
+	Notes           string `db:"notes"            json:"notes"`
+	ReadingStatus   string `db:"reading_status"   json:"readingStatus"`
+	ReadingProgress int    `db:"reading_progress" json:"readingProgress"`
+	HasArchive      bool   `json:"hasArchive"`
+	Tags            []Tag  `json:"tags"`
+	CreateArchive   bool   `json:"createArchive"`
+
+	// Highlights is only filled for exports, see GetHighlights.
+	Highlights []Highlight `db:"-" json:"highlights,omitempty"`
+}
+
+// BookmarkRevision is the snapshot of a bookmark before it was updated.
+type BookmarkRevision struct {
+	ID         int      `db:"id"          json:"id"`
+	BookmarkID int      `db:"bookmark_id" json:"bookmarkId"`
+	Created    string   `db:"created"     json:"created"`
+	Title      string   `db:"title"       json:"title"`
+	Excerpt    string   `db:"excerpt"     json:"excerpt"`
+	Tags       []string `db:"-"           json:"tags"`
+	Content    string   `db:"content"     json:"content,omitempty"`
+	HTML       string   `db:"html"        json:"html,omitempty"`
+}
+
+// Highlight is a quote of the readable content of a bookmark, with the text around it
+// to find it again and an optional comment. The offsets are the position of the quote
+// in the content, counted in characters.
+type Highlight struct {
+	ID          int    `db:"id"           json:"id"`
+	BookmarkID  int    `db:"bookmark_id"  json:"bookmarkId"`
+	Created     string `db:"created"      json:"created"`
+	Quote       string `db:"quote"        json:"quote"`
+	Prefix      string `db:"prefix"       json:"prefix"`
+	Suffix      string `db:"suffix"       json:"suffix"`
+	StartOffset int    `db:"start_offset" json:"startOffset"`
+	EndOffset   int    `db:"end_offset"   json:"endOffset"`
+	Comment     string `db:"comment"      json:"comment"`
 }
 
 // Account is person that allowed to access web interface.
@@ -33,3 +80,12 @@ type Account struct {
 	Password string `db:"password" json:"password,omitempty"`
 	Owner    bool   `db:"owner"    json:"owner"`
 }
+
+// SavedSearch is a search query saved by an account, e.g. to show its bookmarks as a virtual folder.
+type SavedSearch struct {
+	ID         int    `db:"id"         json:"id"`
+	AccountID  int    `db:"account_id" json:"accountId"`
+	Name       string `db:"name"       json:"name"`
+	Query      string `db:"query"      json:"query"`
+	NBookmarks int    `db:"-"          json:"nBookmarks,omitempty"`
+}
@@ -0,0 +1,201 @@
+// Script of the readable content page, see content.html.
+// The highlights of bookmark are shown in the content, and the selected text can be
+// highlighted with an optional comment. Offsets are counted in the text of #content.
+// The scroll position is saved as reading progress, and restored when the page is opened.
+(function () {
+    var content = document.getElementById("content"),
+        bookmarkId = parseInt(content.dataset.id, 10),
+        savedProgress = parseInt(content.dataset.progress, 10) || 0,
+        contextLength = 32,
+        progressDelay = 1000;
+
+    // Only the account of bookmark can highlight it and save its progress
+    if (content.dataset.editable !== "true") {
+        return;
+    }
+
+    // textOffset returns the offset of the position in the text of content
+    function textOffset(node, offset) {
+        var range = document.createRange();
+        range.selectNodeContents(content);
+        range.setEnd(node, offset);
+        return range.toString().length;
+    }
+
+    // findHighlight returns the offsets of the quote in the text of content. The stored
+    // offsets are used when they still point to the quote, otherwise the quote is looked up
+    // with its prefix and suffix, then alone, taking the one nearest to the old position.
+    function findHighlight(text, highlight) {
+        var quote = highlight.quote;
+        if (text.slice(highlight.startOffset, highlight.endOffset) === quote) {
+            return [highlight.startOffset, highlight.endOffset];
+        }
+
+        var withContext = text.indexOf(highlight.prefix + quote + highlight.suffix);
+        if (withContext >= 0) {
+            var start = withContext + highlight.prefix.length;
+            return [start, start + quote.length];
+        }
+
+        var best = -1;
+        for (var i = text.indexOf(quote); i >= 0; i = text.indexOf(quote, i + 1)) {
+            if (best < 0 || Math.abs(i - highlight.startOffset) < Math.abs(best - highlight.startOffset)) {
+                best = i;
+            }
+        }
+
+        return best < 0 ? null : [best, best + quote.length];
+    }
+
+    // wrapRange wraps the text between the offsets with mark elements,
+    // one for each text node it spans, so the structure of content is kept.
+    function wrapRange(start, end, highlight) {
+        var walker = document.createTreeWalker(content, NodeFilter.SHOW_TEXT),
+            nodes = [],
+            pos = 0;
+
+        while (walker.nextNode()) {
+            var node = walker.currentNode,
+                nodeStart = pos,
+                nodeEnd = pos + node.length;
+            pos = nodeEnd;
+
+            if (nodeEnd <= start || nodeStart >= end || node.length === 0) {
+                continue;
+            }
+            nodes.push([node, Math.max(start, nodeStart) - nodeStart, Math.min(end, nodeEnd) - nodeStart]);
+        }
+
+        nodes.forEach(function (item) {
+            var node = item[0];
+            if (item[2] < node.length) {
+                node.splitText(item[2]);
+            }
+            if (item[1] > 0) {
+                node = node.splitText(item[1]);
+            }
+
+            var mark = document.createElement("mark");
+            mark.className = "highlight";
+            mark.dataset.id = highlight.id;
+            mark.title = highlight.comment || "";
+            node.parentNode.insertBefore(mark, node);
+            mark.appendChild(node);
+        });
+    }
+
+    // showHighlight puts the highlight in content, unless its quote isn't found anymore
+    function showHighlight(highlight) {
+        var offsets = findHighlight(content.textContent, highlight);
+        if (offsets) {
+            wrapRange(offsets[0], offsets[1], highlight);
+        }
+    }
+
+    // saveSelection highlights the selected text of content
+    function saveSelection() {
+        var selection = window.getSelection();
+        if (selection.rangeCount === 0 || selection.isCollapsed) {
+            return;
+        }
+
+        var range = selection.getRangeAt(0);
+        if (!content.contains(range.startContainer) || !content.contains(range.endContainer)) {
+            return;
+        }
+
+        var text = content.textContent,
+            start = textOffset(range.startContainer, range.startOffset),
+            end = textOffset(range.endContainer, range.endOffset),
+            quote = text.slice(start, end);
+        if (quote.trim() === "") {
+            return;
+        }
+
+        var comment = window.prompt("Comment of highlight (optional)", "");
+        if (comment === null) {
+            return;
+        }
+
+        var highlight = {
+            bookmarkId: bookmarkId,
+            quote: quote,
+            prefix: text.slice(Math.max(0, start - contextLength), start),
+            suffix: text.slice(end, end + contextLength),
+            startOffset: start,
+            endOffset: end,
+            comment: comment,
+        };
+
+        fetch("api/highlights", {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify(highlight),
+        })
+            .then(response => {
+                if (!response.ok) throw response;
+                return response.json();
+            })
+            .then(saved => {
+                selection.removeAllRanges();
+                wrapRange(start, end, saved);
+            })
+            .catch(err => console.error("failed to save highlight", err));
+    }
+
+    // scrollRange returns how far the page can be scrolled
+    function scrollRange() {
+        return document.documentElement.scrollHeight - window.innerHeight;
+    }
+
+    // saveProgress saves the scroll position as percentage, when it has changed
+    function saveProgress() {
+        var range = scrollRange();
+        if (range <= 0) {
+            return;
+        }
+
+        var progress = Math.min(100, Math.max(0, Math.round(window.scrollY / range * 100)));
+        if (progress === savedProgress) {
+            return;
+        }
+
+        fetch("api/bookmarks/progress", {
+            method: "PUT",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({id: bookmarkId, progress: progress}),
+        })
+            .then(response => {
+                if (!response.ok) throw response;
+                savedProgress = progress;
+            })
+            .catch(err => console.error("failed to save reading progress", err));
+    }
+
+    // Restore the position once images are loaded, then save it while scrolling.
+    // The progress is sent when the scrolling has stopped for a while.
+    window.addEventListener("load", function () {
+        if (savedProgress > 0 && savedProgress < 100) {
+            window.scrollTo(0, scrollRange() * savedProgress / 100);
+        }
+
+        var timer;
+        window.addEventListener("scroll", function () {
+            clearTimeout(timer);
+            timer = setTimeout(saveProgress, progressDelay);
+        });
+    });
+
+    fetch("api/highlights?bookmark=" + bookmarkId)
+        .then(response => {
+            if (!response.ok) throw response;
+            return response.json();
+        })
+        .then(highlights => highlights.forEach(showHighlight))
+        .catch(err => console.error("failed to load highlights", err));
+
+    // Keep the selection when the button is pressed
+    var button = document.getElementById("highlight-button");
+    button.addEventListener("mousedown", e => e.preventDefault());
+    button.addEventListener("click", saveSelection);
+})();
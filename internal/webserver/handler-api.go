@@ -1,6 +1,7 @@
 package webserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gofrs/uuid"
@@ -9,9 +10,24 @@ import (
 	"github.com/new-aspect/shiori-practice/internal/model"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"path"
+	fp "path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// orderMethods maps the order query parameter to database.OrderMethod
+var orderMethods = map[string]database.OrderMethod{
+	"":          database.ByLastAdded,
+	"added":     database.ByLastAdded,
+	"modified":  database.ByLastModified,
+	"title":     database.ByTitle,
+	"url":       database.ByURL,
+	"relevance": database.ByRelevance,
+	"unread":    database.ByUnread,
+}
+
 // apiLogin is handler for POST /api/login
 func (h *handler) apiLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
@@ -79,7 +95,7 @@ func (h *handler) apiLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 	}
 
 	// Get account data form database
-	account, exit, err := h.DB.GetAccount(ctx, request.Username)
+	account, exit, err := h.DB.GetAccountWithPassword(ctx, request.Username)
 	CheckError(err)
 
 	if !exit {
@@ -106,3 +122,870 @@ func (h *handler) apiLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 	// Create session
 	genSession(account, expTime)
 }
+
+// apiGetBookmarks is handler for GET /api/bookmarks
+func (h *handler) apiGetBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	h.serveBookmarks(w, r, libraryID, database.SearchQuery{})
+}
+
+// serveBookmarks writes the bookmarks of the library that match both
+// the URL queries of request and the search, see listBookmarks.
+func (h *handler) serveBookmarks(w http.ResponseWriter, r *http.Request, libraryID int, search database.SearchQuery) {
+	list := h.listBookmarks(r, search, libraryID, false)
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(&list)
+	CheckError(err)
+}
+
+// bookmarkList is a page of bookmarks with the links to the next and previous page.
+type bookmarkList struct {
+	Bookmarks []model.Bookmark `json:"bookmarks"`
+	Next      string           `json:"next"`
+	Prev      string           `json:"prev"`
+}
+
+// listBookmarks fetch the bookmarks of the account that match both the URL queries of request
+// and the search, together with the links to their next and previous page. Zero account
+// is every account. With public, only the public bookmarks outside of trash are fetched,
+// without the notes and reading state of their account, and keywords don't match their
+// notes and highlights.
+func (h *handler) listBookmarks(r *http.Request, search database.SearchQuery, accountID int, public bool) bookmarkList {
+	ctx := r.Context()
+
+	// Get URL queries
+	query := r.URL.Query()
+	keyword := query.Get("keyword")
+	strSearch := query.Get("q")
+	strTags := query.Get("tags")
+	strExcludedTags := query.Get("exclude")
+	strOrder := query.Get("order")
+	strStatus := query.Get("status")
+	strLimit := query.Get("limit")
+	cursor := query.Get("cursor")
+	trashed, _ := strconv.ParseBool(query.Get("trash"))
+
+	tags := splitQueryList(strTags)
+	excludedTags := splitQueryList(strExcludedTags)
+	readingStatus := splitQueryList(strStatus)
+
+	orderMethod, ok := orderMethods[strOrder]
+	if !ok {
+		panic(fmt.Errorf("unknown order %s", strOrder))
+	}
+
+	// Reading state belongs to the account of bookmark, it's neither filtered nor ordered by for public
+	if public {
+		if orderMethod == database.ByUnread {
+			panic(fmt.Errorf("unknown order %s", strOrder))
+		}
+
+		trashed = false
+		readingStatus = nil
+		search.Groups = append(search.Groups, []database.SearchTerm{{Field: database.SearchIs, Value: "public"}})
+	}
+
+	limit, _ := strconv.Atoi(strLimit)
+	if limit < 1 || limit > 100 {
+		limit = 30
+	}
+
+	// Parse search query, has:archive needs to know which bookmarks have archive
+	querySearch, err := database.ParseSearch(strSearch)
+	CheckError(err)
+	search.Groups = append(search.Groups, querySearch.Groups...)
+
+	var archiveIDs []int
+	if search.NeedsArchives() {
+		archiveIDs, err = database.ArchiveIDs(h.DataDir)
+		CheckError(err)
+	}
+
+	// Prepare filter for database
+	searchOptions := database.GetBookmarksOptions{
+		Tags:          tags,
+		ExcludedTags:  excludedTags,
+		Keyword:       keyword,
+		OrderMethod:   orderMethod,
+		Limit:         limit,
+		Cursor:        cursor,
+		Trashed:       trashed,
+		Search:        search,
+		ArchiveIDs:    archiveIDs,
+		ReadingStatus: readingStatus,
+		AccountID:     accountID,
+
+		// Notes and highlights belong to the account of bookmark as well
+		WithoutAnnotations: public,
+	}
+
+	// Get list of bookmarks
+	bookmarks, err := h.DB.GetBookMarks(ctx, searchOptions)
+	CheckError(err)
+
+	// Get image URL for each bookmark, and check if it has archive
+	for i := range bookmarks {
+		strID := strconv.Itoa(bookmarks[i].ID)
+		imgPath := fp.Join(h.DataDir, "thumb", strID)
+		archivePath := fp.Join(h.DataDir, "archive", strID)
+
+		if fileExists(imgPath) {
+			bookmarks[i].ImageURL = path.Join(h.RootPath, "bookmark", strID, "thumb")
+		}
+
+		if fileExists(archivePath) {
+			bookmarks[i].HasArchive = true
+		}
+	}
+
+	// Create links to the next and previous page
+	nextCursor, prevCursor, err := database.BookmarkCursors(searchOptions, bookmarks)
+	CheckError(err)
+
+	if public {
+		for i := range bookmarks {
+			bookmarks[i] = publicBookmark(bookmarks[i])
+		}
+	}
+
+	pageLink := func(cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+
+		pageQuery := r.URL.Query()
+		pageQuery.Set("cursor", cursor)
+		return r.URL.Path + "?" + pageQuery.Encode()
+	}
+
+	return bookmarkList{
+		Bookmarks: bookmarks,
+		Next:      pageLink(nextCursor),
+		Prev:      pageLink(prevCursor),
+	}
+}
+
+// publicBookmark removes what only the account of bookmark should see.
+func publicBookmark(book model.Bookmark) model.Bookmark {
+	book.AccountID = 0
+	book.Notes = ""
+	book.ReadingStatus = ""
+	book.ReadingProgress = 0
+	return book
+}
+
+// apiGetPublicBookmarks is handler for GET /api/public/bookmarks.
+// It accepts the same URL queries as GET /api/bookmarks except trash, no session is required.
+func (h *handler) apiGetPublicBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	list := h.listBookmarks(r, database.SearchQuery{}, 0, true)
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(&list)
+	CheckError(err)
+}
+
+// apiGetPublicTags is handler for GET /api/public/tags.
+// It lists the tags of public bookmarks with their number, no session is required.
+func (h *handler) apiGetPublicTags(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	tags := h.getPublicTags(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(&tags)
+	CheckError(err)
+}
+
+// getPublicTags returns the tags of public bookmarks outside of trash, see database.CountTags.
+func (h *handler) getPublicTags(ctx context.Context) []model.Tag {
+	bookmarks, err := h.DB.GetBookMarks(ctx, database.GetBookmarksOptions{
+		Search: database.SearchQuery{Groups: [][]database.SearchTerm{{{Field: database.SearchIs, Value: "public"}}}},
+	})
+	CheckError(err)
+
+	return database.CountTags(bookmarks)
+}
+
+// apiDeleteBookmarks is handler for DELETE /api/bookmarks.
+// The bookmarks are moved to trash, unless ?permanent=true is used.
+func (h *handler) apiDeleteBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	ids := []int{}
+	err = json.NewDecoder(r.Body).Decode(&ids)
+	CheckError(err)
+
+	// Only the bookmarks of library can be removed
+	ids, ok := h.scopeBookmarkIDs(ctx, libraryID, ids)
+	if !ok {
+		fmt.Fprint(w, 1)
+		return
+	}
+
+	// Move bookmarks to trash, where they can be restored later
+	if permanent, _ := strconv.ParseBool(r.URL.Query().Get("permanent")); !permanent {
+		err = h.DB.TrashBookmarks(ctx, ids...)
+		CheckError(err)
+
+		fmt.Fprint(w, 1)
+		return
+	}
+
+	// Delete bookmarks, together with their thumbnail image and archive
+	err = h.DB.DeleteBookmarks(ctx, ids...)
+	CheckError(err)
+
+	fmt.Fprint(w, 1)
+}
+
+// apiRestoreBookmarks is handler for POST /api/bookmarks/restore
+func (h *handler) apiRestoreBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	ids := []int{}
+	err = json.NewDecoder(r.Body).Decode(&ids)
+	CheckError(err)
+
+	// Only the bookmarks of library can be restored
+	ids, ok := h.scopeBookmarkIDs(ctx, libraryID, ids)
+	if !ok {
+		fmt.Fprint(w, 1)
+		return
+	}
+
+	// Restore bookmarks from trash
+	err = h.DB.RestoreBookmarks(ctx, ids...)
+	CheckError(err)
+
+	fmt.Fprint(w, 1)
+}
+
+// apiGetRevisions is handler for GET /api/revisions
+func (h *handler) apiGetRevisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Get bookmark ID from URL query
+	strID := r.URL.Query().Get("bookmark")
+	bookmarkID, err := strconv.Atoi(strID)
+	if err != nil || bookmarkID < 1 {
+		panic(fmt.Errorf("invalid bookmark ID %q", strID))
+	}
+
+	// Fetch revisions of the bookmark
+	h.checkBookmarkAccess(ctx, libraryID, bookmarkID)
+	revisions, err := h.DB.GetBookmarkRevisions(ctx, bookmarkID)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&revisions)
+	CheckError(err)
+}
+
+// apiDiffRevisions is handler for GET /api/revisions/diff
+func (h *handler) apiDiffRevisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Get revision IDs from URL query. Without "to",
+	// the revision is compared with the current bookmark.
+	query := r.URL.Query()
+	fromID, err := strconv.Atoi(query.Get("from"))
+	if err != nil || fromID < 1 {
+		panic(fmt.Errorf("invalid revision ID %q", query.Get("from")))
+	}
+
+	toID := 0
+	if strTo := query.Get("to"); strTo != "" {
+		toID, err = strconv.Atoi(strTo)
+		if err != nil || toID < 1 {
+			panic(fmt.Errorf("invalid revision ID %q", strTo))
+		}
+	}
+
+	// Compare both revisions of the bookmark in library
+	for _, id := range []int{fromID, toID} {
+		h.checkRevisionAccess(ctx, libraryID, id)
+	}
+
+	diffs, err := database.DiffBookmarkRevisions(ctx, h.DB, fromID, toID)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&diffs)
+	CheckError(err)
+}
+
+// apiRollbackRevision is handler for POST /api/revisions/rollback
+func (h *handler) apiRollbackRevision(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	request := struct {
+		ID int `json:"id"`
+	}{}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	CheckError(err)
+
+	// Restore bookmark to the revision
+	h.checkRevisionAccess(ctx, libraryID, request.ID)
+	book, err := h.DB.RollbackBookmark(ctx, request.ID)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&book)
+	CheckError(err)
+}
+
+// apiSaveBookmarkNotes is handler for PUT /api/bookmarks/notes
+func (h *handler) apiSaveBookmarkNotes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	request := struct {
+		ID    int    `json:"id"`
+		Notes string `json:"notes"`
+	}{}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	CheckError(err)
+
+	// Replace the Markdown notes of bookmark
+	h.checkBookmarkAccess(ctx, libraryID, request.ID)
+	err = h.DB.SaveBookmarkNotes(ctx, request.ID, request.Notes)
+	CheckError(err)
+
+	fmt.Fprint(w, 1)
+}
+
+// apiSaveReadingProgress is handler for PUT /api/bookmarks/progress
+func (h *handler) apiSaveReadingProgress(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	request := struct {
+		ID       int    `json:"id"`
+		Progress int    `json:"progress"`
+		Status   string `json:"status"`
+	}{}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	CheckError(err)
+
+	h.checkBookmarkAccess(ctx, libraryID, request.ID)
+
+	// Without status, it follows the scroll position: the bookmark is read once
+	// scrolled to the end and in progress before that. Read bookmark stays read.
+	status := request.Status
+	if status == "" {
+		bookmarks, err := h.DB.GetBookMarks(ctx, database.GetBookmarksOptions{IDs: []int{request.ID}})
+		CheckError(err)
+
+		current := model.StatusUnread
+		if len(bookmarks) > 0 {
+			current = bookmarks[0].ReadingStatus
+		}
+
+		switch {
+		case request.Progress >= 100, current == model.StatusRead:
+			status = model.StatusRead
+		case request.Progress > 0:
+			status = model.StatusInProgress
+		default:
+			status = current
+		}
+	}
+
+	// Unread bookmark starts from the top
+	progress := request.Progress
+	if status == model.StatusUnread {
+		progress = 0
+	}
+
+	err = h.DB.SaveReadingState(ctx, request.ID, status, progress)
+	CheckError(err)
+
+	fmt.Fprint(w, 1)
+}
+
+// apiGetHighlights is handler for GET /api/highlights
+func (h *handler) apiGetHighlights(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Get bookmark ID from URL query
+	strID := r.URL.Query().Get("bookmark")
+	bookmarkID, err := strconv.Atoi(strID)
+	if err != nil || bookmarkID < 1 {
+		panic(fmt.Errorf("invalid bookmark ID %q", strID))
+	}
+
+	// Fetch highlights of the bookmark
+	h.checkBookmarkAccess(ctx, libraryID, bookmarkID)
+	highlights, err := h.DB.GetHighlights(ctx, bookmarkID)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&highlights)
+	CheckError(err)
+}
+
+// apiInsertHighlight is handler for POST /api/highlights
+func (h *handler) apiInsertHighlight(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	highlight := model.Highlight{}
+	err = json.NewDecoder(r.Body).Decode(&highlight)
+	CheckError(err)
+
+	// Save highlight, its created time is set by database
+	h.checkBookmarkAccess(ctx, libraryID, highlight.BookmarkID)
+	highlight.ID = 0
+	highlight.Created = ""
+	highlight, err = h.DB.SaveHighlight(ctx, highlight)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&highlight)
+	CheckError(err)
+}
+
+// apiUpdateHighlight is handler for PUT /api/highlights
+func (h *handler) apiUpdateHighlight(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	highlight := model.Highlight{}
+	err = json.NewDecoder(r.Body).Decode(&highlight)
+	CheckError(err)
+
+	if highlight.ID == 0 {
+		panic(fmt.Errorf("id of highlight is required"))
+	}
+
+	h.checkHighlightAccess(ctx, libraryID, highlight.ID)
+	highlight, err = h.DB.SaveHighlight(ctx, highlight)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&highlight)
+	CheckError(err)
+}
+
+// apiDeleteHighlights is handler for DELETE /api/highlights
+func (h *handler) apiDeleteHighlights(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	ids := []int{}
+	err = json.NewDecoder(r.Body).Decode(&ids)
+	CheckError(err)
+
+	for _, id := range ids {
+		h.checkHighlightAccess(ctx, libraryID, id)
+	}
+
+	err = h.DB.DeleteHighlights(ctx, ids...)
+	CheckError(err)
+
+	fmt.Fprint(w, 1)
+}
+
+// apiGetTags is handler for GET /api/tags
+func (h *handler) apiGetTags(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Fetch tags of the library, nested tags are returned as tree
+	tags, err := h.DB.GetTags(ctx, libraryID)
+	CheckError(err)
+
+	tree := database.TagTree(tags)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&tree)
+	CheckError(err)
+}
+
+// apiRenameTag is handler for PUT /api/tags
+func (h *handler) apiRenameTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	libraryID, err := h.validateSession(r)
+	CheckError(err)
+
+	// Decode request
+	tag := model.Tag{}
+	err = json.NewDecoder(r.Body).Decode(&tag)
+	CheckError(err)
+
+	// Update name, it's merged when the tag of library already has the name
+	h.checkTagAccess(ctx, libraryID, tag.ID)
+	tag, err = h.DB.RenameTag(ctx, tag.ID, tag.Name)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&tag)
+	CheckError(err)
+}
+
+// splitQueryList splits comma separated values of URL query.
+func splitQueryList(s string) []string {
+	result := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// apiGetAccounts is handler for GET /api/accounts
+func (h *handler) apiGetAccounts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid and it's owner
+	err := h.validateOwnerSession(r)
+	CheckError(err)
+
+	// Get list of accounts from database
+	searchOptions := database.GetAccountsOptions{
+		Keyword: r.URL.Query().Get("keyword"),
+	}
+
+	accounts, err := h.DB.GetAccounts(ctx, searchOptions)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&accounts)
+	CheckError(err)
+}
+
+// apiInsertAccount is handler for POST /api/accounts
+func (h *handler) apiInsertAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid and it's owner
+	err := h.validateOwnerSession(r)
+	CheckError(err)
+
+	// Decode request
+	var account model.Account
+	err = json.NewDecoder(r.Body).Decode(&account)
+	CheckError(err)
+
+	// Save account to database
+	account, err = h.DB.SaveAccount(ctx, account)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&account)
+	CheckError(err)
+}
+
+// apiUpdateAccount is handler for PUT /api/accounts
+func (h *handler) apiUpdateAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid and it's owner
+	err := h.validateOwnerSession(r)
+	CheckError(err)
+
+	// Decode request, owner is only changed when it's sent
+	request := struct {
+		Username    string `json:"username"`
+		NewUsername string `json:"newUsername"`
+		NewPassword string `json:"newPassword"`
+		Owner       *bool  `json:"owner"`
+	}{}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	CheckError(err)
+
+	// Update the existing account, so nothing else changes it in between
+	err = h.DB.WithTx(ctx, func(tx database.DB) error {
+		account, exist, err := tx.GetAccount(ctx, request.Username)
+		if err != nil {
+			return err
+		}
+
+		if !exist {
+			return fmt.Errorf("username doesn't exist")
+		}
+
+		if request.Owner != nil {
+			if account.Owner && !*request.Owner {
+				if err := checkOwnersLeft(ctx, tx, account.Username); err != nil {
+					return err
+				}
+			}
+			account.Owner = *request.Owner
+		}
+
+		if request.NewUsername != "" {
+			account.Username = request.NewUsername
+		}
+		account.Password = request.NewPassword
+
+		return tx.UpdateAccount(ctx, account)
+	})
+	CheckError(err)
+
+	// Delete user's sessions
+	h.deleteUserSessions(request.Username)
+
+	fmt.Fprint(w, 1)
+}
+
+// checkOwnersLeft makes sure there is still an owner account after the accounts
+// of usernames are deleted or aren't owner anymore. Without any owner, everyone
+// could log in as the default admin again.
+func checkOwnersLeft(ctx context.Context, db database.DB, usernames ...string) error {
+	owners, err := db.GetAccounts(ctx, database.GetAccountsOptions{Owner: true})
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, username := range usernames {
+		removed[username] = true
+	}
+
+	for _, owner := range owners {
+		if !removed[owner.Username] {
+			return nil
+		}
+	}
+
+	if len(owners) > 0 {
+		return fmt.Errorf("the last owner account can't be removed")
+	}
+
+	return nil
+}
+
+// apiDeleteAccount is handler for DELETE /api/accounts
+func (h *handler) apiDeleteAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid and it's owner
+	err := h.validateOwnerSession(r)
+	CheckError(err)
+
+	// Decode request
+	usernames := []string{}
+	err = json.NewDecoder(r.Body).Decode(&usernames)
+	CheckError(err)
+
+	// Delete accounts
+	err = h.DB.WithTx(ctx, func(tx database.DB) error {
+		if err := checkOwnersLeft(ctx, tx, usernames...); err != nil {
+			return err
+		}
+
+		return tx.DeleteAccounts(ctx, usernames...)
+	})
+	CheckError(err)
+
+	// Delete user's sessions
+	for _, username := range usernames {
+		h.deleteUserSessions(username)
+	}
+
+	fmt.Fprint(w, 1)
+}
+
+// getSavedSearchAccount returns the account of user session for managing its
+// saved searches. Every account can manage its own searches, but the default
+// admin isn't stored in database, so it can't have any.
+func (h *handler) getSavedSearchAccount(r *http.Request) model.Account {
+	account, err := h.getSessionAccount(r)
+	CheckError(err)
+
+	if account.ID == 0 {
+		panic(fmt.Errorf("default admin can't save searches, create an account first"))
+	}
+
+	return account
+}
+
+// apiGetSavedSearches is handler for GET /api/searches.
+// With count=true, the number of bookmarks of each search is included.
+func (h *handler) apiGetSavedSearches(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	account, err := h.getSessionAccount(r)
+	CheckError(err)
+
+	searches, err := h.DB.GetSavedSearches(ctx, account.ID)
+	CheckError(err)
+
+	// Count the bookmarks of each search for the badge
+	withCount, _ := strconv.ParseBool(r.URL.Query().Get("count"))
+	if withCount {
+		var archiveIDs []int
+		for i := range searches {
+			search, err := database.ParseSearch(searches[i].Query)
+			CheckError(err)
+
+			if search.NeedsArchives() && archiveIDs == nil {
+				archiveIDs, err = database.ArchiveIDs(h.DataDir)
+				CheckError(err)
+			}
+
+			searches[i].NBookmarks, err = h.DB.GetBookmarksCount(ctx, database.GetBookmarksOptions{
+				Search:     search,
+				ArchiveIDs: archiveIDs,
+				AccountID:  accountLibraryID(account),
+			})
+			CheckError(err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&searches)
+	CheckError(err)
+}
+
+// apiInsertSavedSearch is handler for POST /api/searches
+func (h *handler) apiInsertSavedSearch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	account := h.getSavedSearchAccount(r)
+
+	// Decode request
+	search := model.SavedSearch{}
+	err := json.NewDecoder(r.Body).Decode(&search)
+	CheckError(err)
+
+	// Save search for the account of session
+	search.ID = 0
+	search.AccountID = account.ID
+	search, err = h.DB.SaveSavedSearch(ctx, search)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&search)
+	CheckError(err)
+}
+
+// apiUpdateSavedSearch is handler for PUT /api/searches
+func (h *handler) apiUpdateSavedSearch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	account := h.getSavedSearchAccount(r)
+
+	// Decode request
+	search := model.SavedSearch{}
+	err := json.NewDecoder(r.Body).Decode(&search)
+	CheckError(err)
+
+	if search.ID == 0 {
+		panic(fmt.Errorf("id of saved search is required"))
+	}
+
+	// Only the searches of the account can be updated
+	search.AccountID = account.ID
+	search, err = h.DB.SaveSavedSearch(ctx, search)
+	CheckError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&search)
+	CheckError(err)
+}
+
+// apiDeleteSavedSearches is handler for DELETE /api/searches
+func (h *handler) apiDeleteSavedSearches(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	account := h.getSavedSearchAccount(r)
+
+	// Decode request
+	ids := []int{}
+	err := json.NewDecoder(r.Body).Decode(&ids)
+	CheckError(err)
+
+	err = h.DB.DeleteSavedSearches(ctx, account.ID, ids...)
+	CheckError(err)
+
+	fmt.Fprint(w, 1)
+}
+
+// apiGetSavedSearchBookmarks is handler for GET /api/searches/:id/bookmarks.
+// It accepts the same URL queries as GET /api/bookmarks, which narrow down the saved search.
+func (h *handler) apiGetSavedSearchBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	// Make sure session still valid
+	account, err := h.getSessionAccount(r)
+	CheckError(err)
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	CheckError(err)
+
+	savedSearch, exist, err := h.DB.GetSavedSearch(ctx, account.ID, id)
+	CheckError(err)
+
+	if !exist {
+		panic(fmt.Errorf("saved search doesn't exist"))
+	}
+
+	search, err := database.ParseSearch(savedSearch.Query)
+	CheckError(err)
+
+	h.serveBookmarks(w, r, accountLibraryID(account), search)
+}
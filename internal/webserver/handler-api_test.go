@@ -0,0 +1,932 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	fp "path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/new-aspect/shiori-practice/internal/model"
+	cch "github.com/patrickmn/go-cache"
+)
+
+// newTestHandler creates handler backed by an in-memory database.
+func newTestHandler(t *testing.T) *handler {
+	dataDir := t.TempDir()
+	db := database.NewMemoryDatabase()
+	db.SetDataDir(dataDir)
+
+	return &handler{
+		DB:           db,
+		DataDir:      dataDir,
+		UserCache:    cch.New(time.Hour, 10*time.Minute),
+		SessionCache: cch.New(time.Hour, 10*time.Minute),
+		ArchiveCache: cch.New(time.Minute, 5*time.Minute),
+	}
+}
+
+// serveTest calls the handler with the request. A panic is turned into
+// status 500, the same as the PanicHandler of the router.
+func serveTest(h httprouter.Handle, method, target, sessionID, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if sessionID != "" {
+		r.Header.Set("X-Session-Id", sessionID)
+	}
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if arg := recover(); arg != nil {
+				http.Error(w, fmt.Sprint(arg), http.StatusInternalServerError)
+			}
+		}()
+		h(w, r, nil)
+	}()
+
+	return w
+}
+
+// login logs in with the account and returns the session ID.
+func login(t *testing.T, h *handler, username, password string) string {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"username":%q,"password":%q}`, username, password)
+	w := serveTest(h.apiLogin, http.MethodPost, "/api/login", "", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to login as %s: %d %s", username, w.Code, w.Body)
+	}
+
+	result := struct {
+		Session string        `json:"session"`
+		Account model.Account `json:"account"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Session == "" || result.Account.Username != username {
+		t.Fatalf("unexpected login result %s", w.Body)
+	}
+
+	return result.Session
+}
+
+func TestAPILogin(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.TODO()
+
+	// Default account works while there are no owners
+	login(t, h, "admin", "admin")
+
+	_, err := h.DB.SaveAccount(ctx, model.Account{Username: "alice", Password: "secret", Owner: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login(t, h, "alice", "secret")
+
+	for _, body := range []string{
+		`{"username":"admin","password":"admin"}`,
+		`{"username":"alice","password":"wrong"}`,
+		`{"username":"bob","password":"secret"}`,
+	} {
+		if w := serveTest(h.apiLogin, http.MethodPost, "/api/login", "", body); w.Code != http.StatusInternalServerError {
+			t.Errorf("login with %s should fail, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestAPISessionRequired(t *testing.T) {
+	h := newTestHandler(t)
+
+	for name, handle := range map[string]httprouter.Handle{
+		"bookmarks": h.apiGetBookmarks,
+		"tags":      h.apiGetTags,
+		"accounts":  h.apiGetAccounts,
+	} {
+		if w := serveTest(handle, http.MethodGet, "/api/"+name, "", ""); w.Code != http.StatusInternalServerError {
+			t.Errorf("%s without session should fail, got %d", name, w.Code)
+		}
+		if w := serveTest(handle, http.MethodGet, "/api/"+name, "expired", ""); w.Code != http.StatusInternalServerError {
+			t.Errorf("%s with unknown session should fail, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestAPIGetBookmarks(t *testing.T) {
+	h := newTestHandler(t)
+	session := login(t, h, "admin", "admin")
+
+	_, err := h.DB.SaveBookmarks(context.TODO(), true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go", Tags: []model.Tag{{Name: "dev/go"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "Rust", Tags: []model.Tag{{Name: "dev/rust"}}},
+		model.Bookmark{URL: "https://news.ycombinator.com", Title: "Hacker News", Tags: []model.Tag{{Name: "news"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getBookmarks := func(query string) (titles []string, next string) {
+		t.Helper()
+
+		w := serveTest(h.apiGetBookmarks, http.MethodGet, "/api/bookmarks?"+query, session, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", query, w.Code, w.Body)
+		}
+
+		resp := struct {
+			Bookmarks []model.Bookmark `json:"bookmarks"`
+			Next      string           `json:"next"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, book := range resp.Bookmarks {
+			titles = append(titles, book.Title)
+		}
+		return titles, resp.Next
+	}
+
+	tests := map[string]string{
+		"":                           "Hacker News,Rust,Go",
+		"order=title":                "Go,Hacker News,Rust",
+		"tags=dev":                   "Rust,Go",
+		"tags=dev&exclude=dev/go":    "Rust",
+		"keyword=news":               "Hacker News",
+		"q=go+OR+news":               "Hacker News,Go",
+		"q=tag%3Adev+-site%3Ago.dev": "Rust",
+		"q=has%3Aarchive":            "Rust",
+	}
+
+	// has:archive is answered from the archives in data dir
+	if err := os.MkdirAll(fp.Join(h.DataDir, "archive"), model.DataDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp.Join(h.DataDir, "archive", "2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, expected := range tests {
+		if titles, _ := getBookmarks(query); strings.Join(titles, ",") != expected {
+			t.Errorf("GET %q returns %v, expected %s", query, titles, expected)
+		}
+	}
+
+	// Follow the next link through every page
+	titles, next := getBookmarks("order=title&limit=2")
+	if strings.Join(titles, ",") != "Go,Hacker News" || next == "" {
+		t.Fatalf("unexpected first page %v, next %q", titles, next)
+	}
+
+	titles, next = getBookmarks(next[strings.Index(next, "?")+1:])
+	if strings.Join(titles, ",") != "Rust" || next != "" {
+		t.Fatalf("unexpected last page %v, next %q", titles, next)
+	}
+
+	// Relevance has next link as well, every bookmark is on one of the pages
+	first, next := getBookmarks("order=relevance&q=go+OR+rust+OR+news&limit=2")
+	if len(first) != 2 || next == "" {
+		t.Fatalf("unexpected first page by relevance %v, next %q", first, next)
+	}
+
+	titles, next = getBookmarks(next[strings.Index(next, "?")+1:])
+	all := append(first, titles...)
+	sort.Strings(all)
+	if strings.Join(all, ",") != "Go,Hacker News,Rust" || next != "" {
+		t.Fatalf("unexpected pages by relevance %v then %v, next %q", first, titles, next)
+	}
+
+	if w := serveTest(h.apiGetBookmarks, http.MethodGet, "/api/bookmarks?order=random", session, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("unknown order should fail, got %d", w.Code)
+	}
+
+	w := serveTest(h.apiGetBookmarks, http.MethodGet, "/api/bookmarks?q=tag%3A", session, "")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "position 5") {
+		t.Errorf("malformed search should fail with its position, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAPITrashBookmarks(t *testing.T) {
+	h := newTestHandler(t)
+	session := login(t, h, "admin", "admin")
+
+	books, err := h.DB.SaveBookmarks(context.TODO(), true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go"},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "Rust"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countBookmarks := func(trashed bool) int {
+		t.Helper()
+
+		bookmarks, err := h.DB.GetBookMarks(context.TODO(), database.GetBookmarksOptions{Trashed: trashed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(bookmarks)
+	}
+
+	body := fmt.Sprintf("[%d]", books[0].ID)
+	if w := serveTest(h.apiDeleteBookmarks, http.MethodDelete, "/api/bookmarks", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to trash bookmark: %d %s", w.Code, w.Body)
+	}
+	if countBookmarks(false) != 1 || countBookmarks(true) != 1 {
+		t.Fatal("bookmark is not moved to trash")
+	}
+
+	if w := serveTest(h.apiRestoreBookmarks, http.MethodPost, "/api/bookmarks/restore", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to restore bookmark: %d %s", w.Code, w.Body)
+	}
+	if countBookmarks(false) != 2 || countBookmarks(true) != 0 {
+		t.Fatal("bookmark is not restored")
+	}
+
+	if w := serveTest(h.apiDeleteBookmarks, http.MethodDelete, "/api/bookmarks?permanent=true", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to delete bookmark: %d %s", w.Code, w.Body)
+	}
+	if countBookmarks(false) != 1 || countBookmarks(true) != 0 {
+		t.Fatal("bookmark is not deleted")
+	}
+}
+
+func TestAPITags(t *testing.T) {
+	h := newTestHandler(t)
+	session := login(t, h, "admin", "admin")
+
+	_, err := h.DB.SaveBookmarks(context.TODO(), true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go", Tags: []model.Tag{{Name: "dev/go"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveTest(h.apiGetTags, http.MethodGet, "/api/tags", session, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to get tags: %d %s", w.Code, w.Body)
+	}
+
+	tree := []model.Tag{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 1 || tree[0].Name != "dev" || len(tree[0].Children) != 1 || tree[0].Children[0].Name != "dev/go" {
+		t.Fatalf("unexpected tag tree %s", w.Body)
+	}
+
+	body := fmt.Sprintf(`{"id":%d,"name":"lang"}`, tree[0].ID)
+	if w := serveTest(h.apiRenameTag, http.MethodPut, "/api/tags", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to rename tag: %d %s", w.Code, w.Body)
+	}
+
+	tags, err := h.DB.GetTags(context.TODO(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "lang" || tags[1].Name != "lang/go" {
+		t.Fatalf("unexpected tags after rename %+v", tags)
+	}
+}
+
+func TestAPINotesAndHighlights(t *testing.T) {
+	h := newTestHandler(t)
+	session := login(t, h, "admin", "admin")
+
+	saved, err := h.DB.SaveBookmarks(context.TODO(), true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go", Content: "build simple secure scalable systems"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := saved[0]
+
+	body := fmt.Sprintf(`{"id":%d,"notes":"Read *again*"}`, book.ID)
+	if w := serveTest(h.apiSaveBookmarkNotes, http.MethodPut, "/api/bookmarks/notes", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to save notes: %d %s", w.Code, w.Body)
+	}
+
+	body = fmt.Sprintf(`{"bookmarkId":%d,"quote":"simple","prefix":"build ","suffix":" secure",`+
+		`"startOffset":6,"endOffset":12,"comment":"compared to what?"}`, book.ID)
+	w := serveTest(h.apiInsertHighlight, http.MethodPost, "/api/highlights", session, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to save highlight: %d %s", w.Code, w.Body)
+	}
+
+	highlight := model.Highlight{}
+	if err := json.Unmarshal(w.Body.Bytes(), &highlight); err != nil {
+		t.Fatal(err)
+	}
+
+	body = fmt.Sprintf(`{"id":%d,"quote":"simple","startOffset":6,"endOffset":12,"comment":"simpler than before"}`, highlight.ID)
+	if w := serveTest(h.apiUpdateHighlight, http.MethodPut, "/api/highlights", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to update highlight: %d %s", w.Code, w.Body)
+	}
+
+	w = serveTest(h.apiGetHighlights, http.MethodGet, fmt.Sprintf("/api/highlights?bookmark=%d", book.ID), session, "")
+	highlights := []model.Highlight{}
+	if err := json.Unmarshal(w.Body.Bytes(), &highlights); err != nil {
+		t.Fatalf("failed to get highlights: %v %s", err, w.Body)
+	}
+	if len(highlights) != 1 || highlights[0].Comment != "simpler than before" || highlights[0].BookmarkID != book.ID {
+		t.Errorf("unexpected highlights %s", w.Body)
+	}
+
+	// Notes and highlights are searched, and notes are returned with the bookmark
+	for _, query := range []string{"again", "simpler"} {
+		w = serveTest(h.apiGetBookmarks, http.MethodGet, "/api/bookmarks?q="+query, session, "")
+		resp := struct {
+			Bookmarks []model.Bookmark `json:"bookmarks"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Bookmarks) != 1 || resp.Bookmarks[0].Notes != "Read *again*" {
+			t.Errorf("unexpected bookmarks for %q %s", query, w.Body)
+		}
+	}
+
+	body = fmt.Sprintf("[%d]", highlight.ID)
+	if w := serveTest(h.apiDeleteHighlights, http.MethodDelete, "/api/highlights", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to delete highlight: %d %s", w.Code, w.Body)
+	}
+
+	if highlights, _ := h.DB.GetHighlights(context.TODO(), book.ID); len(highlights) != 0 {
+		t.Errorf("unexpected highlights after delete %+v", highlights)
+	}
+
+	// Highlight needs an existing bookmark
+	body = `{"bookmarkId":100,"quote":"missing","startOffset":0,"endOffset":7}`
+	if w := serveTest(h.apiInsertHighlight, http.MethodPost, "/api/highlights", session, body); w.Code != http.StatusInternalServerError {
+		t.Errorf("highlight of missing bookmark shouldn't be saved, got %d", w.Code)
+	}
+}
+
+func TestAPIReadingProgress(t *testing.T) {
+	h := newTestHandler(t)
+	session := login(t, h, "admin", "admin")
+
+	saved, err := h.DB.SaveBookmarks(context.TODO(), true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go"},
+		model.Bookmark{URL: "https://example.com", Title: "Example"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := saved[0]
+
+	getBookmarks := func(query string) []model.Bookmark {
+		w := serveTest(h.apiGetBookmarks, http.MethodGet, "/api/bookmarks?"+query, session, "")
+		resp := struct {
+			Bookmarks []model.Bookmark `json:"bookmarks"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to get bookmarks: %v %s", err, w.Body)
+		}
+		return resp.Bookmarks
+	}
+
+	// The status follows the scroll position until the end is reached
+	for _, step := range []struct {
+		progress int
+		status   string
+	}{
+		{0, model.StatusUnread},
+		{35, model.StatusInProgress},
+		{100, model.StatusRead},
+		{10, model.StatusRead},
+	} {
+		body := fmt.Sprintf(`{"id":%d,"progress":%d}`, book.ID, step.progress)
+		if w := serveTest(h.apiSaveReadingProgress, http.MethodPut, "/api/bookmarks/progress", session, body); w.Code != http.StatusOK {
+			t.Fatalf("failed to save progress: %d %s", w.Code, w.Body)
+		}
+
+		found := false
+		for _, b := range getBookmarks("status=" + step.status) {
+			found = found || (b.ID == book.ID && b.ReadingProgress == step.progress)
+		}
+		if !found {
+			t.Errorf("bookmark isn't %s after progress %d", step.status, step.progress)
+		}
+	}
+
+	// Marking as unread starts from the top, and unread bookmarks come first
+	body := fmt.Sprintf(`{"id":%d,"progress":60,"status":"unread"}`, saved[1].ID)
+	if w := serveTest(h.apiSaveReadingProgress, http.MethodPut, "/api/bookmarks/progress", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to mark as unread: %d %s", w.Code, w.Body)
+	}
+
+	books := getBookmarks("order=unread")
+	if len(books) != 2 || books[0].ID != saved[1].ID || books[0].ReadingProgress != 0 || books[1].ID != book.ID {
+		t.Errorf("unexpected unread order %+v", books)
+	}
+
+	body = fmt.Sprintf(`{"id":%d,"progress":50,"status":"skimmed"}`, book.ID)
+	if w := serveTest(h.apiSaveReadingProgress, http.MethodPut, "/api/bookmarks/progress", session, body); w.Code != http.StatusInternalServerError {
+		t.Errorf("unknown status shouldn't be saved, got %d", w.Code)
+	}
+}
+
+func TestAPIAccounts(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.TODO()
+
+	ownerSession := login(t, h, "admin", "admin")
+
+	body := `{"username":"alice","password":"secret","owner":true}`
+	if w := serveTest(h.apiInsertAccount, http.MethodPost, "/api/accounts", ownerSession, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to insert account: %d %s", w.Code, w.Body)
+	}
+
+	_, err := h.DB.SaveAccount(ctx, model.Account{Username: "bob", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Visitors can't manage accounts, not even read them
+	visitorSession := login(t, h, "bob", "secret")
+	if w := serveTest(h.apiGetAccounts, http.MethodGet, "/api/accounts", visitorSession, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("visitor should not list accounts, got %d", w.Code)
+	}
+
+	ownerSession = login(t, h, "alice", "secret")
+	w := serveTest(h.apiGetAccounts, http.MethodGet, "/api/accounts", ownerSession, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to get accounts: %d %s", w.Code, w.Body)
+	}
+
+	accounts := []model.Account{}
+	if err := json.Unmarshal(w.Body.Bytes(), &accounts); err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Username != "alice" || accounts[1].Username != "bob" || accounts[0].Password != "" {
+		t.Fatalf("unexpected accounts %s", w.Body)
+	}
+
+	// Updating an account logs it out
+	body = `{"username":"bob","newPassword":"changed"}`
+	if w := serveTest(h.apiUpdateAccount, http.MethodPut, "/api/accounts", ownerSession, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to update account: %d %s", w.Code, w.Body)
+	}
+	if _, found := h.SessionCache.Get(visitorSession); found {
+		t.Error("session of updated account is still valid")
+	}
+	login(t, h, "bob", "changed")
+
+	if w := serveTest(h.apiDeleteAccount, http.MethodDelete, "/api/accounts", ownerSession, `["bob"]`); w.Code != http.StatusOK {
+		t.Fatalf("failed to delete account: %d %s", w.Code, w.Body)
+	}
+	if _, exist, _ := h.DB.GetAccount(ctx, "bob"); exist {
+		t.Error("account is not deleted")
+	}
+
+	// The last owner can't be demoted or deleted, or the default admin works again
+	body = `{"username":"alice","owner":false}`
+	if w := serveTest(h.apiUpdateAccount, http.MethodPut, "/api/accounts", ownerSession, body); w.Code != http.StatusInternalServerError {
+		t.Errorf("last owner shouldn't be demoted, got %d", w.Code)
+	}
+	if w := serveTest(h.apiDeleteAccount, http.MethodDelete, "/api/accounts", ownerSession, `["alice"]`); w.Code != http.StatusInternalServerError {
+		t.Errorf("last owner shouldn't be deleted, got %d", w.Code)
+	}
+	if account, exist, _ := h.DB.GetAccount(ctx, "alice"); !exist || !account.Owner {
+		t.Errorf("last owner is changed %+v", account)
+	}
+
+	// It's fine when another owner is left
+	_, err = h.DB.SaveAccount(ctx, model.Account{Username: "carol", Password: "secret", Owner: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing only the password keeps the owner
+	body = `{"username":"carol","newPassword":"changed"}`
+	if w := serveTest(h.apiUpdateAccount, http.MethodPut, "/api/accounts", ownerSession, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to update password of owner: %d %s", w.Code, w.Body)
+	}
+	if account, _, _ := h.DB.GetAccount(ctx, "carol"); !account.Owner {
+		t.Errorf("password update demoted the owner %+v", account)
+	}
+	login(t, h, "carol", "changed")
+
+	if w := serveTest(h.apiDeleteAccount, http.MethodDelete, "/api/accounts", ownerSession, `["alice"]`); w.Code != http.StatusOK {
+		t.Errorf("failed to delete owner: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAPIAccountLibraries(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.TODO()
+
+	accountIDs := map[string]int{}
+	for _, username := range []string{"alice", "bob"} {
+		account, err := h.DB.SaveAccount(ctx, model.Account{Username: username, Password: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		accountIDs[username] = account.ID
+	}
+
+	books, err := h.DB.SaveBookmarks(ctx, true,
+		model.Bookmark{AccountID: accountIDs["alice"], URL: "https://go.dev", Title: "Go", Tags: []model.Tag{{Name: "go"}}},
+		model.Bookmark{AccountID: accountIDs["bob"], URL: "https://go.dev", Title: "Go", Tags: []model.Tag{{Name: "lang"}}},
+		model.Bookmark{AccountID: accountIDs["bob"], URL: "https://www.rust-lang.org", Title: "Rust"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	highlight, err := h.DB.SaveHighlight(ctx, model.Highlight{BookmarkID: books[0].ID, Quote: "Go", EndOffset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getIDs := func(session string) []int {
+		t.Helper()
+
+		w := serveTest(h.apiGetBookmarks, http.MethodGet, "/api/bookmarks", session, "")
+		resp := struct {
+			Bookmarks []model.Bookmark `json:"bookmarks"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to get bookmarks: %v %s", err, w.Body)
+		}
+
+		ids := []int{}
+		for _, book := range resp.Bookmarks {
+			ids = append(ids, book.ID)
+		}
+		return ids
+	}
+
+	// Owners see the bookmarks of every account
+	owner := login(t, h, "admin", "admin")
+	if ids := getIDs(owner); len(ids) != 3 {
+		t.Errorf("owner should see every bookmark, got %v", ids)
+	}
+
+	// Other accounts only see their own bookmarks and tags
+	bob := login(t, h, "bob", "secret")
+	if ids := getIDs(bob); fmt.Sprint(ids) != fmt.Sprint([]int{books[2].ID, books[1].ID}) {
+		t.Errorf("unexpected bookmarks of bob %v", ids)
+	}
+
+	w := serveTest(h.apiGetTags, http.MethodGet, "/api/tags", bob, "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"go"`) || !strings.Contains(w.Body.String(), `"lang"`) {
+		t.Errorf("unexpected tags of bob %d %s", w.Code, w.Body)
+	}
+
+	// The bookmarks of another account can't be changed
+	aliceBook := fmt.Sprintf("[%d]", books[0].ID)
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"delete":    serveTest(h.apiDeleteBookmarks, http.MethodDelete, "/api/bookmarks", bob, aliceBook),
+		"notes":     serveTest(h.apiSaveBookmarkNotes, http.MethodPut, "/api/bookmarks/notes", bob, fmt.Sprintf(`{"id":%d,"notes":"mine"}`, books[0].ID)),
+		"progress":  serveTest(h.apiSaveReadingProgress, http.MethodPut, "/api/bookmarks/progress", bob, fmt.Sprintf(`{"id":%d,"progress":50}`, books[0].ID)),
+		"highlight": serveTest(h.apiDeleteHighlights, http.MethodDelete, "/api/highlights", bob, fmt.Sprintf("[%d]", highlight.ID)),
+		"tag":       serveTest(h.apiRenameTag, http.MethodPut, "/api/tags", bob, fmt.Sprintf(`{"id":%d,"name":"mine"}`, books[0].Tags[0].ID)),
+	} {
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s of another account should fail, got %d", name, w.Code)
+		}
+	}
+
+	// Trashing everything only trashes the own bookmarks
+	if w := serveTest(h.apiDeleteBookmarks, http.MethodDelete, "/api/bookmarks", bob, "[]"); w.Code != http.StatusOK {
+		t.Fatalf("failed to trash bookmarks: %d %s", w.Code, w.Body)
+	}
+
+	if ids := getIDs(owner); fmt.Sprint(ids) != fmt.Sprint([]int{books[0].ID}) {
+		t.Errorf("only the bookmarks of bob should be trashed, got %v", ids)
+	}
+}
+
+func TestAPINonOwnerWrites(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.TODO()
+
+	alice, err := h.DB.SaveAccount(ctx, model.Account{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DB.SaveAccount(ctx, model.Account{Username: "bob", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := h.DB.SaveBookmarks(ctx, true,
+		model.Bookmark{AccountID: alice.ID, URL: "https://go.dev", Title: "Go", Content: "Go is simple", Tags: []model.Tag{{Name: "go"}}},
+		model.Bookmark{AccountID: alice.ID, URL: "https://www.rust-lang.org", Title: "Rust"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := books[0]
+
+	// Alice has a revision, a highlight, a trashed bookmark and a saved search
+	book.Title = "Go 2"
+	if _, err := h.DB.SaveBookmarks(ctx, false, book); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := h.DB.GetBookmarkRevisions(ctx, book.ID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("unexpected revisions %+v %v", revisions, err)
+	}
+
+	highlight, err := h.DB.SaveHighlight(ctx, model.Highlight{BookmarkID: book.ID, Quote: "Go", EndOffset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.DB.TrashBookmarks(ctx, books[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := h.DB.SaveSavedSearch(ctx, model.SavedSearch{AccountID: alice.ID, Name: "go", Query: "tag:go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// library returns everything of alice that bob could change
+	library := func() string {
+		t.Helper()
+
+		result := []interface{}{}
+		for _, trashed := range []bool{false, true} {
+			bookmarks, err := h.DB.GetBookMarks(ctx, database.GetBookmarksOptions{AccountID: alice.ID, Trashed: trashed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, bookmarks)
+		}
+
+		highlights, err := h.DB.GetHighlights(ctx, book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, err := h.DB.GetTags(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searches, err := h.DB.GetSavedSearches(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts, err := h.DB.GetAccounts(ctx, database.GetAccountsOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := json.Marshal(append(result, highlights, tags, searches, accounts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	before := library()
+
+	// Every write route fails or changes nothing for another account
+	bob := login(t, h, "bob", "secret")
+	for _, req := range []struct {
+		name   string
+		handle httprouter.Handle
+		method string
+		target string
+		body   string
+	}{
+		{"trash bookmarks", h.apiDeleteBookmarks, http.MethodDelete, "/", fmt.Sprintf("[%d]", book.ID)},
+		{"delete bookmarks", h.apiDeleteBookmarks, http.MethodDelete, "/?permanent=true", fmt.Sprintf("[%d]", books[1].ID)},
+		{"restore bookmarks", h.apiRestoreBookmarks, http.MethodPost, "/", fmt.Sprintf("[%d]", books[1].ID)},
+		{"restore all bookmarks", h.apiRestoreBookmarks, http.MethodPost, "/", "[]"},
+		{"save notes", h.apiSaveBookmarkNotes, http.MethodPut, "/", fmt.Sprintf(`{"id":%d,"notes":"mine"}`, book.ID)},
+		{"save progress", h.apiSaveReadingProgress, http.MethodPut, "/", fmt.Sprintf(`{"id":%d,"progress":50}`, book.ID)},
+		{"rollback revision", h.apiRollbackRevision, http.MethodPost, "/", fmt.Sprintf(`{"id":%d}`, revisions[0].ID)},
+		{"insert highlight", h.apiInsertHighlight, http.MethodPost, "/", fmt.Sprintf(`{"bookmarkId":%d,"quote":"is","startOffset":3,"endOffset":5}`, book.ID)},
+		{"update highlight", h.apiUpdateHighlight, http.MethodPut, "/", fmt.Sprintf(`{"id":%d,"bookmarkId":%d,"quote":"simple","startOffset":6,"endOffset":12}`, highlight.ID, book.ID)},
+		{"delete highlights", h.apiDeleteHighlights, http.MethodDelete, "/", fmt.Sprintf("[%d]", highlight.ID)},
+		{"rename tag", h.apiRenameTag, http.MethodPut, "/", fmt.Sprintf(`{"id":%d,"name":"mine"}`, book.Tags[0].ID)},
+		{"update saved search", h.apiUpdateSavedSearch, http.MethodPut, "/", fmt.Sprintf(`{"id":%d,"name":"mine","query":"rust"}`, search.ID)},
+		{"delete saved searches", h.apiDeleteSavedSearches, http.MethodDelete, "/", fmt.Sprintf("[%d]", search.ID)},
+		{"insert account", h.apiInsertAccount, http.MethodPost, "/", `{"username":"eve","password":"secret","owner":true}`},
+		{"update account", h.apiUpdateAccount, http.MethodPut, "/", `{"username":"alice","newPassword":"changed"}`},
+		{"delete account", h.apiDeleteAccount, http.MethodDelete, "/", `["alice"]`},
+	} {
+		w := serveTest(req.handle, req.method, req.target, bob, req.body)
+		if after := library(); after != before {
+			t.Errorf("%s changed the library of another account: %d %s\n%s", req.name, w.Code, w.Body, after)
+			before = after
+		}
+	}
+}
+
+func TestAPISavedSearches(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.TODO()
+
+	// The default admin has no account to own searches
+	admin := login(t, h, "admin", "admin")
+	if w := serveTest(h.apiInsertSavedSearch, http.MethodPost, "/api/searches", admin, `{"name":"go","query":"go"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("default admin shouldn't save searches, got %d", w.Code)
+	}
+
+	accountIDs := map[string]int{}
+	for _, username := range []string{"shiori", "reader"} {
+		account, err := h.DB.SaveAccount(ctx, model.Account{Username: username, Password: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		accountIDs[username] = account.ID
+	}
+
+	// Searches only find the bookmarks of the account
+	_, err := h.DB.SaveBookmarks(ctx, true,
+		model.Bookmark{AccountID: accountIDs["shiori"], URL: "https://go.dev", Title: "Go", Tags: []model.Tag{{Name: "dev/go"}}},
+		model.Bookmark{AccountID: accountIDs["shiori"], URL: "https://www.rust-lang.org", Title: "Rust", Tags: []model.Tag{{Name: "dev/rust"}}},
+		model.Bookmark{AccountID: accountIDs["shiori"], URL: "https://news.ycombinator.com", Title: "Hacker News"},
+		model.Bookmark{AccountID: accountIDs["reader"], URL: "https://go.dev/blog", Title: "Go Blog", Tags: []model.Tag{{Name: "dev/go"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Accounts that aren't owner can manage their own searches
+	session := login(t, h, "shiori", "secret")
+	w := serveTest(h.apiInsertSavedSearch, http.MethodPost, "/api/searches", session, `{"name":"dev","query":"tag:dev"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to save search: %d %s", w.Code, w.Body)
+	}
+
+	search := model.SavedSearch{}
+	if err := json.Unmarshal(w.Body.Bytes(), &search); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serveTest(h.apiInsertSavedSearch, http.MethodPost, "/api/searches", session, `{"name":"broken","query":"tag:"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("malformed query shouldn't be saved, got %d", w.Code)
+	}
+
+	getBookmarks := func(session, query string) (int, []string) {
+		t.Helper()
+
+		handle := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			h.apiGetSavedSearchBookmarks(w, r, httprouter.Params{{Key: "id", Value: fmt.Sprint(search.ID)}})
+		}
+
+		w := serveTest(handle, http.MethodGet, fmt.Sprintf("/api/searches/%d/bookmarks?%s", search.ID, query), session, "")
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+
+		resp := struct {
+			Bookmarks []model.Bookmark `json:"bookmarks"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		titles := []string{}
+		for _, book := range resp.Bookmarks {
+			titles = append(titles, book.Title)
+		}
+		return w.Code, titles
+	}
+
+	if _, titles := getBookmarks(session, "order=title"); strings.Join(titles, ",") != "Go,Rust" {
+		t.Errorf("unexpected bookmarks of saved search %v", titles)
+	}
+
+	if _, titles := getBookmarks(session, "q=-rust"); strings.Join(titles, ",") != "Go" {
+		t.Errorf("unexpected bookmarks of narrowed saved search %v", titles)
+	}
+
+	// Another account can't see or change the search
+	other := login(t, h, "reader", "secret")
+	if code, _ := getBookmarks(other, ""); code != http.StatusInternalServerError {
+		t.Errorf("search of another account shouldn't be found, got %d", code)
+	}
+
+	body := fmt.Sprintf(`{"id":%d,"name":"stolen","query":"go"}`, search.ID)
+	if w := serveTest(h.apiUpdateSavedSearch, http.MethodPut, "/api/searches", other, body); w.Code != http.StatusInternalServerError {
+		t.Errorf("search of another account shouldn't be updated, got %d", w.Code)
+	}
+
+	// Update the query, then list the searches with their count
+	body = fmt.Sprintf(`{"id":%d,"name":"dev","query":"tag:dev OR news"}`, search.ID)
+	if w := serveTest(h.apiUpdateSavedSearch, http.MethodPut, "/api/searches", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to update search: %d %s", w.Code, w.Body)
+	}
+
+	w = serveTest(h.apiGetSavedSearches, http.MethodGet, "/api/searches?count=true", session, "")
+	searches := []model.SavedSearch{}
+	if err := json.Unmarshal(w.Body.Bytes(), &searches); err != nil {
+		t.Fatalf("failed to get searches: %v %s", err, w.Body)
+	}
+	if len(searches) != 1 || searches[0].Name != "dev" || searches[0].NBookmarks != 3 {
+		t.Errorf("unexpected searches %s", w.Body)
+	}
+
+	w = serveTest(h.apiGetSavedSearches, http.MethodGet, "/api/searches", other, "")
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("unexpected searches of another account %s", w.Body)
+	}
+
+	// Delete the search
+	body = fmt.Sprintf("[%d]", search.ID)
+	if w := serveTest(h.apiDeleteSavedSearches, http.MethodDelete, "/api/searches", session, body); w.Code != http.StatusOK {
+		t.Fatalf("failed to delete search: %d %s", w.Code, w.Body)
+	}
+
+	if code, _ := getBookmarks(session, ""); code != http.StatusInternalServerError {
+		t.Errorf("deleted search shouldn't be found, got %d", code)
+	}
+}
+
+func TestAPIPublicBookmarks(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.TODO()
+
+	books, err := h.DB.SaveBookmarks(ctx, true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go", Public: 1, Notes: "secret", Tags: []model.Tag{{Name: "lang/go"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "Rust", Public: 1, Tags: []model.Tag{{Name: "lang/rust"}}},
+		model.Bookmark{URL: "https://www.python.org", Title: "Python", Tags: []model.Tag{{Name: "lang/python"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Public bookmarks in trash aren't listed
+	if err := h.DB.TrashBookmarks(ctx, books[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveTest(h.apiGetPublicBookmarks, http.MethodGet, "/api/public/bookmarks", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to get public bookmarks: %d %s", w.Code, w.Body)
+	}
+
+	resp := struct {
+		Bookmarks []model.Bookmark `json:"bookmarks"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Bookmarks) != 1 || resp.Bookmarks[0].ID != books[0].ID {
+		t.Fatalf("unexpected public bookmarks %s", w.Body)
+	}
+	if book := resp.Bookmarks[0]; book.Notes != "" || book.AccountID != 0 {
+		t.Fatalf("public bookmark exposes private fields %s", w.Body)
+	}
+
+	for _, query := range []string{"trash=true", "tags=lang/rust", "q=is%3Aprivate"} {
+		w := serveTest(h.apiGetPublicBookmarks, http.MethodGet, "/api/public/bookmarks?"+query, "", "")
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v %s", query, err, w.Body)
+		}
+		for _, book := range resp.Bookmarks {
+			if book.ID != books[0].ID {
+				t.Fatalf("%s: unexpected public bookmark %d", query, book.ID)
+			}
+		}
+	}
+
+	// Notes and highlights aren't searched, only the title, excerpt, URL and content
+	if _, err := h.DB.SaveHighlight(ctx, model.Highlight{BookmarkID: books[0].ID, Quote: "Go", EndOffset: 2, Comment: "hidden"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, want := range map[string]int{
+		"keyword=secret": 0,
+		"q=secret":       0,
+		"keyword=hidden": 0,
+		"q=hidden":       0,
+		"keyword=go":     1,
+		"q=go":           1,
+	} {
+		w := serveTest(h.apiGetPublicBookmarks, http.MethodGet, "/api/public/bookmarks?"+query, "", "")
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v %s", query, err, w.Body)
+		}
+		if len(resp.Bookmarks) != want {
+			t.Errorf("%s: expected %d public bookmarks, got %s", query, want, w.Body)
+		}
+	}
+
+	if w := serveTest(h.apiGetPublicBookmarks, http.MethodGet, "/api/public/bookmarks?order=unread", "", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected unread order to fail, got %d", w.Code)
+	}
+
+	w = serveTest(h.apiGetPublicTags, http.MethodGet, "/api/public/tags", "", "")
+	tags := []model.Tag{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tags); err != nil {
+		t.Fatalf("failed to get public tags: %v %s", err, w.Body)
+	}
+	if len(tags) != 2 || tags[0].Name != "lang" || tags[0].NBookmarks != 1 || tags[1].Name != "lang/go" {
+		t.Fatalf("unexpected public tags %s", w.Body)
+	}
+}
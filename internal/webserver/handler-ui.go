@@ -1,11 +1,20 @@
 package webserver
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"github.com/new-aspect/shiori-practice/internal/database"
+	"github.com/new-aspect/shiori-practice/internal/model"
 	"log"
 	"net/http"
+	"os"
 	"path"
 	fp "path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -45,7 +54,7 @@ func (h *handler) serveFile(w http.ResponseWriter, r *http.Request, ps httproute
 // serveIndexPage is handler for GET /
 func (h *handler) serveIndexPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// make sure session still valid
-	err := h.validateSession(r)
+	_, err := h.validateSession(r)
 	if err != nil {
 		newPath := path.Join(h.RootPath, "/login")
 		redirectURL := createRedirectURL(newPath, r.URL.String())
@@ -68,7 +77,7 @@ func (h *handler) serveIndexPage(w http.ResponseWriter, r *http.Request, ps http
 func (h *handler) serveLoginPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Make sure session is not valid
 	// 啊，你原来是在这里设置的rootPath ，我哭了
-	err := h.validateSession(r)
+	_, err := h.validateSession(r)
 	if err == nil {
 		redirectURL := path.Join(h.RootPath, "/")
 		redirectPage(w, r, redirectURL)
@@ -90,3 +99,195 @@ func (h *handler) serveVueDemoPage(w http.ResponseWriter, r *http.Request, ps ht
 	err := h.templates["v2"].Execute(w, h.RootPath)
 	CheckError(err)
 }
+
+// bookmarkPage is the data of the templates of bookmark pages.
+type bookmarkPage struct {
+	RootPath string
+	Book     model.Bookmark
+	// Editable is whether the user session can highlight the bookmark
+	// and save its reading progress, see canEditBookmark.
+	Editable bool
+	// Nonce allows the scripts of the page to run, see contentPolicy.
+	Nonce string
+}
+
+// contentPolicy is the Content-Security-Policy of the readable content page, formatted
+// with the nonce of its scripts. The HTML of bookmark comes from other sites and is shown
+// to anonymous visitors of public bookmarks, so nothing else in it may run or be embedded.
+// Scripts don't come from 'self', as the archives are served from there as well.
+const contentPolicy = "default-src 'self'; script-src 'nonce-%s'; object-src 'none'; frame-src 'none'; " +
+	"base-uri 'self'; form-action 'none'; img-src * data:; media-src *; style-src 'self' 'unsafe-inline'"
+
+// newNonce returns a random nonce for the scripts of a page, in URL safe
+// base64 so it stays the same in the attributes of templates.
+func newNonce() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	CheckError(err)
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// getPageBookmark fetch the bookmark of the pages under /bookmark/:id with its content.
+// Public bookmarks are shown to everyone, the others need a session that can access them,
+// otherwise it redirects to login page and returns false.
+func (h *handler) getPageBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (model.Bookmark, bool) {
+	ctx := r.Context()
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	CheckError(err)
+
+	bookmarks, err := h.DB.GetBookMarks(ctx, database.GetBookmarksOptions{
+		IDs:         []int{id},
+		WithContent: true,
+	})
+	CheckError(err)
+
+	if len(bookmarks) == 0 {
+		panic(fmt.Errorf("bookmark %d doesn't exist", id))
+	}
+	book := bookmarks[0]
+
+	if book.Public == 0 {
+		libraryID, err := h.validateSession(r)
+		if err != nil {
+			newPath := path.Join(h.RootPath, "/login")
+			redirectURL := createRedirectURL(newPath, r.URL.String())
+			redirectPage(w, r, redirectURL)
+			return book, false
+		}
+
+		h.checkBookmarkAccess(ctx, libraryID, book.ID)
+	}
+
+	book.HasArchive = fileExists(fp.Join(h.DataDir, "archive", strconv.Itoa(book.ID)))
+	return book, true
+}
+
+// canEditBookmark reports whether the user session can change the bookmark,
+// visitors of a public bookmark can only read it.
+func (h *handler) canEditBookmark(r *http.Request, book model.Bookmark) bool {
+	libraryID, err := h.validateSession(r)
+	if err != nil {
+		return false
+	}
+
+	return libraryID == 0 || libraryID == book.AccountID
+}
+
+// serveBookmarkContent is handler for GET /bookmark/:id, the readable content of bookmark
+func (h *handler) serveBookmarkContent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	book, ok := h.getPageBookmark(w, r, ps)
+	if !ok {
+		return
+	}
+
+	if developmentMode {
+		if err := h.prepareTemplates(); err != nil {
+			log.Printf("error during template preparation: %s", err)
+		}
+	}
+
+	// Visitors don't see what only the account of bookmark should see
+	editable := h.canEditBookmark(r, book)
+	if !editable {
+		book = publicBookmark(book)
+	}
+
+	// Only the page's own script runs, not the ones in the HTML of bookmark
+	nonce := newNonce()
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(contentPolicy, nonce))
+
+	err := h.templates["content"].Execute(w, bookmarkPage{RootPath: h.RootPath, Book: book, Editable: editable, Nonce: nonce})
+	CheckError(err)
+}
+
+// bodyTag matches the opening body tag of HTML page
+var bodyTag = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+// serveBookmarkArchive is handler for GET /bookmark/:id/archive.
+// Archived HTML page is shown with a header that links to the original and readable page.
+func (h *handler) serveBookmarkArchive(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	book, ok := h.getPageBookmark(w, r, ps)
+	if !ok {
+		return
+	}
+
+	content, err := os.ReadFile(fp.Join(h.DataDir, "archive", strconv.Itoa(book.ID)))
+	if os.IsNotExist(err) {
+		panic(fmt.Errorf("bookmark %d has no archive", book.ID))
+	}
+	CheckError(err)
+
+	// The archived page comes from another site, so it's sandboxed
+	// and can't run scripts with the session of user
+	contentType := http.DetectContentType(content)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	if !strings.HasPrefix(contentType, "text/html") {
+		_, err = w.Write(content)
+		CheckError(err)
+		return
+	}
+
+	// Put the header right after the body tag, or at the start of page without it
+	header := bytes.Buffer{}
+	err = h.templates["archive"].Execute(&header, bookmarkPage{RootPath: h.RootPath, Book: book})
+	CheckError(err)
+
+	pos := 0
+	if loc := bodyTag.FindIndex(content); loc != nil {
+		pos = loc[1]
+	}
+
+	page := append([]byte{}, content[:pos]...)
+	page = append(page, header.Bytes()...)
+	page = append(page, content[pos:]...)
+
+	_, err = w.Write(page)
+	CheckError(err)
+}
+
+// serveThumbnailImage is handler for GET /bookmark/:id/thumb
+func (h *handler) serveThumbnailImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	book, ok := h.getPageBookmark(w, r, ps)
+	if !ok {
+		return
+	}
+
+	imgPath := fp.Join(h.DataDir, "thumb", strconv.Itoa(book.ID))
+	if !fileExists(imgPath) {
+		panic(fmt.Errorf("bookmark %d has no thumbnail", book.ID))
+	}
+
+	http.ServeFile(w, r, imgPath)
+}
+
+// servePublicPage is handler for GET /public/. It lists the public bookmarks
+// with their tags, ?tags= narrows it down to a tag. No session is required.
+func (h *handler) servePublicPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	list := h.listBookmarks(r, database.SearchQuery{}, 0, true)
+	tags := h.getPublicTags(r.Context())
+
+	if developmentMode {
+		if err := h.prepareTemplates(); err != nil {
+			log.Printf("error during template preparation: %s", err)
+		}
+	}
+
+	data := struct {
+		bookmarkList
+		RootPath string
+		Tag      string
+		Tags     []model.Tag
+	}{
+		bookmarkList: list,
+		RootPath:     h.RootPath,
+		Tag:          r.URL.Query().Get("tags"),
+		Tags:         tags,
+	}
+
+	err := h.templates["public"].Execute(w, data)
+	CheckError(err)
+}
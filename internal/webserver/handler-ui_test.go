@@ -0,0 +1,103 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	fp "path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/new-aspect/shiori-practice/internal/model"
+)
+
+func TestPublicBookmarkPages(t *testing.T) {
+	h := newTestHandler(t)
+	h.RootPath = "/"
+	if err := h.prepareTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	books, err := h.DB.SaveBookmarks(ctx, true,
+		model.Bookmark{URL: "https://go.dev", Title: "Go", Public: 1, Content: "simple",
+			HTML: `<p>simple</p><script>alert("xss")</script>`, Tags: []model.Tag{{Name: "go"}}},
+		model.Bookmark{URL: "https://www.rust-lang.org", Title: "Rust", Content: "safe", HTML: "<p>safe</p>"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archiveDir := fp.Join(h.DataDir, "archive")
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archive := []byte("<html><body><p>archived</p></body></html>")
+	if err := os.WriteFile(fp.Join(archiveDir, fmt.Sprint(books[0].ID)), archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var policy string
+	servePage := func(handle httprouter.Handle, id int, target, session string) (int, string) {
+		t.Helper()
+
+		withID := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			handle(w, r, httprouter.Params{{Key: "id", Value: fmt.Sprint(id)}})
+		}
+
+		w := serveTest(withID, http.MethodGet, target, session, "")
+		policy = w.Header().Get("Content-Security-Policy")
+		return w.Code, w.Body.String()
+	}
+
+	// Public bookmark doesn't need session
+	code, body := servePage(h.serveBookmarkContent, books[0].ID, "/bookmark/1", "")
+	if code != http.StatusOK || !strings.Contains(body, "<p>simple</p>") || !strings.Contains(body, "/archive") {
+		t.Fatalf("unexpected public content %d %s", code, body)
+	}
+	if !strings.Contains(body, `data-editable="false"`) || strings.Contains(body, "highlight-button") {
+		t.Fatalf("expected visitor not to highlight public content %s", body)
+	}
+
+	// Only the script with the nonce of page runs, not the ones in the HTML of bookmark
+	nonce := regexp.MustCompile(`script-src 'nonce-([^']+)'`).FindStringSubmatch(policy)
+	if nonce == nil || !strings.Contains(body, `<script nonce="`+nonce[1]+`" src="js/page/content.js">`) {
+		t.Fatalf("unexpected policy of content %q %s", policy, body)
+	}
+	if _, body := servePage(h.serveBookmarkContent, books[0].ID, "/bookmark/1", ""); strings.Contains(body, nonce[1]) {
+		t.Error("nonce is used again")
+	}
+
+	code, body = servePage(h.serveBookmarkArchive, books[0].ID, "/bookmark/1/archive", "")
+	if code != http.StatusOK || !strings.Contains(body, "archived") || !strings.Contains(body, "View Readable") {
+		t.Fatalf("unexpected public archive %d %s", code, body)
+	}
+
+	// Private bookmark redirects to login, unless there is a session
+	if code, _ := servePage(h.serveBookmarkContent, books[1].ID, "/bookmark/2", ""); code != http.StatusMovedPermanently {
+		t.Fatalf("expected private content to redirect, got %d", code)
+	}
+
+	if err := h.DB.SaveReadingState(ctx, books[1].ID, model.StatusInProgress, 40); err != nil {
+		t.Fatal(err)
+	}
+
+	session := login(t, h, "admin", "admin")
+	if code, body := servePage(h.serveBookmarkContent, books[1].ID, "/bookmark/2", session); code != http.StatusOK || !strings.Contains(body, "<p>safe</p>") ||
+		!strings.Contains(body, `data-editable="true"`) || !strings.Contains(body, "highlight-button") || !strings.Contains(body, `data-progress="40"`) {
+		t.Fatalf("unexpected private content %d %s", code, body)
+	}
+
+	w := serveTest(h.servePublicPage, http.MethodGet, "/public/", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Go") || strings.Contains(w.Body.String(), "Rust") {
+		t.Fatalf("unexpected public page %d %s", w.Code, w.Body)
+	}
+
+	w = serveTest(h.servePublicPage, http.MethodGet, "/public/?tags=rust", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "No public bookmarks yet") {
+		t.Fatalf("unexpected public page of tag %d %s", w.Code, w.Body)
+	}
+}
@@ -1,6 +1,7 @@
 package webserver
 
 import (
+	"context"
 	"fmt"
 	"github.com/new-aspect/shiori-practice/internal/database"
 	"github.com/new-aspect/shiori-practice/internal/model"
@@ -44,22 +45,23 @@ func (h *handler) prepareTemplates() error {
 		},
 	}
 
-	// Create template for login, index and content
-	for _, name := range []string{"login", "index", "content", "v1", "v2"} {
+	// Create template for login, index, content and public bookmarks
+	for _, name := range []string{"login", "index", "content", "public", "v1", "v2"} {
 		h.templates[name], err = createTemplate(name+".html", funcMap)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Create template for archive overlay
+	// Create template for archive overlay, it's executed with bookmarkPage
 	h.templates["archive"], err = template.New("archive").Delims("$$", "$$").Parse(
-		`<div id="shiori-archive-header">
+		`<link href="$$.RootPath$$css/archive.css" rel="stylesheet">
+		<div id="shiori-archive-header">
 		<p id="shiori-logo"><span>栞</span>shiori</p>
 		<div class="spacer"></div>
-		<a href="$$.URL$$" target="_blank">View Original</a>
-		$$if .HasContent$$
-		<a href="/bookmark/$$.ID$$/content">View Readable</a>
+		<a href="$$.Book.URL$$" target="_blank">View Original</a>
+		$$if .Book.HasContent$$
+		<a href="$$.RootPath$$bookmark/$$.Book.ID$$">View Readable</a>
 		$$end$$
 		</div>`)
 	if err != nil {
@@ -86,25 +88,162 @@ func (h *handler) getSessionID(r *http.Request) string {
 	return sessionID
 }
 
-// validateSession checks whether user session is still valid or not
-func (h *handler) validateSession(r *http.Request) error {
+// deleteUserSessions logs out all sessions of the user
+func (h *handler) deleteUserSessions(username string) {
+	if val, found := h.UserCache.Get(username); found {
+		for _, sessionID := range val.([]string) {
+			h.SessionCache.Delete(sessionID)
+		}
+		h.UserCache.Delete(username)
+	}
+}
+
+// getSessionAccount returns the account of user session, if it's still valid
+func (h *handler) getSessionAccount(r *http.Request) (model.Account, error) {
 	sessionID := h.getSessionID(r)
 	if sessionID == "" {
-		return fmt.Errorf("session is not exist")
+		return model.Account{}, fmt.Errorf("session is not exist")
 	}
 
-	// Make sure session is not expired yet
 	val, found := h.SessionCache.Get(sessionID)
 	if !found {
-		return fmt.Errorf("session has been expried")
+		return model.Account{}, fmt.Errorf("session has been expried")
 	}
 
-	// If this is not get request, make sure it's over
-	if r.Method != "" && r.Method != http.MethodGet {
-		if account := val.(model.Account); !account.Owner {
-			return fmt.Errorf("account level is not sufficient")
-		}
+	return val.(model.Account), nil
+}
+
+// validateOwnerSession checks whether user session is still valid and belongs to an owner,
+// whatever the request method is.
+func (h *handler) validateOwnerSession(r *http.Request) error {
+	account, err := h.getSessionAccount(r)
+	if err != nil {
+		return err
+	}
+
+	if !account.Owner {
+		return fmt.Errorf("account level is not sufficient")
 	}
 
 	return nil
 }
+
+// validateSession checks whether user session is still valid or not, and returns
+// ID of the library it can access. Every account can read and change the bookmarks
+// of its own library, so the handlers must scope the request to libraryID.
+func (h *handler) validateSession(r *http.Request) (libraryID int, err error) {
+	account, err := h.getSessionAccount(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return accountLibraryID(account), nil
+}
+
+// accountLibraryID returns ID of the account whose bookmarks the account can access.
+// Owners can access the bookmarks of every account, so it's 0 for them.
+func accountLibraryID(account model.Account) int {
+	if account.Owner {
+		return 0
+	}
+
+	return account.ID
+}
+
+// checkBookmarkAccess makes sure the bookmarks belong to the library, including
+// the trashed ones. The bookmarks of other accounts are reported as missing.
+func (h *handler) checkBookmarkAccess(ctx context.Context, libraryID int, ids ...int) {
+	if libraryID == 0 || len(ids) == 0 {
+		return
+	}
+
+	owned := map[int]bool{}
+	for _, id := range h.libraryBookmarkIDs(ctx, libraryID, ids...) {
+		owned[id] = true
+	}
+
+	for _, id := range ids {
+		if !owned[id] {
+			panic(fmt.Errorf("bookmark %d doesn't exist", id))
+		}
+	}
+}
+
+// checkRevisionAccess makes sure the revision belongs to a bookmark in the library.
+func (h *handler) checkRevisionAccess(ctx context.Context, libraryID int, id int) {
+	if libraryID == 0 || id == 0 {
+		return
+	}
+
+	revision, err := h.DB.GetBookmarkRevision(ctx, id)
+	CheckError(err)
+
+	h.checkBookmarkAccess(ctx, libraryID, revision.BookmarkID)
+}
+
+// checkHighlightAccess makes sure the highlight belongs to a bookmark in the library.
+func (h *handler) checkHighlightAccess(ctx context.Context, libraryID int, id int) {
+	if libraryID == 0 {
+		return
+	}
+
+	highlight, err := h.DB.GetHighlight(ctx, id)
+	CheckError(err)
+
+	h.checkBookmarkAccess(ctx, libraryID, highlight.BookmarkID)
+}
+
+// checkTagAccess makes sure the tag belongs to the library.
+func (h *handler) checkTagAccess(ctx context.Context, libraryID int, id int) {
+	if libraryID == 0 {
+		return
+	}
+
+	tags, err := h.DB.GetTags(ctx, libraryID)
+	CheckError(err)
+
+	for _, tag := range tags {
+		if tag.ID == id {
+			return
+		}
+	}
+
+	panic(fmt.Errorf("tag %d doesn't exist", id))
+}
+
+// scopeBookmarkIDs makes sure the bookmarks belong to the library. Without ids,
+// which means every bookmark, it returns IDs of every bookmark in the library
+// unless it's every account. ok is false when there is nothing to change.
+func (h *handler) scopeBookmarkIDs(ctx context.Context, libraryID int, ids []int) (result []int, ok bool) {
+	if libraryID == 0 {
+		return ids, true
+	}
+
+	if len(ids) == 0 {
+		ids = h.libraryBookmarkIDs(ctx, libraryID)
+		return ids, len(ids) > 0
+	}
+
+	h.checkBookmarkAccess(ctx, libraryID, ids...)
+	return ids, true
+}
+
+// libraryBookmarkIDs returns IDs of the bookmarks in the library, including
+// the trashed ones. Without ids, every bookmark of the library is returned.
+func (h *handler) libraryBookmarkIDs(ctx context.Context, libraryID int, ids ...int) []int {
+	result := []int{}
+	for _, trashed := range []bool{false, true} {
+		bookmarks, err := h.DB.GetBookMarks(ctx, database.GetBookmarksOptions{
+			IDs:       ids,
+			AccountID: libraryID,
+			Trashed:   trashed,
+		})
+		CheckError(err)
+
+		for _, book := range bookmarks {
+			result = append(result, book.ID)
+		}
+	}
+
+	return result
+}
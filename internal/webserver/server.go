@@ -157,7 +157,38 @@ func ServeApp(cfg Config) error {
 	router.GET(jp("/login"), withLogging(hdl.serveLoginPage))
 	router.GET(jp("/v"), withLogging(hdl.serveVueDemoPage))
 
+	// Public bookmarks are served without session
+	router.GET(jp("/public")+"/", withLogging(hdl.servePublicPage))
+	router.GET(jp("/bookmark/:id"), withLogging(hdl.serveBookmarkContent))
+	router.GET(jp("/bookmark/:id/archive"), withLogging(hdl.serveBookmarkArchive))
+	router.GET(jp("/bookmark/:id/thumb"), withLogging(hdl.serveThumbnailImage))
+	router.GET(jp("/api/public/bookmarks"), withLogging(hdl.apiGetPublicBookmarks))
+	router.GET(jp("/api/public/tags"), withLogging(hdl.apiGetPublicTags))
+
 	router.POST(jp("/api/login"), withLogging(hdl.apiLogin))
+	router.GET(jp("/api/bookmarks"), withLogging(hdl.apiGetBookmarks))
+	router.DELETE(jp("/api/bookmarks"), withLogging(hdl.apiDeleteBookmarks))
+	router.POST(jp("/api/bookmarks/restore"), withLogging(hdl.apiRestoreBookmarks))
+	router.PUT(jp("/api/bookmarks/notes"), withLogging(hdl.apiSaveBookmarkNotes))
+	router.PUT(jp("/api/bookmarks/progress"), withLogging(hdl.apiSaveReadingProgress))
+	router.GET(jp("/api/revisions"), withLogging(hdl.apiGetRevisions))
+	router.GET(jp("/api/revisions/diff"), withLogging(hdl.apiDiffRevisions))
+	router.POST(jp("/api/revisions/rollback"), withLogging(hdl.apiRollbackRevision))
+	router.GET(jp("/api/highlights"), withLogging(hdl.apiGetHighlights))
+	router.POST(jp("/api/highlights"), withLogging(hdl.apiInsertHighlight))
+	router.PUT(jp("/api/highlights"), withLogging(hdl.apiUpdateHighlight))
+	router.DELETE(jp("/api/highlights"), withLogging(hdl.apiDeleteHighlights))
+	router.GET(jp("/api/tags"), withLogging(hdl.apiGetTags))
+	router.PUT(jp("/api/tags"), withLogging(hdl.apiRenameTag))
+	router.GET(jp("/api/accounts"), withLogging(hdl.apiGetAccounts))
+	router.POST(jp("/api/accounts"), withLogging(hdl.apiInsertAccount))
+	router.PUT(jp("/api/accounts"), withLogging(hdl.apiUpdateAccount))
+	router.DELETE(jp("/api/accounts"), withLogging(hdl.apiDeleteAccount))
+	router.GET(jp("/api/searches"), withLogging(hdl.apiGetSavedSearches))
+	router.POST(jp("/api/searches"), withLogging(hdl.apiInsertSavedSearch))
+	router.PUT(jp("/api/searches"), withLogging(hdl.apiUpdateSavedSearch))
+	router.DELETE(jp("/api/searches"), withLogging(hdl.apiDeleteSavedSearches))
+	router.GET(jp("/api/searches/:id/bookmarks"), withLogging(hdl.apiGetSavedSearchBookmarks))
 	// todo 这里还有很多接口
 
 	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, arg interface{}) {
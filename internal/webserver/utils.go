@@ -93,6 +93,13 @@ func CheckError(err error) {
 	panic(err)
 }
 
+// fileExists checks whether the file exists in the local file system
+// and it's not a directory.
+func fileExists(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && !info.IsDir()
+}
+
 func serveFile(w http.ResponseWriter, filePath string, cache bool) error {
 	// Open file
 	src, err := assets.Open(filePath)